@@ -0,0 +1,126 @@
+// Copyright 2019 Luis Guillén Civera <luisguillenc@gmail.com>. View LICENSE.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/luids-io/core/yalogi"
+	"github.com/luids-io/event/pkg/eventproc"
+	"github.com/luids-io/event/pkg/eventproc/admin"
+)
+
+func cmdStats(args []string, logger yalogi.Logger) int {
+	return withAdmin(logger, func(ctx context.Context, client *admin.Client) error {
+		stats, err := client.Stats(ctx)
+		if err != nil {
+			return err
+		}
+		return printJSON(stats)
+	})
+}
+
+func cmdStacks(args []string, logger yalogi.Logger) int {
+	return withAdmin(logger, func(ctx context.Context, client *admin.Client) error {
+		if len(args) > 0 {
+			stack, err := client.Stack(ctx, args[0])
+			if err != nil {
+				return err
+			}
+			printStacks([]admin.StackInfo{stack})
+			return nil
+		}
+		stacks, err := client.Stacks(ctx)
+		if err != nil {
+			return err
+		}
+		printStacks(stacks)
+		return nil
+	})
+}
+
+func cmdModule(args []string, logger yalogi.Logger) int {
+	if len(args) != 3 {
+		fmt.Fprintln(os.Stderr, "required: enable|disable <stack> <module>")
+		return 1
+	}
+	action, ok := subcommand(args[:1], "enable", "disable")
+	if !ok {
+		return 1
+	}
+	return withAdmin(logger, func(ctx context.Context, client *admin.Client) error {
+		stack, err := client.SetModuleDisabled(ctx, args[1], args[2], action == "disable")
+		if err != nil {
+			return err
+		}
+		printStacks([]admin.StackInfo{stack})
+		return nil
+	})
+}
+
+func cmdPause(args []string, logger yalogi.Logger) int {
+	return withAdmin(logger, func(ctx context.Context, client *admin.Client) error {
+		return printStats(client.Pause(ctx))
+	})
+}
+
+func cmdResume(args []string, logger yalogi.Logger) int {
+	return withAdmin(logger, func(ctx context.Context, client *admin.Client) error {
+		return printStats(client.Resume(ctx))
+	})
+}
+
+func cmdReload(args []string, logger yalogi.Logger) int {
+	return withAdmin(logger, func(ctx context.Context, client *admin.Client) error {
+		return printStats(client.Reload(ctx))
+	})
+}
+
+func withAdmin(logger yalogi.Logger, fn func(context.Context, *admin.Client) error) int {
+	client, err := createAdminClient()
+	if err != nil {
+		logger.Errorf("couldn't create admin client: %v", err)
+		return 1
+	}
+	err = fn(context.Background(), client)
+	if err != nil {
+		logger.Errorf("%v", err)
+		return 1
+	}
+	return 0
+}
+
+func printStats(stats eventproc.Stats, err error) error {
+	if err != nil {
+		return err
+	}
+	return printJSON(stats)
+}
+
+func printJSON(v interface{}) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func printStacks(stacks []admin.StackInfo) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "STACK\tMODULE\tFILTERS\tPLUGINS\tONSUCCESS\tONERROR\tDISABLED\tPANICS")
+	for _, stack := range stacks {
+		name := stack.Name
+		if stack.Main {
+			name = name + "*"
+		}
+		for _, m := range stack.Modules {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%v\t%v\t%v\t%v\n", name, m.Name,
+				strings.Join(m.Filters, ","), strings.Join(m.Plugins, ","),
+				m.OnSuccess, m.OnError, m.Disabled, m.Panics)
+		}
+	}
+	w.Flush()
+}
@@ -0,0 +1,41 @@
+// Copyright 2019 Luis Guillén Civera <luisguillenc@gmail.com>. View LICENSE.
+
+package config
+
+import (
+	cconfig "github.com/luids-io/common/config"
+	"github.com/luids-io/core/goconfig"
+	iconfig "github.com/luids-io/event/internal/config"
+)
+
+// Default returns the default configuration
+func Default(program string) *goconfig.Config {
+	cfg, err := goconfig.New(program,
+		goconfig.Section{
+			Name:     "config",
+			Required: true,
+			Short:    true,
+			Data: &cconfig.ClientCfg{
+				RemoteURI: "tcp://127.0.0.1:5851",
+			},
+		},
+		goconfig.Section{
+			Name:     "admin",
+			Required: false,
+			Data: &iconfig.AdminClientCfg{
+				URL: "http://127.0.0.1:5852",
+			},
+		},
+		goconfig.Section{
+			Name:     "log",
+			Required: true,
+			Data: &cconfig.LoggerCfg{
+				Level: "info",
+			},
+		},
+	)
+	if err != nil {
+		panic(err)
+	}
+	return cfg
+}
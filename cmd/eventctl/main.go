@@ -0,0 +1,137 @@
+// Copyright 2019 Luis Guillén Civera <luisguillenc@gmail.com>. View LICENSE.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/pflag"
+
+	"github.com/luids-io/core/yalogi"
+	"github.com/luids-io/event/cmd/eventctl/config"
+)
+
+//Variables for version output
+var (
+	Program  = "eventctl"
+	Build    = "unknown"
+	Version  = "unknown"
+	Revision = "unknown"
+)
+
+var (
+	cfg = config.Default(Program)
+	//behaviour
+	configFile = ""
+	version    = false
+	debug      = false
+	help       = false
+	//spool
+	spoolDir  = "/var/lib/luids/event/deadletter"
+	spoolKeep = false
+	//tap
+	tapTrace  = false
+	tapBuffer = 0
+)
+
+// command defines the signature of the commands, it returns the exit code.
+type command func(args []string, logger yalogi.Logger) int
+
+var commands = map[string]command{
+	"spool":  cmdSpool,
+	"stats":  cmdStats,
+	"stacks": cmdStacks,
+	"module": cmdModule,
+	"pause":  cmdPause,
+	"resume": cmdResume,
+	"reload": cmdReload,
+	"tap":    cmdTap,
+}
+
+func init() {
+	//config mapped params
+	cfg.PFlags()
+	//behaviour params
+	pflag.StringVar(&configFile, "config", configFile, "Use explicit config file.")
+	pflag.BoolVar(&version, "version", version, "Show version.")
+	pflag.BoolVarP(&help, "help", "h", help, "Show this help.")
+	pflag.BoolVar(&debug, "debug", debug, "Enable debug.")
+	//spool params
+	pflag.StringVar(&spoolDir, "spool", spoolDir, "Dead-letter spool dir.")
+	pflag.BoolVar(&spoolKeep, "keep", spoolKeep, "Keep reinjected events in spool.")
+	//tap params
+	pflag.BoolVar(&tapTrace, "trace", tapTrace, "Include trace of the events in tap.")
+	pflag.IntVar(&tapBuffer, "buffer", tapBuffer, "Buffer size of the tap subscription.")
+	pflag.Usage = usage
+	pflag.Parse()
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s [options] <command> [args]\n\n", Program)
+	fmt.Fprintf(os.Stderr, "Commands:\n")
+	fmt.Fprintf(os.Stderr, "  stats                           Show processor statistics.\n")
+	fmt.Fprintf(os.Stderr, "  stacks [stack]                  List stacks and modules in use.\n")
+	fmt.Fprintf(os.Stderr, "  module enable|disable <stack> <module>\n")
+	fmt.Fprintf(os.Stderr, "                                  Enable or disable a module.\n")
+	fmt.Fprintf(os.Stderr, "  pause                           Pause the processing of events.\n")
+	fmt.Fprintf(os.Stderr, "  resume                          Resume the processing of events.\n")
+	fmt.Fprintf(os.Stderr, "  reload                          Reload stacks and event database.\n")
+	fmt.Fprintf(os.Stderr, "  tap [filter...]                 Stream events processed, filters in the format\n")
+	fmt.Fprintf(os.Stderr, "                                  \"field op value\" (ex: \"code == 10001\").\n")
+	fmt.Fprintf(os.Stderr, "  spool list                      List events in dead-letter spool.\n")
+	fmt.Fprintf(os.Stderr, "  spool reinject                  Notify again events in dead-letter spool.\n\n")
+	fmt.Fprintf(os.Stderr, "Options:\n")
+	pflag.PrintDefaults()
+}
+
+func main() {
+	if version {
+		fmt.Printf("version: %s\nrevision: %s\nbuild: %s\n", Version, Revision, Build)
+		os.Exit(0)
+	}
+	if help {
+		pflag.Usage()
+		os.Exit(0)
+	}
+	// check args
+	args := pflag.Args()
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "required command")
+		os.Exit(1)
+	}
+	cmd, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "invalid command '%s'\n", args[0])
+		os.Exit(1)
+	}
+	// load configuration
+	err := cfg.LoadIfFile(configFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	// creates logger
+	logger, err := createLogger(debug)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+	os.Exit(cmd(args[1:], logger))
+}
+
+func subcommand(args []string, valid ...string) (string, bool) {
+	if len(args) != 1 {
+		fmt.Fprintf(os.Stderr, "required one of: %s\n", strings.Join(valid, ", "))
+		return "", false
+	}
+	for _, v := range valid {
+		if args[0] == v {
+			return v, true
+		}
+	}
+	fmt.Fprintf(os.Stderr, "invalid subcommand '%s'\n", args[0])
+	return "", false
+}
@@ -0,0 +1,86 @@
+// Copyright 2019 Luis Guillén Civera <luisguillenc@gmail.com>. View LICENSE.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/luids-io/core/yalogi"
+	"github.com/luids-io/event/pkg/eventproc/deadletter"
+)
+
+func cmdSpool(args []string, logger yalogi.Logger) int {
+	sub, ok := subcommand(args, "list", "reinject")
+	if !ok {
+		return 1
+	}
+	if _, err := os.Stat(spoolDir); err != nil {
+		logger.Errorf("spool dir: %v", err)
+		return 1
+	}
+	spool, err := deadletter.Open(spoolDir)
+	if err != nil {
+		logger.Errorf("opening spool: %v", err)
+		return 1
+	}
+	names, err := spool.List()
+	if err != nil {
+		logger.Errorf("listing spool: %v", err)
+		return 1
+	}
+	switch sub {
+	case "list":
+		return spoolList(spool, names, logger)
+	case "reinject":
+		return spoolReinject(spool, names, logger)
+	}
+	return 1
+}
+
+func spoolList(spool *deadletter.Spool, names []string, logger yalogi.Logger) int {
+	for _, name := range names {
+		entry, err := spool.Load(name)
+		if err != nil {
+			logger.Warnf("%v", err)
+			continue
+		}
+		f := entry.Failure
+		fmt.Printf("%s\t%v\t%s\t%s.%s\t%s\t%s\n", entry.Stored.Format("2006-01-02T15:04:05"),
+			entry.Event.Code, entry.Event.ID, f.Stack, f.Module, f.Plugin, f.Error)
+	}
+	return 0
+}
+
+func spoolReinject(spool *deadletter.Spool, names []string, logger yalogi.Logger) int {
+	client, err := createClient(logger)
+	if err != nil {
+		logger.Errorf("couldn't create client: %v", err)
+		return 1
+	}
+	defer client.Close()
+
+	exit := 0
+	for _, name := range names {
+		entry, err := spool.Load(name)
+		if err != nil {
+			logger.Warnf("%v", err)
+			exit = 1
+			continue
+		}
+		newid, err := client.NotifyEvent(context.Background(), entry.Notification())
+		if err != nil {
+			logger.Errorf("reinjecting event '%s': %v", entry.Event.ID, err)
+			exit = 1
+			continue
+		}
+		fmt.Printf("%s\t%s\n", entry.Event.ID, newid)
+		if !spoolKeep {
+			if err := spool.Remove(name); err != nil {
+				logger.Warnf("removing '%s': %v", name, err)
+			}
+		}
+	}
+	return exit
+}
@@ -0,0 +1,42 @@
+// Copyright 2019 Luis Guillén Civera <luisguillenc@gmail.com>. View LICENSE.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/luids-io/core/yalogi"
+	"github.com/luids-io/event/pkg/eventproc/tap"
+)
+
+func cmdTap(args []string, logger yalogi.Logger) int {
+	client, err := createTapClient()
+	if err != nil {
+		logger.Errorf("couldn't create tap client: %v", err)
+		return 1
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-sigs
+		cancel()
+	}()
+	enc := json.NewEncoder(os.Stdout)
+	err = client.Stream(ctx, args, tapTrace, tapBuffer, func(msg tap.Message) error {
+		if msg.Dropped > 0 {
+			logger.Warnf("%v events dropped", msg.Dropped)
+		}
+		return enc.Encode(msg)
+	})
+	if err != nil && err != context.Canceled {
+		logger.Errorf("%v", err)
+		return 1
+	}
+	return 0
+}
@@ -4,6 +4,7 @@ package config
 
 import (
 	"errors"
+	"time"
 
 	cconfig "github.com/luids-io/common/config"
 	"github.com/luids-io/core/goconfig"
@@ -18,8 +19,24 @@ func Default(program string) *goconfig.Config {
 			Required: true,
 			Data: &iconfig.EventProcCfg{
 				Stack: iconfig.StackCfg{Main: "main"},
+				Queue: iconfig.QueueCfg{Policy: "block", Timeout: time.Second, Drain: time.Second},
 			},
 		},
+		goconfig.Section{
+			Name:     "eventproc.ratelimit",
+			Required: false,
+			Data:     &iconfig.RateLimitCfg{},
+		},
+		goconfig.Section{
+			Name:     "eventproc.dedup",
+			Required: false,
+			Data:     &iconfig.DedupCfg{},
+		},
+		goconfig.Section{
+			Name:     "eventproc.shard",
+			Required: false,
+			Data:     &iconfig.ShardCfg{},
+		},
 		goconfig.Section{
 			Name:     "service.event.notify",
 			Required: false,
@@ -56,6 +73,11 @@ func Default(program string) *goconfig.Config {
 				Level: "info",
 			},
 		},
+		goconfig.Section{
+			Name:     "admin",
+			Required: false,
+			Data:     &iconfig.AdminCfg{},
+		},
 		goconfig.Section{
 			Name:     "health",
 			Required: false,
@@ -5,9 +5,11 @@ package main
 // dependency injection functions
 
 import (
+	"context"
 	"fmt"
 
 	grpc_prometheus "github.com/grpc-ecosystem/go-grpc-prometheus"
+	"github.com/prometheus/client_golang/prometheus"
 	"google.golang.org/grpc"
 
 	"github.com/luids-io/api/event"
@@ -22,6 +24,10 @@ import (
 	ifactory "github.com/luids-io/event/internal/factory"
 	"github.com/luids-io/event/pkg/eventdb"
 	"github.com/luids-io/event/pkg/eventproc"
+	"github.com/luids-io/event/pkg/eventproc/admin"
+	"github.com/luids-io/event/pkg/eventproc/correlation"
+	"github.com/luids-io/event/pkg/eventproc/metrics"
+	"github.com/luids-io/event/pkg/eventproc/tap"
 )
 
 func createLogger(debug bool) (yalogi.Logger, error) {
@@ -59,7 +65,7 @@ func createAPIServices(msrv *serverd.Manager, logger yalogi.Logger) (apiservice.
 	return registry, nil
 }
 
-func createStacks(asvc apiservice.Discover, msrv *serverd.Manager, logger yalogi.Logger) (*eventproc.Builder, error) {
+func createStacks(asvc apiservice.Discover, msrv *serverd.Manager, logger yalogi.Logger) (*stacksManager, error) {
 	cfgStacks := cfg.Data("eventproc").(*iconfig.EventProcCfg)
 	builder, err := ifactory.StackBuilder(cfgStacks, asvc, logger)
 	if err != nil {
@@ -70,12 +76,13 @@ func createStacks(asvc apiservice.Discover, msrv *serverd.Manager, logger yalogi
 	if err != nil {
 		return nil, err
 	}
+	stacks := &stacksManager{cfg: cfgStacks, apisvc: asvc, logger: logger, builder: builder}
 	msrv.Register(serverd.Service{
 		Name:     "eventstacks",
 		Start:    builder.Start,
-		Shutdown: func() { builder.Shutdown() },
+		Shutdown: stacks.Shutdown,
 	})
-	return builder, nil
+	return stacks, nil
 }
 
 func createEventDB(logger yalogi.Logger) (eventdb.Database, error) {
@@ -83,19 +90,152 @@ func createEventDB(logger yalogi.Logger) (eventdb.Database, error) {
 	return ifactory.EventDB(cfgEventproc, logger)
 }
 
-func createEventProc(stacks *eventproc.Builder, db eventdb.Database, msrv *serverd.Manager, logger yalogi.Logger) (*eventproc.Processor, error) {
+func createEventProc(stacks *eventproc.Builder, db eventdb.Database, etap *tap.Tap, msrv *serverd.Manager, logger yalogi.Logger) (*eventproc.Processor, error) {
 	cfgEventProc := cfg.Data("eventproc").(*iconfig.EventProcCfg)
-	proc, err := ifactory.EventProc(cfgEventProc, stacks, db, logger)
+	opts := make([]eventproc.Option, 0)
+	cfgRateLimit := cfg.Data("eventproc.ratelimit").(*iconfig.RateLimitCfg)
+	if !cfgRateLimit.Empty() {
+		limits, err := ifactory.RateLimits(cfgRateLimit)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, limits...)
+	}
+	cfgDedup := cfg.Data("eventproc.dedup").(*iconfig.DedupCfg)
+	if !cfgDedup.Empty() {
+		dedup, err := ifactory.Dedup(cfgDedup)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, dedup)
+	}
+	cfgShard := cfg.Data("eventproc.shard").(*iconfig.ShardCfg)
+	if cfgShard.Enable {
+		shard, err := ifactory.Shard(cfgShard)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, shard)
+	}
+	hooks := eventproc.NewHooks()
+	opts = append(opts, eventproc.SetHooks(hooks))
+	var engine *correlation.Engine
+	if len(cfgEventProc.Rules.Files) > 0 || len(cfgEventProc.Rules.Dirs) > 0 {
+		var err error
+		engine, err = ifactory.Correlation(cfgEventProc, db, logger)
+		if err != nil {
+			return nil, err
+		}
+		engine.Hooks(hooks)
+	}
+	var pmetrics *metrics.Metrics
+	if cfgEventProc.Metrics {
+		pmetrics = metrics.New()
+		pmetrics.Hooks(hooks)
+	}
+	if etap != nil {
+		etap.Hooks(hooks)
+	}
+	proc, err := ifactory.EventProc(cfgEventProc, stacks, db, logger, opts...)
 	if err != nil {
 		return nil, err
 	}
+	if pmetrics != nil {
+		pmetrics.SetStats(proc.Stats)
+		err := prometheus.Register(pmetrics)
+		if are, ok := err.(prometheus.AlreadyRegisteredError); ok {
+			// replaces the metrics of a previous processor
+			prometheus.Unregister(are.ExistingCollector)
+			err = prometheus.Register(pmetrics)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
 	msrv.Register(serverd.Service{
-		Name:     "eventproc",
-		Shutdown: proc.Close,
+		Name: "eventproc",
+		Start: func() error {
+			_, err := proc.Replay()
+			return err
+		},
+		Shutdown: func() {
+			ctx, cancel := context.WithTimeout(context.Background(), cfgEventProc.Queue.Drain)
+			defer cancel()
+			proc.Shutdown(ctx)
+		},
+		Stop: proc.Close,
 	})
+	if engine != nil {
+		// registered after the processor, so it's closed before draining
+		msrv.Register(serverd.Service{
+			Name:     "eventproc.correlation",
+			Start:    func() error { return engine.Start(proc) },
+			Shutdown: engine.Close,
+		})
+	}
 	return proc, nil
 }
 
+func createTap(logger yalogi.Logger) *tap.Tap {
+	cfgAdmin := cfg.Data("admin").(*iconfig.AdminCfg)
+	if cfgAdmin.Empty() || !cfgAdmin.Tap {
+		return nil
+	}
+	return ifactory.Tap(cfgAdmin, logger)
+}
+
+func createAdminSrv(proc *eventproc.Processor, etap *tap.Tap, msrv *serverd.Manager, logger yalogi.Logger) error {
+	cfgAdmin := cfg.Data("admin").(*iconfig.AdminCfg)
+	if !cfgAdmin.Empty() {
+		var extra []admin.Option
+		if etap != nil {
+			extra = append(extra, admin.Tap(etap))
+		}
+		lis, srv, err := ifactory.Admin(cfgAdmin, proc, msrv.Reload, logger, extra...)
+		if err != nil {
+			return err
+		}
+		msrv.Register(serverd.Service{
+			Name:  fmt.Sprintf("admin.[%s]", cfgAdmin.ListenURI),
+			Start: func() error { go srv.Serve(lis); return nil },
+			Shutdown: func() {
+				if etap != nil {
+					etap.Close()
+				}
+				srv.Close()
+			},
+		})
+	}
+	return nil
+}
+
+func createReload(stacks *stacksManager, proc *eventproc.Processor, msrv *serverd.Manager, logger yalogi.Logger) error {
+	cfgEventProc := cfg.Data("eventproc").(*iconfig.EventProcCfg)
+	stacks.proc = proc
+	msrv.Register(serverd.Service{
+		Name:   "eventproc.reload",
+		Reload: stacks.Reload,
+	})
+	if cfgEventProc.Watch {
+		files := make([]string, 0, len(cfgEventProc.Stack.Files)+len(cfgEventProc.DB.Files))
+		files = append(files, cfgEventProc.Stack.Files...)
+		files = append(files, cfgEventProc.DB.Files...)
+		dirs := make([]string, 0, len(cfgEventProc.Stack.Dirs)+len(cfgEventProc.DB.Dirs))
+		dirs = append(dirs, cfgEventProc.Stack.Dirs...)
+		dirs = append(dirs, cfgEventProc.DB.Dirs...)
+		watcher, err := newFilesWatcher(files, dirs, msrv.Reload, logger)
+		if err != nil {
+			return err
+		}
+		msrv.Register(serverd.Service{
+			Name:     "eventproc.watch",
+			Start:    watcher.Start,
+			Shutdown: watcher.Shutdown,
+		})
+	}
+	return nil
+}
+
 func createNotifyAPI(gsrv *grpc.Server, notifier event.Notifier, msrv *serverd.Manager, logger yalogi.Logger) error {
 	cfgAPI := cfg.Data("service.event.notify").(*iconfig.EventNotifyAPICfg)
 	if cfgAPI.Enable {
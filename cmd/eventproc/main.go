@@ -93,12 +93,21 @@ func main() {
 		logger.Fatalf("couldn't create stacks: %v", err)
 	}
 
+	// create live event tap (if enabled)
+	etap := createTap(logger)
+
 	// create event processor
-	eproc, err := createEventProc(stacks, db, msrv, logger)
+	eproc, err := createEventProc(stacks.Builder(), db, etap, msrv, logger)
 	if err != nil {
 		logger.Fatalf("couldn't create eventproc: %v", err)
 	}
 
+	// create reload of stacks and event database
+	err = createReload(stacks, eproc, msrv, logger)
+	if err != nil {
+		logger.Fatalf("couldn't create reload: %v", err)
+	}
+
 	if dryRun {
 		fmt.Println("configuration seems ok")
 		os.Exit(0)
@@ -122,6 +131,12 @@ func main() {
 		logger.Fatalf("couldn't create forward api: %v", err)
 	}
 
+	// creates admin server
+	err = createAdminSrv(eproc, etap, msrv, logger)
+	if err != nil {
+		logger.Fatalf("couldn't create admin server: %v", err)
+	}
+
 	// creates health server
 	err = createHealthSrv(msrv, logger)
 	if err != nil {
@@ -11,6 +11,8 @@ import (
 
 	// event plugins
 	_ "github.com/luids-io/event/pkg/eventproc/filters/basicexpr"
+	_ "github.com/luids-io/event/pkg/eventproc/filters/composite"
+	_ "github.com/luids-io/event/pkg/eventproc/filters/expr"
 	_ "github.com/luids-io/event/pkg/eventproc/plugins/archiver"
 	_ "github.com/luids-io/event/pkg/eventproc/plugins/executor"
 	_ "github.com/luids-io/event/pkg/eventproc/plugins/forwarder"
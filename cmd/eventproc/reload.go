@@ -0,0 +1,185 @@
+// Copyright 2019 Luis Guillén Civera <luisguillenc@gmail.com>. View LICENSE.
+
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"github.com/luids-io/core/apiservice"
+	"github.com/luids-io/core/yalogi"
+	iconfig "github.com/luids-io/event/internal/config"
+	ifactory "github.com/luids-io/event/internal/factory"
+	"github.com/luids-io/event/pkg/eventproc"
+)
+
+// stacksManager holds the stack builder in use, it will be replaced when the
+// stacks are reloaded.
+type stacksManager struct {
+	cfg    *iconfig.EventProcCfg
+	apisvc apiservice.Discover
+	logger yalogi.Logger
+
+	mu      sync.Mutex
+	builder *eventproc.Builder
+	proc    *eventproc.Processor
+}
+
+// Builder returns the builder in use.
+func (m *stacksManager) Builder() *eventproc.Builder {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.builder
+}
+
+// Shutdown the builder in use.
+func (m *stacksManager) Shutdown() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.builder.Shutdown()
+}
+
+// Reload builds new stacks and event database and replaces them in the
+// processor. If there is an error, the previous stacks are kept.
+func (m *stacksManager) Reload() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.proc == nil {
+		return errors.New("event processor not set")
+	}
+	m.logger.Infof("reloading stacks and event database")
+	db, err := ifactory.EventDB(m.cfg, m.logger)
+	if err != nil {
+		return err
+	}
+	builder, err := ifactory.StackBuilder(m.cfg, m.apisvc, m.logger)
+	if err != nil {
+		return err
+	}
+	err = ifactory.Stacks(m.cfg, builder, m.logger)
+	if err != nil {
+		return err
+	}
+	err = builder.Start()
+	if err != nil {
+		builder.Shutdown()
+		return err
+	}
+	err = ifactory.ReloadEventProc(m.cfg, m.proc, builder, db)
+	if err != nil {
+		builder.Shutdown()
+		return err
+	}
+	prev := m.builder
+	m.builder = builder
+	if err := prev.Shutdown(); err != nil {
+		m.logger.Warnf("shutting down previous stacks: %v", err)
+	}
+	return nil
+}
+
+// filesWatcher calls reload when the files watched change. Changes are
+// accumulated during a delay, so several changes trigger only one reload.
+type filesWatcher struct {
+	logger  yalogi.Logger
+	watcher *fsnotify.Watcher
+	files   map[string]bool
+	dirs    map[string]bool
+	reload  func() error
+	done    chan struct{}
+	wg      sync.WaitGroup
+}
+
+const watchDelay = time.Second
+
+func newFilesWatcher(files, dirs []string, reload func() error, logger yalogi.Logger) (*filesWatcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	w := &filesWatcher{
+		logger:  logger,
+		watcher: watcher,
+		files:   make(map[string]bool),
+		dirs:    make(map[string]bool),
+		reload:  reload,
+		done:    make(chan struct{}),
+	}
+	// files are watched using its dir, so files replaced by editors are
+	// detected too
+	watched := make(map[string]bool)
+	for _, file := range files {
+		file = filepath.Clean(file)
+		w.files[file] = true
+		watched[filepath.Dir(file)] = true
+	}
+	for _, dir := range dirs {
+		dir = filepath.Clean(dir)
+		w.dirs[dir] = true
+		watched[dir] = true
+	}
+	for dir := range watched {
+		if err := watcher.Add(dir); err != nil {
+			watcher.Close()
+			return nil, err
+		}
+	}
+	return w, nil
+}
+
+func (w *filesWatcher) Start() error {
+	w.wg.Add(1)
+	go w.run()
+	return nil
+}
+
+func (w *filesWatcher) Shutdown() {
+	close(w.done)
+	w.watcher.Close()
+	w.wg.Wait()
+}
+
+func (w *filesWatcher) run() {
+	defer w.wg.Done()
+	var timer <-chan time.Time
+	for {
+		select {
+		case <-w.done:
+			return
+		case ev, ok := <-w.watcher.Events:
+			if !ok {
+				return
+			}
+			if ev.Op == fsnotify.Chmod || !w.match(ev.Name) {
+				continue
+			}
+			w.logger.Debugf("file '%s' changed", ev.Name)
+			if timer == nil {
+				timer = time.After(watchDelay)
+			}
+		case err, ok := <-w.watcher.Errors:
+			if !ok {
+				return
+			}
+			w.logger.Warnf("watching files: %v", err)
+		case <-timer:
+			timer = nil
+			if err := w.reload(); err != nil {
+				w.logger.Errorf("reloading: %v", err)
+			}
+		}
+	}
+}
+
+func (w *filesWatcher) match(name string) bool {
+	name = filepath.Clean(name)
+	if w.files[name] {
+		return true
+	}
+	return w.dirs[filepath.Dir(name)] && strings.HasSuffix(name, ".json")
+}
@@ -0,0 +1,133 @@
+// Copyright 2019 Luis Guillén Civera <luisguillenc@gmail.com>. See LICENSE.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/luids-io/api/event"
+	"github.com/luids-io/core/yalogi"
+	iconfig "github.com/luids-io/event/internal/config"
+	ifactory "github.com/luids-io/event/internal/factory"
+	"github.com/luids-io/event/pkg/eventproc"
+)
+
+const testEvents = `[{ "code": 10000, "type": "security", "codename": "test.security" }]`
+
+const testStacks = `[{
+	"name": "main",
+	"modules": [{
+		"name": "archive",
+		"plugins": [ { "class": "jsonwriter", "args": [ "events.json" ] }, { "class": "reloadtest" } ],
+		"onsuccess": "%s"
+	}]
+}]`
+
+// counters of the builder services of the test plugin
+var started, stopped int
+
+func init() {
+	eventproc.RegisterPlugin("reloadtest", func(b *eventproc.Builder, def *eventproc.ItemDef) (eventproc.ModulePlugin, error) {
+		b.OnStartup(func() error {
+			started++
+			return nil
+		})
+		b.OnShutdown(func() error {
+			stopped++
+			return nil
+		})
+		return eventproc.PluginFunc(func(e *event.Event) error { return nil }), nil
+	})
+}
+
+func TestStacksManagerReload(t *testing.T) {
+	started, stopped = 0, 0
+	dir, err := ioutil.TempDir("", "eventproc")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	dbFile := filepath.Join(dir, "events-db.json")
+	stackFile := filepath.Join(dir, "stacks.json")
+	writeFile := func(fname, data string) {
+		if err := ioutil.WriteFile(fname, []byte(data), 0644); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	writeFile(dbFile, testEvents)
+	writeFile(stackFile, fmt.Sprintf(testStacks, "next"))
+	cfg := &iconfig.EventProcCfg{
+		Stack:   iconfig.StackCfg{Files: []string{stackFile}, Main: "main"},
+		DB:      iconfig.EventDBCfg{Files: []string{dbFile}},
+		DataDir: dir,
+	}
+
+	builder, err := ifactory.StackBuilder(cfg, nil, yalogi.LogNull)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := ifactory.Stacks(cfg, builder, yalogi.LogNull); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := builder.Start(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	db, err := ifactory.EventDB(cfg, yalogi.LogNull)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	main, _ := builder.Stack("main")
+	proc := eventproc.New(main, nil, db)
+	m := &stacksManager{cfg: cfg, logger: yalogi.LogNull, builder: builder, proc: proc}
+	process := func() {
+		if _, err := proc.Process(context.Background(), event.New(10000, event.Low)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	process()
+
+	// jump to an unknown stack, previous stacks are kept
+	writeFile(stackFile, fmt.Sprintf(testStacks, "jump missing"))
+	if err := m.Reload(); err == nil {
+		t.Error("expected error reloading")
+	}
+	if m.Builder() != builder {
+		t.Error("builder replaced")
+	}
+	if inUse, _ := proc.Stacks(); inUse != main {
+		t.Error("stacks replaced")
+	}
+	if started != 2 || stopped != 1 {
+		t.Errorf("new builder not shutdown: started=%v stopped=%v", started, stopped)
+	}
+	process()
+
+	// the file of the jsonwriter is kept open by the new builder
+	writeFile(stackFile, fmt.Sprintf(testStacks, "next"))
+	if err := m.Reload(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if m.Builder() == builder {
+		t.Error("builder not replaced")
+	}
+	if started != 3 || stopped != 2 {
+		t.Errorf("previous builder not shutdown: started=%v stopped=%v", started, stopped)
+	}
+	process()
+
+	proc.Close()
+	m.Shutdown()
+	data, err := ioutil.ReadFile(filepath.Join(dir, "events.json"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if lines := bytes.Count(data, []byte("\n")); lines != 3 {
+		t.Errorf("events written mismatch: got %v; want 3", lines)
+	}
+}
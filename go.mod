@@ -3,12 +3,14 @@ module github.com/luids-io/event
 go 1.13
 
 require (
+	github.com/fsnotify/fsnotify v1.4.7
 	github.com/gofrs/uuid v3.3.0+incompatible
 	github.com/gorilla/mux v1.8.0
 	github.com/grpc-ecosystem/go-grpc-prometheus v1.2.0
 	github.com/luids-io/api v0.0.0-20201202044103-84b873ae1d6a
 	github.com/luids-io/common v0.0.0-20201020041845-ed2a021e5faa
 	github.com/luids-io/core v0.0.0-20201201052906-a54a33a9bc9d
+	github.com/prometheus/client_golang v0.9.3
 	github.com/sirupsen/logrus v1.6.0
 	github.com/spf13/pflag v1.0.5
 	github.com/spf13/viper v1.7.1
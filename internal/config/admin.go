@@ -0,0 +1,155 @@
+// Copyright 2019 Luis Guillén Civera <luisguillenc@gmail.com>. View LICENSE.
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+
+	"github.com/luids-io/common/util"
+)
+
+// AdminCfg stores admin api server preferences
+type AdminCfg struct {
+	ListenURI string
+	Allowed   []string
+	Tap       bool
+	TapBuffer int
+}
+
+// SetPFlags setups posix flags for commandline configuration
+func (cfg *AdminCfg) SetPFlags(short bool, prefix string) {
+	aprefix := ""
+	if prefix != "" {
+		aprefix = prefix + "."
+	}
+	pflag.StringVar(&cfg.ListenURI, aprefix+"listenuri", cfg.ListenURI, "Admin api socket.")
+	pflag.StringSliceVar(&cfg.Allowed, aprefix+"allowed", cfg.Allowed, "List of allowed IPs or CIDRs.")
+	pflag.BoolVar(&cfg.Tap, aprefix+"tap", cfg.Tap, "Enable live event tap.")
+	pflag.IntVar(&cfg.TapBuffer, aprefix+"tapbuffer", cfg.TapBuffer, "Default buffer size of tap subscribers.")
+}
+
+// BindViper setups posix flags for commandline configuration and bind to viper
+func (cfg *AdminCfg) BindViper(v *viper.Viper, prefix string) {
+	aprefix := ""
+	if prefix != "" {
+		aprefix = prefix + "."
+	}
+	util.BindViper(v, aprefix+"listenuri")
+	util.BindViper(v, aprefix+"allowed")
+	util.BindViper(v, aprefix+"tap")
+	util.BindViper(v, aprefix+"tapbuffer")
+}
+
+// FromViper fill values from viper
+func (cfg *AdminCfg) FromViper(v *viper.Viper, prefix string) {
+	aprefix := ""
+	if prefix != "" {
+		aprefix = prefix + "."
+	}
+	cfg.ListenURI = v.GetString(aprefix + "listenuri")
+	cfg.Allowed = v.GetStringSlice(aprefix + "allowed")
+	cfg.Tap = v.GetBool(aprefix + "tap")
+	cfg.TapBuffer = v.GetInt(aprefix + "tapbuffer")
+}
+
+// Empty returns true if configuration is empty
+func (cfg AdminCfg) Empty() bool {
+	if cfg.ListenURI != "" {
+		return false
+	}
+	if len(cfg.Allowed) > 0 {
+		return false
+	}
+	return true
+}
+
+// Validate checks that configuration is ok
+func (cfg AdminCfg) Validate() error {
+	if cfg.ListenURI == "" {
+		return errors.New("listenuri is required")
+	}
+	_, _, err := util.ParseListenURI(cfg.ListenURI)
+	if err != nil {
+		return fmt.Errorf("invalid listenuri: %v", err)
+	}
+	for _, s := range cfg.Allowed {
+		if net.ParseIP(s) != nil {
+			continue
+		}
+		if _, _, err := net.ParseCIDR(s); err != nil {
+			return fmt.Errorf("invalid allowed '%s'", s)
+		}
+	}
+	if cfg.TapBuffer < 0 {
+		return errors.New("invalid tapbuffer")
+	}
+	return nil
+}
+
+// Dump configuration
+func (cfg AdminCfg) Dump() string {
+	return fmt.Sprintf("%+v", cfg)
+}
+
+// AdminClientCfg stores admin api client preferences
+type AdminClientCfg struct {
+	URL string
+}
+
+// SetPFlags setups posix flags for commandline configuration
+func (cfg *AdminClientCfg) SetPFlags(short bool, prefix string) {
+	aprefix := ""
+	if prefix != "" {
+		aprefix = prefix + "."
+	}
+	pflag.StringVar(&cfg.URL, aprefix+"url", cfg.URL, "Admin api url.")
+}
+
+// BindViper setups posix flags for commandline configuration and bind to viper
+func (cfg *AdminClientCfg) BindViper(v *viper.Viper, prefix string) {
+	aprefix := ""
+	if prefix != "" {
+		aprefix = prefix + "."
+	}
+	util.BindViper(v, aprefix+"url")
+}
+
+// FromViper fill values from viper
+func (cfg *AdminClientCfg) FromViper(v *viper.Viper, prefix string) {
+	aprefix := ""
+	if prefix != "" {
+		aprefix = prefix + "."
+	}
+	cfg.URL = v.GetString(aprefix + "url")
+}
+
+// Empty returns true if configuration is empty
+func (cfg AdminClientCfg) Empty() bool {
+	return cfg.URL == ""
+}
+
+// Validate checks that configuration is ok
+func (cfg AdminClientCfg) Validate() error {
+	if cfg.URL == "" {
+		return errors.New("url is required")
+	}
+	u, err := url.Parse(cfg.URL)
+	if err != nil {
+		return fmt.Errorf("invalid url: %v", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("invalid url scheme '%s'", u.Scheme)
+	}
+	return nil
+}
+
+// Dump configuration
+func (cfg AdminClientCfg) Dump() string {
+	return fmt.Sprintf("%+v", cfg)
+}
@@ -0,0 +1,80 @@
+// Copyright 2019 Luis Guillén Civera <luisguillenc@gmail.com>. View LICENSE.
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+
+	"github.com/luids-io/common/util"
+	"github.com/luids-io/event/pkg/eventproc"
+)
+
+// DedupCfg defines the configuration of event deduplication
+type DedupCfg struct {
+	Window time.Duration
+	Keys   []string
+}
+
+// SetPFlags setups posix flags for commandline configuration
+func (cfg *DedupCfg) SetPFlags(short bool, prefix string) {
+	aprefix := ""
+	if prefix != "" {
+		aprefix = prefix + "."
+	}
+	pflag.DurationVar(&cfg.Window, aprefix+"window", cfg.Window, "Time window for event deduplication.")
+	pflag.StringSliceVar(&cfg.Keys, aprefix+"keys", cfg.Keys, "Event fields used as deduplication keys.")
+}
+
+// BindViper setups posix flags for commandline configuration and bind to viper
+func (cfg *DedupCfg) BindViper(v *viper.Viper, prefix string) {
+	aprefix := ""
+	if prefix != "" {
+		aprefix = prefix + "."
+	}
+	util.BindViper(v, aprefix+"window")
+	util.BindViper(v, aprefix+"keys")
+}
+
+// FromViper fill values from viper
+func (cfg *DedupCfg) FromViper(v *viper.Viper, prefix string) {
+	aprefix := ""
+	if prefix != "" {
+		aprefix = prefix + "."
+	}
+	cfg.Window = v.GetDuration(aprefix + "window")
+	cfg.Keys = v.GetStringSlice(aprefix + "keys")
+}
+
+// Empty returns true if configuration is empty
+func (cfg DedupCfg) Empty() bool {
+	if cfg.Window > 0 {
+		return false
+	}
+	if len(cfg.Keys) > 0 {
+		return false
+	}
+	return true
+}
+
+// Validate checks that configuration is ok
+func (cfg DedupCfg) Validate() error {
+	if cfg.Window <= 0 {
+		return errors.New("invalid window value")
+	}
+	for _, key := range cfg.Keys {
+		if _, err := eventproc.Field(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Dump configuration
+func (cfg DedupCfg) Dump() string {
+	return fmt.Sprintf("%+v", cfg)
+}
@@ -5,11 +5,13 @@ package config
 import (
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 
 	"github.com/luids-io/common/util"
+	"github.com/luids-io/event/pkg/eventproc"
 )
 
 // StackCfg defines the configuration of stack
@@ -25,14 +27,45 @@ type EventDBCfg struct {
 	Files []string
 }
 
+// RulesCfg defines the configuration of correlation rules
+type RulesCfg struct {
+	Dirs  []string
+	Files []string
+}
+
+// QueueCfg defines the configuration of the event queue
+type QueueCfg struct {
+	Size    int
+	Policy  string
+	Timeout time.Duration
+	Drain   time.Duration
+	Persist bool
+	// priority scheduling
+	Priority bool
+	Weights  []int
+	MaxWait  time.Duration
+}
+
+// DeadLetterCfg defines the configuration of dead-letter
+type DeadLetterCfg struct {
+	Stack string
+	Spool bool
+}
+
 // EventProcCfg defines the configuration of a processor
 type EventProcCfg struct {
-	Stack    StackCfg
-	DB       EventDBCfg
-	Workers  int
-	CertsDir string
-	DataDir  string
-	CacheDir string
+	Stack      StackCfg
+	DB         EventDBCfg
+	Queue      QueueCfg
+	Rules      RulesCfg
+	DeadLetter DeadLetterCfg
+	Workers    int
+	Forks      int
+	Watch      bool
+	Metrics    bool
+	CertsDir   string
+	DataDir    string
+	CacheDir   string
 }
 
 // SetPFlags setups posix flags for commandline configuration
@@ -51,7 +84,22 @@ func (cfg *EventProcCfg) SetPFlags(short bool, prefix string) {
 	pflag.StringVar(&cfg.Stack.Main, aprefix+"stack.main", cfg.Stack.Main, "Stack main name.")
 	pflag.StringSliceVar(&cfg.DB.Dirs, aprefix+"db.dirs", cfg.DB.Dirs, "Config event database dirs.")
 	pflag.StringSliceVar(&cfg.DB.Files, aprefix+"db.files", cfg.DB.Files, "Config event database files.")
+	pflag.StringSliceVar(&cfg.Rules.Dirs, aprefix+"rules.dirs", cfg.Rules.Dirs, "Config correlation rules dirs.")
+	pflag.StringSliceVar(&cfg.Rules.Files, aprefix+"rules.files", cfg.Rules.Files, "Config correlation rules files.")
+	pflag.IntVar(&cfg.Queue.Size, aprefix+"queue.size", cfg.Queue.Size, "Size of the event queue.")
+	pflag.StringVar(&cfg.Queue.Policy, aprefix+"queue.policy", cfg.Queue.Policy, "Policy when the queue is full: block, deadline, reject, dropoldest, droplowest.")
+	pflag.DurationVar(&cfg.Queue.Timeout, aprefix+"queue.timeout", cfg.Queue.Timeout, "Max time blocked with deadline policy.")
+	pflag.DurationVar(&cfg.Queue.Drain, aprefix+"queue.drain", cfg.Queue.Drain, "Max time draining the queue on shutdown.")
+	pflag.BoolVar(&cfg.Queue.Persist, aprefix+"queue.persist", cfg.Queue.Persist, "Persist queue in cache dir.")
+	pflag.BoolVar(&cfg.Queue.Priority, aprefix+"queue.priority", cfg.Queue.Priority, "Enable priority scheduling by level.")
+	pflag.IntSliceVar(&cfg.Queue.Weights, aprefix+"queue.weights", cfg.Queue.Weights, "Weights for levels info, low, medium, high and critical.")
+	pflag.DurationVar(&cfg.Queue.MaxWait, aprefix+"queue.maxwait", cfg.Queue.MaxWait, "Max wait in queue before an event is dequeued first.")
+	pflag.StringVar(&cfg.DeadLetter.Stack, aprefix+"deadletter.stack", cfg.DeadLetter.Stack, "Stack that processes failed events.")
+	pflag.BoolVar(&cfg.DeadLetter.Spool, aprefix+"deadletter.spool", cfg.DeadLetter.Spool, "Store failed events in data dir.")
 	pflag.IntVar(&cfg.Workers, aprefix+"workers", cfg.Workers, "Number of workers.")
+	pflag.IntVar(&cfg.Forks, aprefix+"forks", cfg.Forks, "Number of workers processing forked events.")
+	pflag.BoolVar(&cfg.Watch, aprefix+"watch", cfg.Watch, "Reload stacks and event database when files change.")
+	pflag.BoolVar(&cfg.Metrics, aprefix+"metrics", cfg.Metrics, "Enable event processor metrics.")
 	pflag.StringVar(&cfg.CertsDir, aprefix+"certsdir", cfg.CertsDir, "Path to certificate files.")
 	pflag.StringVar(&cfg.DataDir, aprefix+"datadir", cfg.DataDir, "Path to data files.")
 	pflag.StringVar(&cfg.CacheDir, aprefix+"cachedir", cfg.CacheDir, "Path to cache.")
@@ -68,7 +116,22 @@ func (cfg *EventProcCfg) BindViper(v *viper.Viper, prefix string) {
 	util.BindViper(v, aprefix+"stack.main")
 	util.BindViper(v, aprefix+"db.dirs")
 	util.BindViper(v, aprefix+"db.files")
+	util.BindViper(v, aprefix+"rules.dirs")
+	util.BindViper(v, aprefix+"rules.files")
+	util.BindViper(v, aprefix+"queue.size")
+	util.BindViper(v, aprefix+"queue.policy")
+	util.BindViper(v, aprefix+"queue.timeout")
+	util.BindViper(v, aprefix+"queue.drain")
+	util.BindViper(v, aprefix+"queue.persist")
+	util.BindViper(v, aprefix+"queue.priority")
+	util.BindViper(v, aprefix+"queue.weights")
+	util.BindViper(v, aprefix+"queue.maxwait")
+	util.BindViper(v, aprefix+"deadletter.stack")
+	util.BindViper(v, aprefix+"deadletter.spool")
 	util.BindViper(v, aprefix+"workers")
+	util.BindViper(v, aprefix+"forks")
+	util.BindViper(v, aprefix+"watch")
+	util.BindViper(v, aprefix+"metrics")
 	util.BindViper(v, aprefix+"certsdir")
 	util.BindViper(v, aprefix+"datadir")
 	util.BindViper(v, aprefix+"cachedir")
@@ -85,7 +148,22 @@ func (cfg *EventProcCfg) FromViper(v *viper.Viper, prefix string) {
 	cfg.Stack.Main = v.GetString(aprefix + "stack.main")
 	cfg.DB.Dirs = v.GetStringSlice(aprefix + "db.dirs")
 	cfg.DB.Files = v.GetStringSlice(aprefix + "db.files")
+	cfg.Rules.Dirs = v.GetStringSlice(aprefix + "rules.dirs")
+	cfg.Rules.Files = v.GetStringSlice(aprefix + "rules.files")
+	cfg.Queue.Size = v.GetInt(aprefix + "queue.size")
+	cfg.Queue.Policy = v.GetString(aprefix + "queue.policy")
+	cfg.Queue.Timeout = v.GetDuration(aprefix + "queue.timeout")
+	cfg.Queue.Drain = v.GetDuration(aprefix + "queue.drain")
+	cfg.Queue.Persist = v.GetBool(aprefix + "queue.persist")
+	cfg.Queue.Priority = v.GetBool(aprefix + "queue.priority")
+	cfg.Queue.Weights = v.GetIntSlice(aprefix + "queue.weights")
+	cfg.Queue.MaxWait = v.GetDuration(aprefix + "queue.maxwait")
+	cfg.DeadLetter.Stack = v.GetString(aprefix + "deadletter.stack")
+	cfg.DeadLetter.Spool = v.GetBool(aprefix + "deadletter.spool")
 	cfg.Workers = v.GetInt(aprefix + "workers")
+	cfg.Forks = v.GetInt(aprefix + "forks")
+	cfg.Watch = v.GetBool(aprefix + "watch")
+	cfg.Metrics = v.GetBool(aprefix + "metrics")
 	cfg.CertsDir = v.GetString(aprefix + "certsdir")
 	cfg.DataDir = v.GetString(aprefix + "datadir")
 	cfg.CacheDir = v.GetString(aprefix + "cachedir")
@@ -108,9 +186,54 @@ func (cfg EventProcCfg) Empty() bool {
 	if len(cfg.DB.Dirs) > 0 {
 		return false
 	}
+	if len(cfg.Rules.Files) > 0 {
+		return false
+	}
+	if len(cfg.Rules.Dirs) > 0 {
+		return false
+	}
+	if cfg.Queue.Size > 0 {
+		return false
+	}
+	if cfg.Queue.Policy != "" {
+		return false
+	}
+	if cfg.Queue.Timeout > 0 {
+		return false
+	}
+	if cfg.Queue.Drain > 0 {
+		return false
+	}
+	if cfg.Queue.Persist {
+		return false
+	}
+	if cfg.Queue.Priority {
+		return false
+	}
+	if len(cfg.Queue.Weights) > 0 {
+		return false
+	}
+	if cfg.Queue.MaxWait > 0 {
+		return false
+	}
+	if cfg.DeadLetter.Stack != "" {
+		return false
+	}
+	if cfg.DeadLetter.Spool {
+		return false
+	}
 	if cfg.Workers > 0 {
 		return false
 	}
+	if cfg.Forks > 0 {
+		return false
+	}
+	if cfg.Watch {
+		return false
+	}
+	if cfg.Metrics {
+		return false
+	}
 	if cfg.CertsDir != "" {
 		return false
 	}
@@ -148,9 +271,58 @@ func (cfg EventProcCfg) Validate() error {
 			return fmt.Errorf("event database dir '%v' doesn't exists", dir)
 		}
 	}
+	for _, file := range cfg.Rules.Files {
+		if !util.FileExists(file) {
+			return fmt.Errorf("correlation rules file '%v' doesn't exists", file)
+		}
+	}
+	for _, dir := range cfg.Rules.Dirs {
+		if !util.DirExists(dir) {
+			return fmt.Errorf("correlation rules dir '%v' doesn't exists", dir)
+		}
+	}
+	if cfg.Queue.Size < 0 {
+		return errors.New("invalid queue size value")
+	}
+	if cfg.Queue.Policy != "" {
+		if _, err := eventproc.ToOverflowPolicy(cfg.Queue.Policy); err != nil {
+			return err
+		}
+	}
+	if cfg.Queue.Timeout < 0 {
+		return errors.New("invalid queue timeout value")
+	}
+	if cfg.Queue.Drain < 0 {
+		return errors.New("invalid queue drain value")
+	}
+	if cfg.Queue.Persist && cfg.CacheDir == "" {
+		return errors.New("cache dir is required to persist queue")
+	}
+	if len(cfg.Queue.Weights) > 0 {
+		if len(cfg.Queue.Weights) != len(eventproc.DefaultWeights) {
+			return fmt.Errorf("queue weights must have %v values", len(eventproc.DefaultWeights))
+		}
+		for _, w := range cfg.Queue.Weights {
+			if w <= 0 {
+				return errors.New("invalid queue weights value")
+			}
+		}
+	}
+	if cfg.Queue.MaxWait < 0 {
+		return errors.New("invalid queue maxwait value")
+	}
+	if cfg.DeadLetter.Stack != "" && cfg.DeadLetter.Stack == cfg.Stack.Main {
+		return errors.New("dead-letter stack can't be the main stack")
+	}
+	if cfg.DeadLetter.Spool && cfg.DataDir == "" {
+		return errors.New("data dir is required to spool failed events")
+	}
 	if cfg.Workers < 0 {
 		return errors.New("invalid workers value")
 	}
+	if cfg.Forks < 0 {
+		return errors.New("invalid forks value")
+	}
 	if cfg.CertsDir != "" {
 		if !util.DirExists(cfg.CertsDir) {
 			return fmt.Errorf("certificates dir '%v' doesn't exists", cfg.CertsDir)
@@ -0,0 +1,92 @@
+// Copyright 2019 Luis Guillén Civera <luisguillenc@gmail.com>. View LICENSE.
+
+package config
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+
+	"github.com/luids-io/common/util"
+	"github.com/luids-io/event/pkg/eventproc"
+)
+
+// RateLimitCfg defines the configuration of the rate limits in event intake
+type RateLimitCfg struct {
+	By    []string
+	Rate  float64
+	Burst int
+}
+
+// SetPFlags setups posix flags for commandline configuration
+func (cfg *RateLimitCfg) SetPFlags(short bool, prefix string) {
+	aprefix := ""
+	if prefix != "" {
+		aprefix = prefix + "."
+	}
+	pflag.StringSliceVar(&cfg.By, aprefix+"by", cfg.By, "Rate limit keys: peer, hostname, program, source, code.")
+	pflag.Float64Var(&cfg.Rate, aprefix+"rate", cfg.Rate, "Events per second allowed for each key.")
+	pflag.IntVar(&cfg.Burst, aprefix+"burst", cfg.Burst, "Max burst of events allowed for each key.")
+}
+
+// BindViper setups posix flags for commandline configuration and bind to viper
+func (cfg *RateLimitCfg) BindViper(v *viper.Viper, prefix string) {
+	aprefix := ""
+	if prefix != "" {
+		aprefix = prefix + "."
+	}
+	util.BindViper(v, aprefix+"by")
+	util.BindViper(v, aprefix+"rate")
+	util.BindViper(v, aprefix+"burst")
+}
+
+// FromViper fill values from viper
+func (cfg *RateLimitCfg) FromViper(v *viper.Viper, prefix string) {
+	aprefix := ""
+	if prefix != "" {
+		aprefix = prefix + "."
+	}
+	cfg.By = v.GetStringSlice(aprefix + "by")
+	cfg.Rate = v.GetFloat64(aprefix + "rate")
+	cfg.Burst = v.GetInt(aprefix + "burst")
+}
+
+// Empty returns true if configuration is empty
+func (cfg RateLimitCfg) Empty() bool {
+	if len(cfg.By) > 0 {
+		return false
+	}
+	if cfg.Rate > 0 {
+		return false
+	}
+	if cfg.Burst > 0 {
+		return false
+	}
+	return true
+}
+
+// Validate checks that configuration is ok
+func (cfg RateLimitCfg) Validate() error {
+	if len(cfg.By) == 0 {
+		return errors.New("rate limit keys are required")
+	}
+	for _, key := range cfg.By {
+		if _, err := eventproc.ToRateKey(key); err != nil {
+			return err
+		}
+	}
+	if cfg.Rate <= 0 {
+		return errors.New("invalid rate value")
+	}
+	if cfg.Burst < 0 {
+		return errors.New("invalid burst value")
+	}
+	return nil
+}
+
+// Dump configuration
+func (cfg RateLimitCfg) Dump() string {
+	return fmt.Sprintf("%+v", cfg)
+}
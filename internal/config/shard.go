@@ -0,0 +1,75 @@
+// Copyright 2019 Luis Guillén Civera <luisguillenc@gmail.com>. View LICENSE.
+
+package config
+
+import (
+	"fmt"
+
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+
+	"github.com/luids-io/common/util"
+	"github.com/luids-io/event/pkg/eventproc"
+)
+
+// ShardCfg defines the configuration of sharded dispatch of events
+type ShardCfg struct {
+	Enable bool
+	Keys   []string
+}
+
+// SetPFlags setups posix flags for commandline configuration
+func (cfg *ShardCfg) SetPFlags(short bool, prefix string) {
+	aprefix := ""
+	if prefix != "" {
+		aprefix = prefix + "."
+	}
+	pflag.BoolVar(&cfg.Enable, aprefix+"enable", cfg.Enable, "Enable sharded dispatch of events to workers.")
+	pflag.StringSliceVar(&cfg.Keys, aprefix+"keys", cfg.Keys, "Event fields used as sharding keys.")
+}
+
+// BindViper setups posix flags for commandline configuration and bind to viper
+func (cfg *ShardCfg) BindViper(v *viper.Viper, prefix string) {
+	aprefix := ""
+	if prefix != "" {
+		aprefix = prefix + "."
+	}
+	util.BindViper(v, aprefix+"enable")
+	util.BindViper(v, aprefix+"keys")
+}
+
+// FromViper fill values from viper
+func (cfg *ShardCfg) FromViper(v *viper.Viper, prefix string) {
+	aprefix := ""
+	if prefix != "" {
+		aprefix = prefix + "."
+	}
+	cfg.Enable = v.GetBool(aprefix + "enable")
+	cfg.Keys = v.GetStringSlice(aprefix + "keys")
+}
+
+// Empty returns true if configuration is empty
+func (cfg ShardCfg) Empty() bool {
+	if cfg.Enable {
+		return false
+	}
+	if len(cfg.Keys) > 0 {
+		return false
+	}
+	return true
+}
+
+// Validate checks that configuration is ok
+func (cfg ShardCfg) Validate() error {
+	for _, key := range cfg.Keys {
+		if _, err := eventproc.Field(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Dump configuration
+func (cfg ShardCfg) Dump() string {
+	return fmt.Sprintf("%+v", cfg)
+}
@@ -0,0 +1,64 @@
+// Copyright 2019 Luis Guillén Civera <luisguillenc@gmail.com>. View LICENSE.
+
+package factory
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/luids-io/common/util"
+	"github.com/luids-io/core/ipfilter"
+	"github.com/luids-io/core/yalogi"
+	"github.com/luids-io/event/internal/config"
+	"github.com/luids-io/event/pkg/eventproc"
+	"github.com/luids-io/event/pkg/eventproc/admin"
+	"github.com/luids-io/event/pkg/eventproc/tap"
+)
+
+// Admin is a factory for the admin api server, extra options can be passed
+func Admin(cfg *config.AdminCfg, proc *eventproc.Processor, reload func() error, logger yalogi.Logger, extra ...admin.Option) (net.Listener, *admin.Server, error) {
+	err := cfg.Validate()
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid admin config: %v", err)
+	}
+	lis, err := util.Listener(cfg.ListenURI)
+	if err != nil {
+		return nil, nil, fmt.Errorf("listening admin: %v", err)
+	}
+	opts := []admin.Option{
+		admin.SetLogger(logger),
+		admin.Reload(reload),
+		admin.SetIPFilter(ipfilter.Whitelist(cfg.Allowed)),
+	}
+	opts = append(opts, extra...)
+	srv := admin.New(proc, opts...)
+	return lis, srv, nil
+}
+
+// Tap is a factory for the live event tap
+func Tap(cfg *config.AdminCfg, logger yalogi.Logger) *tap.Tap {
+	opts := []tap.Option{tap.SetLogger(logger)}
+	if cfg.TapBuffer > 0 {
+		opts = append(opts, tap.SetBufferSize(cfg.TapBuffer))
+	}
+	return tap.New(opts...)
+}
+
+// AdminClient is a factory for the admin api client
+func AdminClient(cfg *config.AdminClientCfg) (*admin.Client, error) {
+	err := cfg.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("invalid admin config: %v", err)
+	}
+	return admin.NewClient(cfg.URL, nil), nil
+}
+
+// TapClient is a factory for the live event tap client
+func TapClient(cfg *config.AdminClientCfg) (*tap.Client, error) {
+	err := cfg.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("invalid admin config: %v", err)
+	}
+	return tap.NewClient(strings.TrimSuffix(cfg.URL, "/")+"/tap", nil), nil
+}
@@ -0,0 +1,34 @@
+// Copyright 2019 Luis Guillén Civera <luisguillenc@gmail.com>. View LICENSE.
+
+package factory
+
+import (
+	"fmt"
+
+	"github.com/luids-io/common/util"
+	"github.com/luids-io/core/yalogi"
+	"github.com/luids-io/event/internal/config"
+	"github.com/luids-io/event/pkg/eventdb"
+	"github.com/luids-io/event/pkg/eventproc/correlation"
+)
+
+// Correlation creates a correlation engine with the rules configured
+func Correlation(cfg *config.EventProcCfg, db eventdb.Database, logger yalogi.Logger) (*correlation.Engine, error) {
+	err := cfg.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("bad config: %v", err)
+	}
+	dbfiles, err := util.GetFilesDB("json", cfg.Rules.Files, cfg.Rules.Dirs)
+	if err != nil {
+		return nil, fmt.Errorf("loading dbfiles: %v", err)
+	}
+	defs := make([]correlation.RuleDef, 0)
+	for _, file := range dbfiles {
+		entries, err := correlation.RuleDefsFromFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("couln't load rules: %v", err)
+		}
+		defs = append(defs, entries...)
+	}
+	return correlation.New(db, defs, correlation.SetLogger(logger))
+}
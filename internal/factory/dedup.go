@@ -0,0 +1,27 @@
+// Copyright 2019 Luis Guillén Civera <luisguillenc@gmail.com>. View LICENSE.
+
+package factory
+
+import (
+	"fmt"
+
+	"github.com/luids-io/event/internal/config"
+	"github.com/luids-io/event/pkg/eventproc"
+)
+
+// Dedup returns processor option for event deduplication
+func Dedup(cfg *config.DedupCfg) (eventproc.Option, error) {
+	err := cfg.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("bad config: %v", err)
+	}
+	keys := make([]eventproc.FieldGetter, 0, len(cfg.Keys))
+	for _, name := range cfg.Keys {
+		key, err := eventproc.Field(name)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return eventproc.Dedup(cfg.Window, keys...), nil
+}
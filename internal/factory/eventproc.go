@@ -4,22 +4,102 @@ package factory
 
 import (
 	"fmt"
+	"path/filepath"
 
 	"github.com/luids-io/core/yalogi"
 	"github.com/luids-io/event/internal/config"
 	"github.com/luids-io/event/pkg/eventdb"
 	"github.com/luids-io/event/pkg/eventproc"
+	"github.com/luids-io/event/pkg/eventproc/deadletter"
+	"github.com/luids-io/event/pkg/eventproc/journal"
 )
 
-// EventProc creates an event processor
-func EventProc(cfg *config.EventProcCfg, b *eventproc.Builder, db eventdb.Database, logger yalogi.Logger) (*eventproc.Processor, error) {
-	err := cfg.Validate()
+// EventProc creates an event processor, extra options can be passed
+func EventProc(cfg *config.EventProcCfg, b *eventproc.Builder, db eventdb.Database, logger yalogi.Logger, extra ...eventproc.Option) (proc *eventproc.Processor, err error) {
+	err = cfg.Validate()
 	if err != nil {
 		return nil, fmt.Errorf("bad config: %v", err)
 	}
+	main, others, err := getStacks(cfg, b)
+	if err != nil {
+		return nil, err
+	}
+	//set options
+	opts := []eventproc.Option{eventproc.SetLogger(logger)}
+	if cfg.Workers > 0 {
+		opts = append(opts, eventproc.Workers(cfg.Workers))
+	}
+	if cfg.Forks > 0 {
+		opts = append(opts, eventproc.ForkWorkers(cfg.Forks))
+	}
+	if cfg.Queue.Size > 0 {
+		opts = append(opts, eventproc.SetBufferSize(cfg.Queue.Size))
+	}
+	if cfg.Queue.Policy != "" {
+		policy, err := eventproc.ToOverflowPolicy(cfg.Queue.Policy)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, eventproc.SetOverflowPolicy(policy))
+	}
+	if cfg.Queue.Timeout > 0 {
+		opts = append(opts, eventproc.OverflowTimeout(cfg.Queue.Timeout))
+	}
+	if cfg.Queue.Priority {
+		opts = append(opts, eventproc.Priority(cfg.Queue.Weights))
+		if cfg.Queue.MaxWait > 0 {
+			opts = append(opts, eventproc.MaxWait(cfg.Queue.MaxWait))
+		}
+	}
+	if cfg.Queue.Persist {
+		var j *journal.Journal
+		j, err = journal.Open(filepath.Join(cfg.CacheDir, "queue"), journal.SetLogger(logger))
+		if err != nil {
+			return nil, fmt.Errorf("opening journal: %v", err)
+		}
+		// the journal must be closed if the processor is not created
+		defer func() {
+			if err != nil {
+				j.Close()
+			}
+		}()
+		opts = append(opts, eventproc.SetJournal(j))
+	}
+	if cfg.DeadLetter.Stack != "" || cfg.DeadLetter.Spool {
+		if cfg.DeadLetter.Stack != "" {
+			if _, ok := b.Stack(cfg.DeadLetter.Stack); !ok {
+				return nil, fmt.Errorf("can't find dead-letter stack '%s'", cfg.DeadLetter.Stack)
+			}
+		}
+		var spool eventproc.DeadLetterSpool
+		if cfg.DeadLetter.Spool {
+			s, err := deadletter.Open(filepath.Join(cfg.DataDir, "deadletter"))
+			if err != nil {
+				return nil, fmt.Errorf("opening dead-letter spool: %v", err)
+			}
+			spool = s
+		}
+		opts = append(opts, eventproc.DeadLetter(cfg.DeadLetter.Stack, spool))
+	}
+	opts = append(opts, extra...)
+	//creates a new processor with stacks
+	proc = eventproc.New(main, others, db, opts...)
+	return proc, nil
+}
+
+// ReloadEventProc replaces the stacks and the event database of the processor
+func ReloadEventProc(cfg *config.EventProcCfg, proc *eventproc.Processor, b *eventproc.Builder, db eventdb.Database) error {
+	main, others, err := getStacks(cfg, b)
+	if err != nil {
+		return err
+	}
+	return proc.Reload(main, others, db)
+}
+
+func getStacks(cfg *config.EventProcCfg, b *eventproc.Builder) (*eventproc.Stack, []*eventproc.Stack, error) {
 	main, ok := b.Stack(cfg.Stack.Main)
 	if !ok {
-		return nil, fmt.Errorf("can't find main stack '%s'", cfg.Stack.Main)
+		return nil, nil, fmt.Errorf("can't find main stack '%s'", cfg.Stack.Main)
 	}
 	names := b.StackNames()
 	others := make([]*eventproc.Stack, 0, len(names)-1)
@@ -29,7 +109,5 @@ func EventProc(cfg *config.EventProcCfg, b *eventproc.Builder, db eventdb.Databa
 			others = append(others, stack)
 		}
 	}
-	//creates a new processor with stacks
-	processor := eventproc.New(main, others, db, eventproc.SetLogger(logger))
-	return processor, nil
+	return main, others, nil
 }
@@ -0,0 +1,27 @@
+// Copyright 2019 Luis Guillén Civera <luisguillenc@gmail.com>. View LICENSE.
+
+package factory
+
+import (
+	"fmt"
+
+	"github.com/luids-io/event/internal/config"
+	"github.com/luids-io/event/pkg/eventproc"
+)
+
+// RateLimits returns processor options for rate limits
+func RateLimits(cfg *config.RateLimitCfg) ([]eventproc.Option, error) {
+	err := cfg.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("bad config: %v", err)
+	}
+	opts := make([]eventproc.Option, 0, len(cfg.By))
+	for _, by := range cfg.By {
+		key, err := eventproc.ToRateKey(by)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, eventproc.RateLimit(key, cfg.Rate, cfg.Burst))
+	}
+	return opts, nil
+}
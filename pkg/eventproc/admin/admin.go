@@ -0,0 +1,52 @@
+// Copyright 2019 Luis Guillén Civera <luisguillenc@gmail.com>. View LICENSE.
+
+// Package admin implements an http api for the administration of the event
+// processor at runtime and a client for it.
+//
+// This package is a work in progress and makes no API stability promises.
+package admin
+
+import (
+	"github.com/luids-io/event/pkg/eventproc"
+)
+
+// StackInfo describes a stack in use.
+type StackInfo struct {
+	Name    string       `json:"name"`
+	Main    bool         `json:"main"`
+	Modules []ModuleInfo `json:"modules"`
+}
+
+// ModuleInfo describes a module of a stack.
+type ModuleInfo struct {
+	Name      string                `json:"name"`
+	Filters   []string              `json:"filters,omitempty"`
+	Plugins   []string              `json:"plugins,omitempty"`
+	OnSuccess eventproc.StackAction `json:"onsuccess"`
+	OnError   eventproc.StackAction `json:"onerror"`
+	Timeout   eventproc.Duration    `json:"timeout,omitempty"`
+	Disabled  bool                  `json:"disabled"`
+	Panics    int                   `json:"panics"`
+}
+
+// errorResponse is returned by the api when there is an error.
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func stackInfo(s *eventproc.Stack, main bool) StackInfo {
+	info := StackInfo{Name: s.Name(), Main: main, Modules: []ModuleInfo{}}
+	for _, m := range s.Modules() {
+		info.Modules = append(info.Modules, ModuleInfo{
+			Name:      m.Name,
+			Filters:   m.FilterClasses,
+			Plugins:   m.PluginClasses,
+			OnSuccess: m.OnSuccess,
+			OnError:   m.OnError,
+			Timeout:   eventproc.Duration(m.Timeout),
+			Disabled:  m.Disabled(),
+			Panics:    m.Panics(),
+		})
+	}
+	return info
+}
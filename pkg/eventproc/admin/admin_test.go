@@ -0,0 +1,109 @@
+// Copyright 2019 Luis Guillén Civera <luisguillenc@gmail.com>. See LICENSE.
+
+package admin_test
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/luids-io/api/event"
+	"github.com/luids-io/event/pkg/eventdb"
+	"github.com/luids-io/event/pkg/eventproc"
+	"github.com/luids-io/event/pkg/eventproc/admin"
+)
+
+func TestAdmin(t *testing.T) {
+	count := 0
+	main := eventproc.NewStack("main")
+	main.Add(&eventproc.Module{
+		Name: "count",
+		Plugins: []eventproc.ModulePlugin{eventproc.PluginFunc(func(e *event.Event) error {
+			count++
+			return nil
+		})},
+		PluginClasses: []string{"counter"},
+	})
+	other := eventproc.NewStack("other")
+	db := eventdb.New([]eventdb.EventDef{{Code: 1, Type: event.Security}})
+	p := eventproc.New(main, []*eventproc.Stack{other}, db, eventproc.Workers(1))
+	defer p.Close()
+
+	reloaded := false
+	srv := admin.New(p, admin.Reload(func() error {
+		if reloaded {
+			return errors.New("already reloaded")
+		}
+		reloaded = true
+		return nil
+	}))
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+	client := admin.NewClient(ts.URL, ts.Client())
+	ctx := context.Background()
+
+	// stacks
+	stacks, err := client.Stacks(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(stacks) != 2 || !stacks[0].Main || stacks[0].Name != "main" || stacks[1].Name != "other" {
+		t.Fatalf("stacks mismatch: %+v", stacks)
+	}
+	if len(stacks[0].Modules) != 1 || stacks[0].Modules[0].Plugins[0] != "counter" {
+		t.Errorf("modules mismatch: %+v", stacks[0].Modules)
+	}
+	if _, err := client.Stack(ctx, "notfound"); err == nil {
+		t.Error("expected error")
+	}
+	// disable module
+	stack, err := client.SetModuleDisabled(ctx, "main", "count", true)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !stack.Modules[0].Disabled {
+		t.Error("module not disabled")
+	}
+	p.Process(ctx, event.New(1, event.Low))
+	if count != 0 {
+		t.Errorf("disabled module executed")
+	}
+	if _, err := client.SetModuleDisabled(ctx, "main", "count", false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	p.Process(ctx, event.New(1, event.Low))
+	if count != 1 {
+		t.Errorf("enabled module not executed")
+	}
+	if _, err := client.SetModuleDisabled(ctx, "main", "notfound", true); err == nil {
+		t.Error("expected error")
+	}
+	// pause and resume
+	stats, err := client.Pause(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !stats.Paused || stats.Workers != 1 {
+		t.Errorf("stats mismatch: %+v", stats)
+	}
+	p.NotifyEvent(ctx, event.New(1, event.Low))
+	stats, _ = client.Stats(ctx)
+	if stats.Queued != 1 {
+		t.Errorf("queued mismatch exp=1 got=%v", stats.Queued)
+	}
+	stats, err = client.Resume(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if stats.Paused {
+		t.Error("processor paused")
+	}
+	// reload
+	if _, err := client.Reload(ctx); err != nil || !reloaded {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if _, err := client.Reload(ctx); err == nil || err.Error() != "admin: already reloaded" {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,105 @@
+// Copyright 2019 Luis Guillén Civera <luisguillenc@gmail.com>. View LICENSE.
+
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/luids-io/event/pkg/eventproc"
+)
+
+// Client is a client for the administration api.
+type Client struct {
+	baseURL string
+	hc      *http.Client
+}
+
+// NewClient returns a client for the api in the url passed. If hc is nil,
+// http.DefaultClient will be used.
+func NewClient(baseURL string, hc *http.Client) *Client {
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	return &Client{baseURL: strings.TrimSuffix(baseURL, "/"), hc: hc}
+}
+
+// Stats returns the statistics of the processor.
+func (c *Client) Stats(ctx context.Context) (eventproc.Stats, error) {
+	var stats eventproc.Stats
+	err := c.do(ctx, "GET", "/stats", &stats)
+	return stats, err
+}
+
+// Stacks returns the stacks in use.
+func (c *Client) Stacks(ctx context.Context) ([]StackInfo, error) {
+	var stacks []StackInfo
+	err := c.do(ctx, "GET", "/stacks", &stacks)
+	return stacks, err
+}
+
+// Stack returns the stack in use with the name passed.
+func (c *Client) Stack(ctx context.Context, name string) (StackInfo, error) {
+	var stack StackInfo
+	err := c.do(ctx, "GET", "/stacks/"+url.PathEscape(name), &stack)
+	return stack, err
+}
+
+// SetModuleDisabled disables or enables a module. The change is lost when the
+// stacks are reloaded. Modules disabled in the configuration are not built,
+// so they are not found.
+func (c *Client) SetModuleDisabled(ctx context.Context, stack, module string, disabled bool) (StackInfo, error) {
+	action := "enable"
+	if disabled {
+		action = "disable"
+	}
+	var info StackInfo
+	path := fmt.Sprintf("/stacks/%s/modules/%s/%s", url.PathEscape(stack), url.PathEscape(module), action)
+	err := c.do(ctx, "POST", path, &info)
+	return info, err
+}
+
+// Pause the processing of events.
+func (c *Client) Pause(ctx context.Context) (eventproc.Stats, error) {
+	var stats eventproc.Stats
+	err := c.do(ctx, "POST", "/pause", &stats)
+	return stats, err
+}
+
+// Resume the processing of events.
+func (c *Client) Resume(ctx context.Context) (eventproc.Stats, error) {
+	var stats eventproc.Stats
+	err := c.do(ctx, "POST", "/resume", &stats)
+	return stats, err
+}
+
+// Reload stacks and event database.
+func (c *Client) Reload(ctx context.Context) (eventproc.Stats, error) {
+	var stats eventproc.Stats
+	err := c.do(ctx, "POST", "/reload", &stats)
+	return stats, err
+}
+
+func (c *Client) do(ctx context.Context, method, path string, v interface{}) error {
+	req, err := http.NewRequest(method, c.baseURL+path, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.hc.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var e errorResponse
+		if err := json.NewDecoder(resp.Body).Decode(&e); err != nil || e.Error == "" {
+			return fmt.Errorf("admin: %s", resp.Status)
+		}
+		return fmt.Errorf("admin: %s", e.Error)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
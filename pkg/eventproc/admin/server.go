@@ -0,0 +1,213 @@
+// Copyright 2019 Luis Guillén Civera <luisguillenc@gmail.com>. View LICENSE.
+
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/luids-io/core/ipfilter"
+	"github.com/luids-io/core/yalogi"
+	"github.com/luids-io/event/pkg/eventproc"
+)
+
+// Option encapsules server options.
+type Option func(*options)
+
+type options struct {
+	logger   yalogi.Logger
+	ipfilter ipfilter.Filter
+	reload   func() error
+	tap      http.Handler
+}
+
+var defaultOptions = options{logger: yalogi.LogNull}
+
+// SetLogger option sets a logger for the component.
+func SetLogger(l yalogi.Logger) Option {
+	return func(o *options) {
+		o.logger = l
+	}
+}
+
+// SetIPFilter option sets an ip filter.
+func SetIPFilter(f ipfilter.Filter) Option {
+	return func(o *options) {
+		o.ipfilter = f
+	}
+}
+
+// Reload option sets the function called to reload the processor.
+func Reload(fn func() error) Option {
+	return func(o *options) {
+		o.reload = fn
+	}
+}
+
+// Tap option sets the handler used to stream the events processed.
+func Tap(h http.Handler) Option {
+	return func(o *options) {
+		o.tap = h
+	}
+}
+
+// Server is an http server that provides the administration api.
+// It must be constructed using New.
+type Server struct {
+	opts   options
+	logger yalogi.Logger
+	server *http.Server
+	proc   *eventproc.Processor
+}
+
+// New constructs a new server that administrates the processor.
+func New(proc *eventproc.Processor, opt ...Option) *Server {
+	opts := defaultOptions
+	for _, o := range opt {
+		o(&opts)
+	}
+	return &Server{
+		opts:   opts,
+		logger: opts.logger,
+		server: &http.Server{},
+		proc:   proc,
+	}
+}
+
+// Serve http.
+func (s *Server) Serve(lis net.Listener) error {
+	s.logger.Infof("starting admin server %v", lis.Addr().String())
+	s.server.Handler = s.Handler()
+	return s.server.Serve(lis)
+}
+
+// Close immediately server. See http.Server doc.
+func (s *Server) Close() error {
+	s.logger.Infof("closing admin server")
+	return s.server.Close()
+}
+
+// Shutdown waits all pending operations to shutdown. See http.Server doc.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.logger.Infof("shutting down admin server")
+	return s.server.Shutdown(ctx)
+}
+
+// Handler returns the http handler of the api.
+func (s *Server) Handler() http.Handler {
+	router := mux.NewRouter()
+	router.HandleFunc("/stats", s.doStats).Methods("GET")
+	router.HandleFunc("/stacks", s.doStacks).Methods("GET")
+	router.HandleFunc("/stacks/{stack}", s.doStack).Methods("GET")
+	router.HandleFunc("/stacks/{stack}/modules/{module}/disable", s.doModule(true)).Methods("POST")
+	router.HandleFunc("/stacks/{stack}/modules/{module}/enable", s.doModule(false)).Methods("POST")
+	router.HandleFunc("/pause", s.doPause).Methods("POST")
+	router.HandleFunc("/resume", s.doResume).Methods("POST")
+	router.HandleFunc("/reload", s.doReload).Methods("POST")
+	if s.opts.tap != nil {
+		router.Handle("/tap", s.opts.tap).Methods("GET")
+	}
+
+	if !s.opts.ipfilter.Empty() {
+		filtered := s.opts.ipfilter
+		filtered.Wrapped = router
+		return filtered
+	}
+	return router
+}
+
+func (s *Server) doStats(w http.ResponseWriter, r *http.Request) {
+	s.reply(w, r, http.StatusOK, s.proc.Stats())
+}
+
+func (s *Server) doStacks(w http.ResponseWriter, r *http.Request) {
+	main, others := s.proc.Stacks()
+	stacks := make([]StackInfo, 0, len(others)+1)
+	stacks = append(stacks, stackInfo(main, true))
+	for _, stack := range others {
+		stacks = append(stacks, stackInfo(stack, false))
+	}
+	s.reply(w, r, http.StatusOK, stacks)
+}
+
+func (s *Server) doStack(w http.ResponseWriter, r *http.Request) {
+	stack, main, ok := s.stack(mux.Vars(r)["stack"])
+	if !ok {
+		s.fail(w, r, http.StatusNotFound, errors.New("stack not found"))
+		return
+	}
+	s.reply(w, r, http.StatusOK, stackInfo(stack, main))
+}
+
+func (s *Server) doModule(disable bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		stack, main, ok := s.stack(vars["stack"])
+		if !ok {
+			s.fail(w, r, http.StatusNotFound, errors.New("stack not found"))
+			return
+		}
+		module, ok := stack.Module(vars["module"])
+		if !ok {
+			s.fail(w, r, http.StatusNotFound, errors.New("module not found"))
+			return
+		}
+		module.SetDisabled(disable)
+		s.logger.Infof("admin: module '%s.%s' disabled=%v", stack.Name(), module.Name, disable)
+		s.reply(w, r, http.StatusOK, stackInfo(stack, main))
+	}
+}
+
+func (s *Server) doPause(w http.ResponseWriter, r *http.Request) {
+	s.proc.Pause()
+	s.reply(w, r, http.StatusOK, s.proc.Stats())
+}
+
+func (s *Server) doResume(w http.ResponseWriter, r *http.Request) {
+	s.proc.Resume()
+	s.reply(w, r, http.StatusOK, s.proc.Stats())
+}
+
+func (s *Server) doReload(w http.ResponseWriter, r *http.Request) {
+	if s.opts.reload == nil {
+		s.fail(w, r, http.StatusNotImplemented, errors.New("reload not available"))
+		return
+	}
+	if err := s.opts.reload(); err != nil {
+		s.fail(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	s.reply(w, r, http.StatusOK, s.proc.Stats())
+}
+
+// stack returns the stack in use with the name passed.
+func (s *Server) stack(name string) (stack *eventproc.Stack, main bool, ok bool) {
+	mainStack, others := s.proc.Stacks()
+	if mainStack.Name() == name {
+		return mainStack, true, true
+	}
+	for _, stack := range others {
+		if stack.Name() == name {
+			return stack, false, true
+		}
+	}
+	return nil, false, false
+}
+
+func (s *Server) reply(w http.ResponseWriter, r *http.Request, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		s.logger.Warnf("admin: %s %s from %s: %v", r.Method, r.URL.Path, r.RemoteAddr, err)
+	}
+}
+
+func (s *Server) fail(w http.ResponseWriter, r *http.Request, code int, err error) {
+	s.logger.Debugf("admin: %s %s from %s: %v", r.Method, r.URL.Path, r.RemoteAddr, err)
+	s.reply(w, r, code, errorResponse{Error: err.Error()})
+}
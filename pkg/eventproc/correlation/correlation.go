@@ -0,0 +1,329 @@
+// Copyright 2019 Luis Guillén Civera <luisguillenc@gmail.com>. View LICENSE.
+
+// Package correlation implements rules that correlate the events processed by
+// the event processor and raise new derived events.
+//
+// This package is a work in progress and makes no API stability promises.
+package correlation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/luids-io/api/event"
+	"github.com/luids-io/core/yalogi"
+	"github.com/luids-io/event/pkg/eventdb"
+	"github.com/luids-io/event/pkg/eventproc"
+)
+
+// Engine correlates the events observed using rules. When a rule matches, a
+// new event is raised and notified.
+type Engine struct {
+	opts   options
+	logger yalogi.Logger
+	rules  []rule
+
+	mu       sync.Mutex
+	notifier event.Notifier
+	raised   chan event.Event
+	started  bool
+	closed   bool
+	wg       sync.WaitGroup
+}
+
+// Clock returns the current time.
+type Clock func() time.Time
+
+// Option is used for engine configuration.
+type Option func(*options)
+
+type options struct {
+	logger   yalogi.Logger
+	clock    Clock
+	buffSize int
+}
+
+var defaultOptions = options{
+	logger:   yalogi.LogNull,
+	clock:    time.Now,
+	buffSize: 100,
+}
+
+// SetLogger option sets a logger for the component.
+func SetLogger(l yalogi.Logger) Option {
+	return func(o *options) {
+		o.logger = l
+	}
+}
+
+// SetClock option sets the clock used to compute the windows of the rules.
+func SetClock(c Clock) Option {
+	return func(o *options) {
+		if c != nil {
+			o.clock = c
+		}
+	}
+}
+
+// SetBufferSize option defines the size of the buffer of raised events.
+func SetBufferSize(n int) Option {
+	return func(o *options) {
+		if n > 0 {
+			o.buffSize = n
+		}
+	}
+}
+
+// New creates a new engine with the rules passed. Raised events are validated
+// against the database.
+func New(db eventdb.Database, defs []RuleDef, opt ...Option) (*Engine, error) {
+	opts := defaultOptions
+	for _, o := range opt {
+		o(&opts)
+	}
+	c := &Engine{
+		opts:   opts,
+		logger: opts.logger,
+		rules:  make([]rule, 0, len(defs)),
+		raised: make(chan event.Event, opts.buffSize),
+	}
+	names := make(map[string]bool, len(defs))
+	for _, def := range defs {
+		if def.Disabled {
+			continue
+		}
+		if def.Name == "" {
+			return nil, errors.New("rule name is empty")
+		}
+		if names[def.Name] {
+			return nil, fmt.Errorf("rule '%s' is duplicated", def.Name)
+		}
+		names[def.Name] = true
+		r, err := buildRule(db, def)
+		if err != nil {
+			return nil, fmt.Errorf("creating rule '%s': %v", def.Name, err)
+		}
+		c.rules = append(c.rules, r)
+	}
+	return c, nil
+}
+
+// Hooks registers the engine in the hooks of the processor.
+func (c *Engine) Hooks(h *eventproc.Hooks) {
+	h.AfterProc(c.Observe)
+}
+
+// Observe correlates the event of the request. Events dropped by policy
+// hooks are ignored.
+func (c *Engine) Observe(r *eventproc.Request) {
+	if r.Verdict.Action == eventproc.VerdictDrop {
+		return
+	}
+	now := c.opts.clock()
+	for _, rule := range c.rules {
+		if e, ok := rule.observe(now, &r.Event); ok {
+			c.raise(rule.name(), e)
+		}
+	}
+}
+
+// Start notifies the raised events using the notifier passed.
+func (c *Engine) Start(n event.Notifier) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return errors.New("correlation: engine closed")
+	}
+	if c.started {
+		return errors.New("correlation: engine started")
+	}
+	c.started = true
+	c.notifier = n
+	c.wg.Add(1)
+	go c.notify()
+	return nil
+}
+
+// Close stops the engine, raised events pending of notify are notified.
+func (c *Engine) Close() {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return
+	}
+	c.closed = true
+	close(c.raised)
+	c.mu.Unlock()
+	c.wg.Wait()
+}
+
+func (c *Engine) raise(name string, e event.Event) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		c.logger.Warnf("correlation: [rule=%s] engine closed, event %v discarded", name, e.Code)
+		return
+	}
+	select {
+	case c.raised <- e:
+	default:
+		c.logger.Warnf("correlation: [rule=%s] buffer full, event %v discarded", name, e.Code)
+	}
+}
+
+// notify runs in its own goroutine, so workers of the processor are never
+// blocked notifying the raised events.
+func (c *Engine) notify() {
+	defer c.wg.Done()
+	for e := range c.raised {
+		id, err := c.notifier.NotifyEvent(context.Background(), e)
+		if err != nil {
+			c.logger.Warnf("correlation: notifying event %v: %v", e.Code, err)
+			continue
+		}
+		c.logger.Debugf("correlation: raised event %v with id %s", e.Code, id)
+	}
+}
+
+type rule interface {
+	name() string
+	observe(now time.Time, e *event.Event) (event.Event, bool)
+}
+
+func buildRule(db eventdb.Database, def RuleDef) (rule, error) {
+	r, err := buildRaiser(db, def.Raise)
+	if err != nil {
+		return nil, err
+	}
+	switch def.Type {
+	case ThresholdRule:
+		return newThreshold(def, r)
+	case SequenceRule:
+		return newSequence(def, r)
+	}
+	return nil, fmt.Errorf("invalid rule type '%s'", def.Type)
+}
+
+// raiser creates the derived events.
+type raiser struct {
+	code   event.Code
+	level  event.Level
+	fields map[string]eventproc.FieldGetter
+	count  string
+	refs   string
+}
+
+func buildRaiser(db eventdb.Database, def RaiseDef) (*raiser, error) {
+	edef, ok := db.FindByCode(def.Code)
+	if !ok {
+		return nil, fmt.Errorf("raise code '%v' not found", def.Code)
+	}
+	level, raise, err := event.ToEventLevel(def.Level)
+	if err != nil {
+		return nil, err
+	}
+	if !raise {
+		return nil, errors.New("raise level is required")
+	}
+	r := &raiser{
+		code:   def.Code,
+		level:  level,
+		fields: make(map[string]eventproc.FieldGetter, len(def.Fields)),
+		count:  def.Count,
+		refs:   def.Refs,
+	}
+	metas := make(map[string]eventdb.FieldDef, len(edef.Fields))
+	for _, f := range edef.Fields {
+		metas[f.Name] = f
+	}
+	provided := make(map[string]bool)
+	for name, from := range def.Fields {
+		getter, err := eventproc.Field(from)
+		if err != nil {
+			return nil, err
+		}
+		r.fields[name] = getter
+		provided[name] = true
+	}
+	if def.Count != "" {
+		provided[def.Count] = true
+		if md, ok := metas[def.Count]; ok && md.Type != "" && md.Type != "int" {
+			return nil, fmt.Errorf("data field '%s' must be int", def.Count)
+		}
+	}
+	if def.Refs != "" {
+		provided[def.Refs] = true
+	}
+	for name := range provided {
+		if _, ok := metas[name]; !ok {
+			return nil, fmt.Errorf("data field '%s' undefined in raise code '%v'", name, def.Code)
+		}
+	}
+	for name, md := range metas {
+		if md.Required && !provided[name] {
+			return nil, fmt.Errorf("data field '%s' is required in raise code '%v'", name, def.Code)
+		}
+	}
+	return r, nil
+}
+
+// derive returns a new event using the data of the trigger event and the
+// references to the events passed.
+func (r *raiser) derive(trigger *event.Event, refs []string) event.Event {
+	e := event.New(r.code, r.level)
+	for name, getter := range r.fields {
+		if v, ok := getter(trigger); ok {
+			e.Data[name] = dataValue(v)
+		}
+	}
+	if r.count != "" {
+		e.Data[r.count] = len(refs)
+	}
+	if r.refs != "" {
+		e.Data[r.refs] = refs
+	}
+	return e
+}
+
+// dataValue converts values to the types used in event data.
+func dataValue(v interface{}) interface{} {
+	switch t := v.(type) {
+	case event.Code:
+		return int(t)
+	case event.Level:
+		return t.String()
+	case event.Type:
+		return t.String()
+	}
+	return v
+}
+
+func fieldGetters(names []string) ([]eventproc.FieldGetter, error) {
+	getters := make([]eventproc.FieldGetter, 0, len(names))
+	for _, name := range names {
+		getter, err := eventproc.Field(name)
+		if err != nil {
+			return nil, err
+		}
+		getters = append(getters, getter)
+	}
+	return getters, nil
+}
+
+// groupKey returns the values of the fields, it returns false if any of the
+// fields is not set.
+func groupKey(fields []eventproc.FieldGetter, e *event.Event) (string, bool) {
+	values := make([]string, 0, len(fields))
+	for _, field := range fields {
+		v, ok := field(e)
+		if !ok {
+			return "", false
+		}
+		values = append(values, fmt.Sprintf("%v", v))
+	}
+	return strings.Join(values, "\x00"), true
+}
@@ -0,0 +1,224 @@
+// Copyright 2019 Luis Guillén Civera <luisguillenc@gmail.com>. See LICENSE.
+
+package correlation_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/luids-io/api/event"
+	"github.com/luids-io/event/pkg/eventdb"
+	"github.com/luids-io/event/pkg/eventproc"
+	"github.com/luids-io/event/pkg/eventproc/correlation"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) Add(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+type notifier struct {
+	mu     sync.Mutex
+	events []event.Event
+}
+
+func (n *notifier) NotifyEvent(ctx context.Context, e event.Event) (string, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.events = append(n.events, e)
+	return fmt.Sprintf("raised%v", len(n.events)), nil
+}
+
+var testDB = eventdb.New([]eventdb.EventDef{
+	{Code: 100, Codename: "login.failed", Fields: []eventdb.FieldDef{
+		{Name: "user", Type: "string"},
+	}},
+	{Code: 200, Codename: "login.bruteforce", Fields: []eventdb.FieldDef{
+		{Name: "user", Type: "string", Required: true},
+		{Name: "attempts", Type: "int"},
+		{Name: "refs"},
+	}},
+	{Code: 300, Codename: "session.opened"},
+	{Code: 400, Codename: "dns.blacklisted", Fields: []eventdb.FieldDef{
+		{Name: "client", Type: "string"},
+	}},
+	{Code: 500, Codename: "transfer.large"},
+	{Code: 600, Codename: "exfiltration", Fields: []eventdb.FieldDef{
+		{Name: "host", Type: "string", Required: true},
+		{Name: "refs"},
+	}},
+})
+
+func request(code event.Code, id, host, user string) *eventproc.Request {
+	e := event.New(code, event.Low)
+	e.ID = id
+	e.Source.Hostname = host
+	if user != "" {
+		e.Data["user"] = user
+	}
+	return &eventproc.Request{Event: e}
+}
+
+func TestThreshold(t *testing.T) {
+	clock := &fakeClock{now: time.Now()}
+	engine, err := correlation.New(testDB, []correlation.RuleDef{{
+		Name:      "bruteforce",
+		Type:      correlation.ThresholdRule,
+		Code:      100,
+		GroupBy:   []string{"source.hostname", "data.user"},
+		Threshold: 3,
+		Window:    eventproc.Duration(time.Minute),
+		Raise: correlation.RaiseDef{
+			Code:   200,
+			Level:  "high",
+			Fields: map[string]string{"user": "data.user"},
+			Count:  "attempts",
+			Refs:   "refs",
+		},
+	}}, correlation.SetClock(clock.Now))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	n := &notifier{}
+	engine.Start(n)
+
+	engine.Observe(request(100, "1", "host1", "root"))
+	clock.Add(50 * time.Second)
+	engine.Observe(request(100, "2", "host1", "root"))
+	// other groups and codes are not counted
+	engine.Observe(request(100, "3", "host2", "root"))
+	engine.Observe(request(100, "4", "host1", "admin"))
+	engine.Observe(request(100, "5", "host1", ""))
+	engine.Observe(request(300, "6", "host1", "root"))
+	// first event is out of the window
+	clock.Add(20 * time.Second)
+	engine.Observe(request(100, "7", "host1", "root"))
+	engine.Observe(request(100, "8", "host1", "root"))
+	// counter is reset after raise
+	engine.Observe(request(100, "9", "host1", "root"))
+	engine.Close()
+
+	if len(n.events) != 1 {
+		t.Fatalf("raised events mismatch: %v", len(n.events))
+	}
+	e := n.events[0]
+	if e.Code != 200 || e.Level != event.High {
+		t.Errorf("raised event mismatch: %v", e)
+	}
+	if e.Data["user"] != "root" || e.Data["attempts"] != 3 {
+		t.Errorf("raised data mismatch: %v", e.Data)
+	}
+	refs, _ := e.Data["refs"].([]string)
+	if fmt.Sprintf("%v", refs) != "[2 7 8]" {
+		t.Errorf("raised refs mismatch: %v", refs)
+	}
+	def, _ := testDB.FindByCode(200)
+	if err := def.ValidateData(e); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestSequence(t *testing.T) {
+	clock := &fakeClock{now: time.Now()}
+	engine, err := correlation.New(testDB, []correlation.RuleDef{{
+		Name:    "exfiltration",
+		Type:    correlation.SequenceRule,
+		GroupBy: []string{"source.hostname"},
+		Steps: []correlation.StepDef{
+			{Code: 400, GroupBy: []string{"data.client"}},
+			{Code: 500},
+		},
+		Window: eventproc.Duration(5 * time.Minute),
+		Raise: correlation.RaiseDef{
+			Code:   600,
+			Level:  "critical",
+			Fields: map[string]string{"host": "source.hostname"},
+			Refs:   "refs",
+		},
+	}}, correlation.SetClock(clock.Now))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	n := &notifier{}
+	engine.Start(n)
+
+	dnshit := func(id, client string) *eventproc.Request {
+		r := request(400, id, "dnsserver", "")
+		r.Event.Data["client"] = client
+		return r
+	}
+	// out of order and other hosts are ignored
+	engine.Observe(request(500, "1", "host1", ""))
+	engine.Observe(dnshit("2", "host1"))
+	engine.Observe(request(500, "3", "host2", ""))
+	// state expires
+	clock.Add(6 * time.Minute)
+	engine.Observe(request(500, "4", "host1", ""))
+	// sequence is restarted by the last first step
+	engine.Observe(dnshit("5", "host1"))
+	clock.Add(4 * time.Minute)
+	engine.Observe(dnshit("6", "host1"))
+	clock.Add(4 * time.Minute)
+	engine.Observe(request(500, "7", "host1", ""))
+	// sequence is completed only once
+	engine.Observe(request(500, "8", "host1", ""))
+	engine.Close()
+
+	if len(n.events) != 1 {
+		t.Fatalf("raised events mismatch: %v", len(n.events))
+	}
+	e := n.events[0]
+	if e.Code != 600 || e.Level != event.Critical || e.Data["host"] != "host1" {
+		t.Errorf("raised event mismatch: %v", e)
+	}
+	refs, _ := e.Data["refs"].([]string)
+	if fmt.Sprintf("%v", refs) != "[6 7]" {
+		t.Errorf("raised refs mismatch: %v", refs)
+	}
+}
+
+func TestBadRules(t *testing.T) {
+	var tests = []struct {
+		name string
+		def  correlation.RuleDef
+	}{
+		{"badtype", correlation.RuleDef{Type: "unknown"}},
+		{"badraise", correlation.RuleDef{Type: correlation.ThresholdRule, Code: 100,
+			Threshold: 1, Window: eventproc.Duration(time.Second),
+			Raise: correlation.RaiseDef{Code: 999, Level: "low"}}},
+		{"required", correlation.RuleDef{Type: correlation.ThresholdRule, Code: 100,
+			Threshold: 1, Window: eventproc.Duration(time.Second),
+			Raise: correlation.RaiseDef{Code: 200, Level: "low"}}},
+		{"undefined", correlation.RuleDef{Type: correlation.ThresholdRule, Code: 100,
+			Threshold: 1, Window: eventproc.Duration(time.Second),
+			Raise: correlation.RaiseDef{Code: 200, Level: "low", Count: "other",
+				Fields: map[string]string{"user": "data.user"}}}},
+		{"nowindow", correlation.RuleDef{Type: correlation.ThresholdRule, Code: 100,
+			Threshold: 1, Raise: correlation.RaiseDef{Code: 300, Level: "low"}}},
+		{"onestep", correlation.RuleDef{Type: correlation.SequenceRule,
+			Steps: []correlation.StepDef{{Code: 400}}, Window: eventproc.Duration(time.Second),
+			Raise: correlation.RaiseDef{Code: 300, Level: "low"}}},
+		{"stepgroup", correlation.RuleDef{Type: correlation.SequenceRule,
+			GroupBy: []string{"source.hostname"},
+			Steps:   []correlation.StepDef{{Code: 400, GroupBy: []string{"data.client", "code"}}, {Code: 500}},
+			Window:  eventproc.Duration(time.Second),
+			Raise:   correlation.RaiseDef{Code: 300, Level: "low"}}},
+	}
+	for _, test := range tests {
+		test.def.Name = test.name
+		_, err := correlation.New(testDB, []correlation.RuleDef{test.def})
+		if err == nil {
+			t.Errorf("%s: expected error", test.name)
+		}
+	}
+}
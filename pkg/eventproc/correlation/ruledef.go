@@ -0,0 +1,77 @@
+// Copyright 2019 Luis Guillén Civera <luisguillenc@gmail.com>. View LICENSE.
+
+package correlation
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/luids-io/api/event"
+	"github.com/luids-io/event/pkg/eventproc"
+)
+
+// Rule types.
+const (
+	ThresholdRule = "threshold"
+	SequenceRule  = "sequence"
+)
+
+// RuleDef defines a correlation rule.
+type RuleDef struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Disabled bool   `json:"disabled"`
+	// Code of the events correlated by threshold rules.
+	Code event.Code `json:"code,omitempty"`
+	// GroupBy fields used to group the events.
+	GroupBy []string `json:"groupby,omitempty"`
+	// Threshold is the number of events that raises the derived event.
+	Threshold int `json:"threshold,omitempty"`
+	// Steps are the events that must be observed in order by sequence rules.
+	Steps  []StepDef          `json:"steps,omitempty"`
+	Window eventproc.Duration `json:"window"`
+	Raise  RaiseDef           `json:"raise"`
+}
+
+// StepDef defines a step of a sequence rule.
+type StepDef struct {
+	Code event.Code `json:"code"`
+	// GroupBy fields used to group the events of the step, if empty the
+	// fields of the rule will be used. It must have the same number of fields
+	// than the rule.
+	GroupBy []string `json:"groupby,omitempty"`
+}
+
+// RaiseDef defines the event raised when a rule matches.
+type RaiseDef struct {
+	Code  event.Code `json:"code"`
+	Level string     `json:"level"`
+	// Fields maps data fields of the raised event to fields of the event
+	// that triggered the rule.
+	Fields map[string]string `json:"fields,omitempty"`
+	// Count is the data field that will store the number of events.
+	Count string `json:"count,omitempty"`
+	// Refs is the data field that will store the ids of the events.
+	Refs string `json:"refs,omitempty"`
+}
+
+// RuleDefsFromFile returns all rule definitions in a file in json format.
+func RuleDefsFromFile(path string) ([]RuleDef, error) {
+	var rules []RuleDef
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("opening file '%s': %v", path, err)
+	}
+	defer f.Close()
+	byteValue, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, fmt.Errorf("reading file '%s': %v", path, err)
+	}
+	err = json.Unmarshal(byteValue, &rules)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshalling rules from json file '%s': %v", path, err)
+	}
+	return rules, nil
+}
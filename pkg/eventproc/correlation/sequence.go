@@ -0,0 +1,145 @@
+// Copyright 2019 Luis Guillén Civera <luisguillenc@gmail.com>. View LICENSE.
+
+package correlation
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/luids-io/api/event"
+	"github.com/luids-io/event/pkg/eventproc"
+)
+
+// sequence raises an event when the events of the steps are observed in
+// order, with the same group, within the window. A state machine is kept for
+// each group, it expires when the window since the first step is exceeded.
+type sequence struct {
+	rname  string
+	steps  []step
+	window time.Duration
+	raiser *raiser
+
+	mu        sync.Mutex
+	machines  map[string]*machine
+	lastSweep time.Time
+}
+
+type step struct {
+	code    event.Code
+	groupBy []eventproc.FieldGetter
+}
+
+// machine stores the state of a sequence, pos is the next step expected.
+type machine struct {
+	pos   int
+	start time.Time
+	hits  []hit
+}
+
+func newSequence(def RuleDef, r *raiser) (*sequence, error) {
+	if len(def.Steps) < 2 {
+		return nil, errors.New("sequence requires at least two steps")
+	}
+	if def.Window <= 0 {
+		return nil, errors.New("invalid window")
+	}
+	groupBy, err := fieldGetters(def.GroupBy)
+	if err != nil {
+		return nil, err
+	}
+	s := &sequence{
+		rname:    def.Name,
+		steps:    make([]step, 0, len(def.Steps)),
+		window:   time.Duration(def.Window),
+		raiser:   r,
+		machines: make(map[string]*machine),
+	}
+	for idx, sdef := range def.Steps {
+		if sdef.Code == def.Raise.Code {
+			return nil, errors.New("raise code can't be the code of a step")
+		}
+		st := step{code: sdef.Code, groupBy: groupBy}
+		if len(sdef.GroupBy) > 0 {
+			if len(sdef.GroupBy) != len(def.GroupBy) {
+				return nil, fmt.Errorf("step %v: groupby fields mismatch", idx)
+			}
+			st.groupBy, err = fieldGetters(sdef.GroupBy)
+			if err != nil {
+				return nil, fmt.Errorf("step %v: %v", idx, err)
+			}
+		}
+		s.steps = append(s.steps, st)
+	}
+	return s, nil
+}
+
+func (s *sequence) name() string {
+	return s.rname
+}
+
+func (s *sequence) observe(now time.Time, e *event.Event) (event.Event, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if now.Sub(s.lastSweep) > s.window {
+		s.sweep(now)
+	}
+	// advances the machine waiting for the event
+	for idx := 1; idx < len(s.steps); idx++ {
+		if s.steps[idx].code != e.Code {
+			continue
+		}
+		key, ok := groupKey(s.steps[idx].groupBy, e)
+		if !ok {
+			continue
+		}
+		m, ok := s.machines[key]
+		if !ok || m.pos != idx || s.expired(m, now) {
+			continue
+		}
+		m.pos++
+		m.hits = append(m.hits, hit{id: e.ID, at: now})
+		if m.pos < len(s.steps) {
+			return event.Event{}, false
+		}
+		delete(s.machines, key)
+		refs := make([]string, 0, len(m.hits))
+		for _, h := range m.hits {
+			refs = append(refs, h.id)
+		}
+		return s.raiser.derive(e, refs), true
+	}
+	// starts a new machine, a machine that only matched the first step is
+	// restarted so the window counts from the last event
+	if s.steps[0].code != e.Code {
+		return event.Event{}, false
+	}
+	key, ok := groupKey(s.steps[0].groupBy, e)
+	if !ok {
+		return event.Event{}, false
+	}
+	if m, ok := s.machines[key]; ok && m.pos > 1 && !s.expired(m, now) {
+		return event.Event{}, false
+	}
+	s.machines[key] = &machine{
+		pos:   1,
+		start: now,
+		hits:  []hit{{id: e.ID, at: now}},
+	}
+	return event.Event{}, false
+}
+
+func (s *sequence) expired(m *machine, now time.Time) bool {
+	return now.Sub(m.start) >= s.window
+}
+
+// sweep removes expired machines, it must be called with the lock held.
+func (s *sequence) sweep(now time.Time) {
+	for key, m := range s.machines {
+		if s.expired(m, now) {
+			delete(s.machines, key)
+		}
+	}
+	s.lastSweep = now
+}
@@ -0,0 +1,110 @@
+// Copyright 2019 Luis Guillén Civera <luisguillenc@gmail.com>. View LICENSE.
+
+package correlation
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/luids-io/api/event"
+	"github.com/luids-io/event/pkg/eventproc"
+)
+
+// threshold raises an event when the number of events with the same code and
+// group within the window reaches the threshold.
+type threshold struct {
+	rname   string
+	code    event.Code
+	groupBy []eventproc.FieldGetter
+	count   int
+	window  time.Duration
+	raiser  *raiser
+
+	mu        sync.Mutex
+	groups    map[string][]hit
+	lastSweep time.Time
+}
+
+type hit struct {
+	id string
+	at time.Time
+}
+
+func newThreshold(def RuleDef, r *raiser) (*threshold, error) {
+	if def.Threshold < 1 {
+		return nil, errors.New("invalid threshold")
+	}
+	if def.Window <= 0 {
+		return nil, errors.New("invalid window")
+	}
+	if def.Code == def.Raise.Code {
+		return nil, errors.New("raise code can't be the code correlated")
+	}
+	groupBy, err := fieldGetters(def.GroupBy)
+	if err != nil {
+		return nil, err
+	}
+	return &threshold{
+		rname:   def.Name,
+		code:    def.Code,
+		groupBy: groupBy,
+		count:   def.Threshold,
+		window:  time.Duration(def.Window),
+		raiser:  r,
+		groups:  make(map[string][]hit),
+	}, nil
+}
+
+func (t *threshold) name() string {
+	return t.rname
+}
+
+func (t *threshold) observe(now time.Time, e *event.Event) (event.Event, bool) {
+	if e.Code != t.code {
+		return event.Event{}, false
+	}
+	key, ok := groupKey(t.groupBy, e)
+	if !ok {
+		return event.Event{}, false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if now.Sub(t.lastSweep) > t.window {
+		t.sweep(now)
+	}
+	hits := expire(t.groups[key], now, t.window)
+	hits = append(hits, hit{id: e.ID, at: now})
+	if len(hits) < t.count {
+		t.groups[key] = hits
+		return event.Event{}, false
+	}
+	delete(t.groups, key)
+	refs := make([]string, 0, len(hits))
+	for _, h := range hits {
+		refs = append(refs, h.id)
+	}
+	return t.raiser.derive(e, refs), true
+}
+
+// sweep removes expired groups, it must be called with the lock held.
+func (t *threshold) sweep(now time.Time) {
+	for key, hits := range t.groups {
+		hits = expire(hits, now, t.window)
+		if len(hits) == 0 {
+			delete(t.groups, key)
+			continue
+		}
+		t.groups[key] = hits
+	}
+	t.lastSweep = now
+}
+
+// expire returns the hits within the window.
+func expire(hits []hit, now time.Time, window time.Duration) []hit {
+	idx := 0
+	for idx < len(hits) && now.Sub(hits[idx].at) >= window {
+		idx++
+	}
+	return hits[idx:]
+}
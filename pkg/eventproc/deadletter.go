@@ -0,0 +1,65 @@
+// Copyright 2019 Luis Guillén Civera <luisguillenc@gmail.com>. View LICENSE.
+
+package eventproc
+
+import "context"
+
+// DeadLetterSpool stores the requests of the events that failed.
+type DeadLetterSpool interface {
+	Store(r *Request) error
+}
+
+// DeadLetter option sets the destination of the events that ended with a
+// stop action due to a plugin error. Events will be processed by the stack
+// with the name passed and stored in the spool, stack can be empty and spool
+// can be nil. Events are stored in the spool before they are processed by the
+// stack, so the trace stored ends with the module that failed.
+func DeadLetter(stack string, spool DeadLetterSpool) Option {
+	return func(o *options) {
+		o.deadStack = stack
+		o.deadSpool = spool
+	}
+}
+
+// Failure returns the trace of the module that failed if the processing
+// ended with a stop action due to a plugin error.
+func (r *Request) Failure() (TraceEntry, bool) {
+	if r.Result.Action != ActionStop {
+		return TraceEntry{}, false
+	}
+	for idx := len(r.Trace) - 1; idx >= 0; idx-- {
+		t := r.Trace[idx]
+		if t.Error != "" && t.Action.Action == ActionStop {
+			return t, true
+		}
+	}
+	return TraceEntry{}, false
+}
+
+// deadLetter sends the request to the dead-letter destinations. The failure
+// is stored in the spool before the dead-letter stack adds its modules to the
+// trace, the stack is processed with the context of the request.
+func (p *Processor) deadLetter(ctx context.Context, pl *pipeline, r *Request) {
+	if p.opts.deadStack == "" && p.opts.deadSpool == nil {
+		return
+	}
+	if _, failed := r.Failure(); !failed {
+		return
+	}
+	p.mu.Lock()
+	p.deadLettered++
+	p.mu.Unlock()
+	if p.opts.deadSpool != nil {
+		if err := p.opts.deadSpool.Store(r); err != nil {
+			p.logger.Errorf("eventproc: storing event '%s' in dead-letter spool: %v", r.Event.ID, err)
+		}
+	}
+	if p.opts.deadStack != "" {
+		stack, ok := pl.stacks[p.opts.deadStack]
+		if ok {
+			stack.process(ctx, p, pl, r)
+		} else {
+			p.logger.Errorf("eventproc: can't find dead-letter stack '%s'", p.opts.deadStack)
+		}
+	}
+}
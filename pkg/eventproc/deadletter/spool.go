@@ -0,0 +1,138 @@
+// Copyright 2019 Luis Guillén Civera <luisguillenc@gmail.com>. View LICENSE.
+
+// Package deadletter implements an on-disk spool for the events that failed
+// in the event processor.
+//
+// This package is a work in progress and makes no API stability promises.
+package deadletter
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/luids-io/api/event"
+	"github.com/luids-io/event/pkg/eventproc"
+)
+
+// Entry stores a failed event.
+type Entry struct {
+	Event   event.Event            `json:"event"`
+	Stored  time.Time              `json:"stored"`
+	Failure eventproc.TraceEntry   `json:"failure"`
+	Trace   []eventproc.TraceEntry `json:"trace"`
+}
+
+// Spool stores each failed event in a json file in a directory. It
+// implements eventproc.DeadLetterSpool.
+type Spool struct {
+	dir string
+}
+
+const (
+	entryExt = ".json"
+	tempExt  = ".tmp"
+)
+
+// Open opens the spool stored in dir, it will be created if it doesn't
+// exist.
+func Open(dir string) (*Spool, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("creating spool dir: %v", err)
+	}
+	return &Spool{dir: dir}, nil
+}
+
+// Store implements eventproc.DeadLetterSpool.
+func (s *Spool) Store(r *eventproc.Request) error {
+	failure, ok := r.Failure()
+	if !ok {
+		return errors.New("request didn't fail")
+	}
+	entry := Entry{
+		Event:   r.Event,
+		Stored:  time.Now(),
+		Failure: failure,
+		Trace:   r.Trace,
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%020d-%s%s", entry.Stored.UnixNano(), r.Event.ID, entryExt)
+	// entries are written to a temp file and renamed, so partial entries
+	// are never listed
+	temp := filepath.Join(s.dir, name+tempExt)
+	if err := ioutil.WriteFile(temp, data, 0644); err != nil {
+		os.Remove(temp)
+		return err
+	}
+	return os.Rename(temp, filepath.Join(s.dir, name))
+}
+
+// List returns the names of the entries in the spool, from oldest to newest.
+func (s *Spool) List() ([]string, error) {
+	files, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(files))
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), entryExt) {
+			continue
+		}
+		names = append(names, f.Name())
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Load returns the entry with the name passed.
+func (s *Spool) Load(name string) (Entry, error) {
+	var entry Entry
+	data, err := ioutil.ReadFile(s.path(name))
+	if err != nil {
+		return entry, err
+	}
+	err = json.Unmarshal(data, &entry)
+	if err != nil {
+		return entry, fmt.Errorf("unmarshalling entry '%s': %v", name, err)
+	}
+	return entry, nil
+}
+
+// Remove deletes the entry with the name passed.
+func (s *Spool) Remove(name string) error {
+	return os.Remove(s.path(name))
+}
+
+func (s *Spool) path(name string) string {
+	return filepath.Join(s.dir, filepath.Base(name))
+}
+
+// Notification returns the event of the entry ready to be notified again,
+// all information completed by the processor is removed.
+func (e Entry) Notification() event.Event {
+	n := event.Event{
+		Code:       e.Event.Code,
+		Level:      e.Event.Level,
+		Created:    e.Event.Created,
+		Source:     e.Event.Source,
+		Duplicates: e.Event.Duplicates,
+	}
+	n.Data = make(map[string]interface{}, len(e.Event.Data))
+	for k, v := range e.Event.Data {
+		// fields added by deduplication are not in event definitions
+		if k == eventproc.DedupFirstField || k == eventproc.DedupLastField {
+			continue
+		}
+		n.Data[k] = v
+	}
+	return n
+}
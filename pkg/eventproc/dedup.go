@@ -0,0 +1,140 @@
+// Copyright 2019 Luis Guillén Civera <luisguillenc@gmail.com>. View LICENSE.
+
+package eventproc
+
+import (
+	"sync"
+	"time"
+)
+
+// Data fields used to annotate deduplicated events.
+const (
+	DedupFirstField = "dedup_first"
+	DedupLastField  = "dedup_last"
+)
+
+// Dedup option enables the deduplication of events. Events with the same
+// values in the keys received within the window will be merged: only the
+// first one will be processed, delayed until the window closes. If there were
+// repeats, the field Duplicates of the event will be incremented and the
+// data fields DedupFirstField and DedupLastField will contain the time of the
+// first and last seen events. If no keys are passed, code and source will be
+// used. If a journal is set, the events held are stored in the journal when
+// they are received.
+func Dedup(window time.Duration, keys ...FieldGetter) Option {
+	return func(o *options) {
+		if window > 0 {
+			o.dedupWindow = window
+			o.dedupKeys = keys
+		}
+	}
+}
+
+type deduper struct {
+	window time.Duration
+	keys   []FieldGetter
+	emit   func(*Request)
+
+	mu      sync.Mutex
+	pending map[string]*dedupEntry
+	stopped bool
+	merged  uint64
+}
+
+type dedupEntry struct {
+	req   *Request
+	first time.Time
+	last  time.Time
+	count int
+	timer *time.Timer
+}
+
+func newDeduper(window time.Duration, keys []FieldGetter, emit func(*Request)) *deduper {
+	if len(keys) == 0 {
+		keys = defaultDedupKeys()
+	}
+	return &deduper{
+		window:  window,
+		keys:    keys,
+		emit:    emit,
+		pending: make(map[string]*dedupEntry),
+	}
+}
+
+func defaultDedupKeys() []FieldGetter {
+	keys := make([]FieldGetter, 0, 3)
+	for _, name := range []string{"code", "source.hostname", "source.program"} {
+		key, _ := Field(name)
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// add holds the request until the window closes, it returns the request that
+// will be processed. If the deduper is stopped, it returns false.
+func (d *deduper) add(r *Request) (*Request, bool) {
+	fp := fingerprint(d.keys, &r.Event)
+	now := time.Now()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.stopped {
+		return nil, false
+	}
+	if entry, ok := d.pending[fp]; ok {
+		entry.count++
+		entry.last = now
+		d.merged++
+		return entry.req, true
+	}
+	entry := &dedupEntry{req: r, first: now, last: now}
+	entry.timer = time.AfterFunc(d.window, func() { d.expire(fp, entry) })
+	d.pending[fp] = entry
+	return r, true
+}
+
+func (d *deduper) expire(fp string, entry *dedupEntry) {
+	d.mu.Lock()
+	current, ok := d.pending[fp]
+	if !ok || current != entry {
+		d.mu.Unlock()
+		return
+	}
+	delete(d.pending, fp)
+	d.mu.Unlock()
+	d.emit(entry.annotate())
+}
+
+// flush emits all pending requests and stops the deduplication.
+func (d *deduper) flush() {
+	d.mu.Lock()
+	d.stopped = true
+	entries := make([]*dedupEntry, 0, len(d.pending))
+	for fp, entry := range d.pending {
+		entry.timer.Stop()
+		entries = append(entries, entry)
+		delete(d.pending, fp)
+	}
+	d.mu.Unlock()
+	for _, entry := range entries {
+		d.emit(entry.annotate())
+	}
+}
+
+func (d *deduper) stats() (merged, held uint64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.merged, uint64(len(d.pending))
+}
+
+func (entry *dedupEntry) annotate() *Request {
+	r := entry.req
+	if entry.count > 0 {
+		r.Event.Duplicates += entry.count
+		if r.Event.Data == nil {
+			r.Event.Data = make(map[string]interface{})
+		}
+		r.Event.Data[DedupFirstField] = entry.first.Format(time.RFC3339Nano)
+		r.Event.Data[DedupLastField] = entry.last.Format(time.RFC3339Nano)
+	}
+	return r
+}
@@ -0,0 +1,136 @@
+// Copyright 2019 Luis Guillén Civera <luisguillenc@gmail.com>. See LICENSE.
+
+package eventproc_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/luids-io/api/event"
+	"github.com/luids-io/event/pkg/eventdb"
+	"github.com/luids-io/event/pkg/eventproc"
+)
+
+// dedupProc returns a processor and a channel with the events processed.
+func dedupProc(opt ...eventproc.Option) (*eventproc.Processor, <-chan event.Event) {
+	processed := make(chan event.Event, 100)
+	main := eventproc.NewStack("main")
+	main.Add(&eventproc.Module{
+		Name: "record",
+		Plugins: []eventproc.ModulePlugin{eventproc.PluginFunc(func(e *event.Event) error {
+			processed <- *e
+			return nil
+		})},
+	})
+	db := eventdb.New([]eventdb.EventDef{
+		{Code: 1, Type: event.Security, Fields: []eventdb.FieldDef{{Name: "user", Type: "string"}}},
+		{Code: 2, Type: event.Security, Fields: []eventdb.FieldDef{{Name: "user", Type: "string"}}},
+	})
+	return eventproc.New(main, nil, db, opt...), processed
+}
+
+func dedupEvent(code event.Code, hostname, user string) event.Event {
+	e := event.New(code, event.Low)
+	e.Source.Hostname = hostname
+	e.Set("user", user)
+	return e
+}
+
+func TestDedup(t *testing.T) {
+	p, processed := dedupProc(eventproc.Dedup(50 * time.Millisecond))
+	defer p.Close()
+
+	ids := make([]string, 0, 4)
+	for _, e := range []event.Event{
+		dedupEvent(1, "host1", "a"),
+		dedupEvent(1, "host1", "b"),
+		dedupEvent(1, "host1", "c"),
+		dedupEvent(1, "host2", "a"),
+	} {
+		id, err := p.NotifyEvent(context.Background(), e)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		ids = append(ids, id)
+	}
+	if ids[0] != ids[1] || ids[0] != ids[2] || ids[0] == ids[3] {
+		t.Errorf("ids mismatch: %v", ids)
+	}
+	if stats := p.Stats(); stats.Held != 2 || stats.Duplicates != 2 {
+		t.Errorf("stats mismatch: held=%v duplicates=%v", stats.Held, stats.Duplicates)
+	}
+	// the window expiry releases the events held
+	got := make(map[string]event.Event)
+	for i := 0; i < 2; i++ {
+		select {
+		case e := <-processed:
+			got[e.ID] = e
+		case <-time.After(5 * time.Second):
+			t.Fatal("held events not released")
+		}
+	}
+	merged := got[ids[0]]
+	if merged.Duplicates != 2 || merged.Data["user"] != "a" {
+		t.Errorf("merged event mismatch: %v %v", merged.Duplicates, merged.Data)
+	}
+	first, ok1 := merged.Data[eventproc.DedupFirstField].(string)
+	last, ok2 := merged.Data[eventproc.DedupLastField].(string)
+	if !ok1 || !ok2 || first > last {
+		t.Errorf("dedup fields mismatch: %v", merged.Data)
+	}
+	single := got[ids[3]]
+	if _, ok := single.Data[eventproc.DedupFirstField]; single.Duplicates != 0 || ok {
+		t.Errorf("single event annotated: %v %v", single.Duplicates, single.Data)
+	}
+	if stats := p.Stats(); stats.Held != 0 {
+		t.Errorf("held mismatch: %v", stats.Held)
+	}
+	// a new window is opened
+	id, err := p.NotifyEvent(context.Background(), dedupEvent(1, "host1", "a"))
+	if err != nil || id == ids[0] {
+		t.Errorf("event merged after window: %v %v", id, err)
+	}
+}
+
+func TestDedupKeys(t *testing.T) {
+	user, _ := eventproc.Field("data.user")
+	p, processed := dedupProc(eventproc.Dedup(time.Hour, user))
+
+	var tests = []struct {
+		e     event.Event
+		merge int
+	}{
+		{dedupEvent(1, "host1", "a"), 0},
+		// other code and source, same user
+		{dedupEvent(2, "host2", "a"), 0},
+		{dedupEvent(1, "host1", "b"), 2},
+	}
+	ids := make([]string, 0, len(tests))
+	for idx, test := range tests {
+		id, err := p.NotifyEvent(context.Background(), test.e)
+		if err != nil {
+			t.Fatalf("idx[%v] unexpected error: %v", idx, err)
+		}
+		ids = append(ids, id)
+	}
+	for idx, test := range tests {
+		if ids[idx] != ids[test.merge] {
+			t.Errorf("idx[%v] id mismatch: %v", idx, ids)
+		}
+	}
+	// shutdown flushes the events held
+	if _, err := p.Shutdown(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	count := len(processed)
+	for i := 0; i < count; i++ {
+		e := <-processed
+		if e.ID == ids[0] && e.Duplicates != 1 {
+			t.Errorf("duplicates mismatch: %v", e.Duplicates)
+		}
+	}
+	if count != 2 {
+		t.Errorf("processed mismatch: %v", count)
+	}
+}
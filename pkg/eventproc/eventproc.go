@@ -11,7 +11,9 @@ import (
 	"errors"
 	"fmt"
 	"runtime"
+	"runtime/debug"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gofrs/uuid"
@@ -26,19 +28,44 @@ import (
 type Processor struct {
 	opts   options
 	logger yalogi.Logger
-	//event channel
-	events chan *Request
-	db     eventdb.Database
-	// stacks
-	main   *Stack
-	stacks map[string]*Stack
+	//event queues, one per worker if sharded
+	queues    []*queue
+	shardKeys []FieldGetter
+	// stacks and database
+	pmu      sync.RWMutex
+	pipeline *pipeline
 	// hooks
 	hrunner *hooksRunner
+	// rate limits
+	limiters []*rateLimiter
+	// deduplication
+	dedup *deduper
+	// forked events
+	forker *forker
+	// pause control
+	paused int32
+	// counters
+	mu           sync.Mutex
+	throttled    uint64
+	deadLettered uint64
+	panics       uint64
+	hookErrs     uint64
 	// control
+	ctx    context.Context
+	cancel context.CancelFunc
 	wg     sync.WaitGroup
-	closed bool
+	smu    sync.Mutex
+	state  int32
+	closed chan struct{}
 }
 
+// states of the processor
+const (
+	stateRunning int32 = iota
+	stateDraining
+	stateClosed
+)
+
 // Option defines Processor options.
 type Option func(*options)
 
@@ -47,7 +74,24 @@ type options struct {
 	workers  int
 	guidGen  GUIDGenerator
 	buffSize int
+	overflow OverflowPolicy
+	timeout  time.Duration
+	weights  []int
+	maxWait  time.Duration
+	limits   []rateLimit
+	journal  Journal
 	hooks    *Hooks
+	// deduplication
+	dedupWindow time.Duration
+	dedupKeys   []FieldGetter
+	// sharding
+	shard     bool
+	shardKeys []FieldGetter
+	// dead-letter
+	deadStack string
+	deadSpool DeadLetterSpool
+	// fork
+	forkWorkers int
 }
 
 var defaultOptions = options{
@@ -55,7 +99,11 @@ var defaultOptions = options{
 	logger:   yalogi.LogNull,
 	guidGen:  defaultGUIDGen,
 	buffSize: 100,
+	overflow: OverflowBlock,
+	timeout:  time.Second,
 	hooks:    NewHooks(),
+	// fork
+	forkWorkers: DefaultForkWorkers,
 }
 
 // GUIDGenerator must returns a new unique Global ID for events.
@@ -77,6 +125,16 @@ func SetLogger(l yalogi.Logger) Option {
 	}
 }
 
+// SetHooks option sets the hooks that will be called while processing the
+// events.
+func SetHooks(h *Hooks) Option {
+	return func(o *options) {
+		if h != nil {
+			o.hooks = h
+		}
+	}
+}
+
 // SetGUIDGen option sets a custom gid event generator.
 func SetGUIDGen(g GUIDGenerator) Option {
 	return func(o *options) {
@@ -101,6 +159,80 @@ func SetBufferSize(n int) Option {
 	}
 }
 
+// SetOverflowPolicy option defines the behaviour when the event request
+// buffer is full.
+func SetOverflowPolicy(policy OverflowPolicy) Option {
+	return func(o *options) {
+		o.overflow = policy
+	}
+}
+
+// OverflowTimeout option defines the max time that a request will be blocked
+// when the policy is OverflowDeadline.
+func OverflowTimeout(d time.Duration) Option {
+	return func(o *options) {
+		if d > 0 {
+			o.timeout = d
+		}
+	}
+}
+
+// DefaultWeights are the weights used in priority scheduling for the levels
+// info, low, medium, high and critical.
+var DefaultWeights = []int{1, 2, 4, 8, 16}
+
+// Priority option enables level-aware scheduling of events. Weights must
+// contain a positive value for each event level, from info to critical. If
+// weights is nil or not valid, DefaultWeights will be used.
+func Priority(weights []int) Option {
+	return func(o *options) {
+		if len(weights) != len(DefaultWeights) {
+			weights = DefaultWeights
+		}
+		for _, w := range weights {
+			if w <= 0 {
+				weights = DefaultWeights
+				break
+			}
+		}
+		o.weights = make([]int, len(weights))
+		copy(o.weights, weights)
+	}
+}
+
+// MaxWait option enables starvation protection in priority scheduling. The
+// events that have been waiting in the queue for longer than d will be
+// dequeued first.
+func MaxWait(d time.Duration) Option {
+	return func(o *options) {
+		if d > 0 {
+			o.maxWait = d
+		}
+	}
+}
+
+// Journal defines the interface of the persistent storage used by the
+// processor to recover the accepted events after a crash or restart.
+type Journal interface {
+	// Append stores the event and returns a sequence number.
+	Append(e event.Event) (uint64, error)
+	// Ack marks the event with the sequence number as processed.
+	Ack(seq uint64) error
+	// Replay calls fn for each event not acknowledged.
+	Replay(fn func(seq uint64, e event.Event) error) error
+	// Close journal.
+	Close() error
+}
+
+// SetJournal option sets a journal for the event queue. Events will be
+// acknowledged when the main stack finishes. The processor will close the
+// journal on shutdown.
+func SetJournal(j Journal) Option {
+	return func(o *options) {
+		o.journal = j
+	}
+}
+
 // New creates a new processor with stack as the main stack.
 func New(main *Stack, others []*Stack, db eventdb.Database, opt ...Option) *Processor {
 	opts := defaultOptions
@@ -108,17 +240,40 @@ func New(main *Stack, others []*Stack, db eventdb.Database, opt ...Option) *Proc
 		o(&opts)
 	}
 	p := &Processor{
-		opts:    opts,
-		logger:  opts.logger,
-		events:  make(chan *Request, opts.buffSize),
-		db:      db,
-		main:    main,
-		stacks:  make(map[string]*Stack, len(others)),
-		hrunner: &hooksRunner{hooks: opts.hooks},
-	}
-	//add other stacks
-	for _, stack := range others {
-		p.stacks[stack.name] = stack
+		opts:     opts,
+		logger:   opts.logger,
+		queues:   newQueues(opts),
+		pipeline: newPipeline(main, others, db),
+		hrunner:  &hooksRunner{hooks: opts.hooks},
+		forker:   newForker(opts.forkWorkers, opts.buffSize),
+		closed:   make(chan struct{}),
+	}
+	p.ctx, p.cancel = context.WithCancel(context.Background())
+	if len(p.queues) > 1 {
+		p.shardKeys = opts.shardKeys
+		if len(p.shardKeys) == 0 {
+			p.shardKeys = defaultShardKeys()
+		}
+	}
+	//create rate limiters
+	for _, l := range opts.limits {
+		p.limiters = append(p.limiters, newRateLimiter(l))
+	}
+	//create deduper
+	if opts.dedupWindow > 0 {
+		p.dedup = newDeduper(opts.dedupWindow, opts.dedupKeys, func(r *Request) {
+			// held events are emitted from timers, so they must not block
+			// forever if the queue is full
+			policy := p.opts.overflow
+			if policy == OverflowBlock {
+				policy = OverflowDeadline
+			}
+			// held events are already in the journal, so they aren't
+			// acknowledged and will be replayed on restart
+			if err := p.enqueue(r, policy); err != nil {
+				p.logger.Warnf("eventproc: deduplicated event '%s' not queued: %v", r.Event.ID, err)
+			}
+		})
 	}
 	p.init(opts.workers)
 	return p
@@ -126,7 +281,7 @@ func New(main *Stack, others []*Stack, db eventdb.Database, opt ...Option) *Proc
 
 // NotifyEvent implements event.Notifier.
 func (p *Processor) NotifyEvent(ctx context.Context, e event.Event) (string, error) {
-	if p.closed {
+	if !p.running() {
 		return "", event.ErrUnavailable
 	}
 	// gets peer info
@@ -138,24 +293,32 @@ func (p *Processor) NotifyEvent(ctx context.Context, e event.Event) (string, err
 		p.logger.Warnf("eventproc: [peer=%s] notify event: %v", peerAddr, err)
 		return "", event.ErrBadRequest
 	}
+	// checks rate limits
+	if !p.checkRate(e, peerData, peerAddr) {
+		return "", event.ErrUnavailable
+	}
+
+	e = p.complete(e, def)
+
+	//enqueues event to process
+	return p.queueEvent(e, peerData)
+}
 
+// complete event data of notified events.
+func (p *Processor) complete(e event.Event, def eventdb.EventDef) event.Event {
 	now := time.Now()
-	// complete event data
 	e.ID = p.opts.guidGen()
 	e.Received = now
 	e.Processors = []event.ProcessInfo{{
 		Received:  now,
 		Processor: event.GetDefaultSource(),
 	}}
-	e = def.Complete(e)
-
-	//enqueues event to process
-	return e.ID, p.queueEvent(e, peerData)
+	return def.Complete(e)
 }
 
 // ForwardEvent implements event.Forwarder.
 func (p *Processor) ForwardEvent(ctx context.Context, e event.Event) error {
-	if p.closed {
+	if !p.running() {
 		return event.ErrUnavailable
 	}
 	// gets peer info
@@ -167,24 +330,221 @@ func (p *Processor) ForwardEvent(ctx context.Context, e event.Event) error {
 		p.logger.Warnf("eventproc: [peer=%s] forward event: %v", peerAddr, err)
 		return event.ErrBadRequest
 	}
+	// checks rate limits
+	if !p.checkRate(e, peerData, peerAddr) {
+		return event.ErrUnavailable
+	}
 
 	// complete data
 	procinfo := event.ProcessInfo{Received: time.Now(), Processor: event.GetDefaultSource()}
 	e.Processors = append(e.Processors, procinfo)
 
 	// enqueues event to process
-	return p.queueEvent(e, peerData)
+	_, err = p.queueEvent(e, peerData)
+	return err
 }
 
-// Close event processor.
+// Shutdown stops the intake of events and waits until all queued events and
+// the calls to Process in progress are processed. If the context expires
+// before, the pending events will be abandoned and the in-flight processing
+// will be canceled. It returns the number of abandoned events.
+func (p *Processor) Shutdown(ctx context.Context) (int, error) {
+	if p.drain() != stateRunning {
+		return 0, errors.New("eventproc: processor is not running")
+	}
+	p.logger.Infof("shutting down event processor")
+	p.stopIntake()
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+	var err error
+	abandoned := 0
+	select {
+	case <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+		abandoned = p.abort()
+		<-done
+	}
+	abandoned += p.stopForks(ctx)
+	p.finish()
+	if abandoned > 0 {
+		p.logger.Warnf("eventproc: %v events abandoned", abandoned)
+	}
+	return abandoned, err
+}
+
+// Close event processor. Pending events will be abandoned and the context
+// passed to filters and plugins will be canceled, so in-flight calls will be
+// aborted. If a Shutdown is in progress, Close aborts the drain and waits
+// until Shutdown finishes.
 func (p *Processor) Close() {
-	if p.closed {
+	switch p.drain() {
+	case stateRunning:
+		p.logger.Infof("closing event processor")
+		p.stopIntake()
+	case stateDraining:
+		p.logger.Infof("aborting event processor shutdown")
+		if abandoned := p.abort(); abandoned > 0 {
+			p.logger.Warnf("eventproc: %v events abandoned", abandoned)
+		}
+		<-p.closed
+		return
+	default:
 		return
 	}
-	p.logger.Infof("closing event processor")
-	p.closed = true
-	close(p.events)
+	abandoned := p.abort()
 	p.wg.Wait()
+	abandoned += p.stopForks(p.ctx)
+	p.finish()
+	if abandoned > 0 {
+		p.logger.Warnf("eventproc: %v events abandoned", abandoned)
+	}
+}
+
+// drain changes the state to draining if the processor is running. It
+// returns the previous state, only the caller that gets stateRunning must
+// finish the processor.
+func (p *Processor) drain() int32 {
+	p.smu.Lock()
+	defer p.smu.Unlock()
+	state := atomic.LoadInt32(&p.state)
+	if state == stateRunning {
+		atomic.StoreInt32(&p.state, stateDraining)
+	}
+	return state
+}
+
+// stopIntake flushes the events held by deduplication and closes the queues.
+// Closed queues are never paused, so the processor is resumed.
+func (p *Processor) stopIntake() {
+	if p.dedup != nil {
+		p.dedup.flush()
+	}
+	p.closeQueues()
+	atomic.StoreInt32(&p.paused, 0)
+}
+
+// finish releases the resources and marks the processor as closed.
+func (p *Processor) finish() {
+	p.cancel()
+	p.closeJournal()
+	atomic.StoreInt32(&p.state, stateClosed)
+	close(p.closed)
+}
+
+// Replay enqueues the events not acknowledged in the journal. It must be
+// called once the plugins are started. It returns the number of events
+// enqueued.
+func (p *Processor) Replay() (int, error) {
+	if p.opts.journal == nil {
+		return 0, nil
+	}
+	count := 0
+	err := p.opts.journal.Replay(func(seq uint64, e event.Event) error {
+		newreq := &Request{Event: e, Enqueued: time.Now(), seq: seq, journaled: true}
+		if err := p.queueFor(newreq).put(newreq); err != nil {
+			return err
+		}
+		count++
+		return nil
+	})
+	if count > 0 {
+		p.logger.Infof("eventproc: replayed %v events from journal", count)
+	}
+	if err != nil {
+		return count, fmt.Errorf("eventproc: replaying journal: %v", err)
+	}
+	return count, nil
+}
+
+func (p *Processor) running() bool {
+	return atomic.LoadInt32(&p.state) == stateRunning
+}
+
+func (p *Processor) closeJournal() {
+	if p.opts.journal != nil {
+		if err := p.opts.journal.Close(); err != nil {
+			p.logger.Errorf("eventproc: closing journal: %v", err)
+		}
+	}
+}
+
+// ack marks the request as processed in the journal.
+func (p *Processor) ack(r *Request) {
+	if r.journaled {
+		if err := p.opts.journal.Ack(r.seq); err != nil {
+			p.logger.Warnf("eventproc: ack event '%s': %v", r.Event.ID, err)
+		}
+	}
+}
+
+// abort discards pending events and cancels in-flight processing.
+func (p *Processor) abort() int {
+	abandoned := p.discardQueues()
+	p.cancel()
+	return abandoned
+}
+
+// Stats stores statistics of the processor.
+type Stats struct {
+	// Queued is the number of events waiting in the queue.
+	Queued uint64 `json:"queued"`
+	// Lanes contains the number of events waiting in each lane of the queue.
+	// If priority is enabled, there is a lane for each event level, from
+	// info to critical.
+	Lanes []uint64 `json:"lanes"`
+	// Shards contains the number of events waiting in the queue of each
+	// worker if sharding is enabled.
+	Shards []uint64 `json:"shards,omitempty"`
+	// Rejected is the number of events rejected because the queue was full.
+	Rejected uint64 `json:"rejected"`
+	// Dropped is the number of queued events dropped to make room.
+	Dropped uint64 `json:"dropped"`
+	// Abandoned is the number of queued events discarded on shutdown.
+	Abandoned uint64 `json:"abandoned"`
+	// Throttled is the number of events rejected by rate limits.
+	Throttled uint64 `json:"throttled"`
+	// Duplicates is the number of events merged by deduplication.
+	Duplicates uint64 `json:"duplicates"`
+	// Held is the number of events held by deduplication.
+	Held uint64 `json:"held"`
+	// DeadLettered is the number of failed events sent to dead-letter.
+	DeadLettered uint64 `json:"deadlettered"`
+	// Panics is the number of panics recovered.
+	Panics uint64 `json:"panics"`
+	// HookErrors is the number of errors returned by policy hooks.
+	HookErrors uint64 `json:"hookerrors"`
+	// Forked is the number of events forked to other stacks.
+	Forked uint64 `json:"forked"`
+	// ForkDropped is the number of forks dropped because the fork buffer
+	// was full or the processor was closing.
+	ForkDropped uint64 `json:"forkdropped"`
+	// Workers is the number of workers.
+	Workers int `json:"workers"`
+	// Paused is true if the processor is paused.
+	Paused bool `json:"paused"`
+}
+
+// Stats returns processor statistics.
+func (p *Processor) Stats() Stats {
+	var s Stats
+	p.queueStats(&s)
+	p.forker.stats(&s)
+	s.Workers = p.opts.workers
+	s.Paused = p.Paused()
+	p.mu.Lock()
+	s.Throttled = p.throttled
+	s.DeadLettered = p.deadLettered
+	s.Panics = p.panics
+	s.HookErrors = p.hookErrs
+	p.mu.Unlock()
+	if p.dedup != nil {
+		s.Duplicates, s.Held = p.dedup.stats()
+	}
+	return s
 }
 
 // Request is used to store information of the event processing.
@@ -194,8 +554,21 @@ type Request struct {
 	Started    time.Time
 	Finished   time.Time
 	StackTrace []string
-	Peer       *peer.Peer
-	jumps      []string
+	// Trace stores the outcome of each module executed.
+	Trace []TraceEntry
+	Peer  *peer.Peer
+	// Module stores information of the module in execution.
+	Module ModuleInfo
+	// Result is the action returned by the main stack.
+	Result StackAction
+	// Verdict returned by the policy hooks before the processing.
+	Verdict Verdict
+	jumps   []string
+	// errors returned by modules
+	errs []error
+	// journal info
+	seq       uint64
+	journaled bool
 }
 
 func (p *Processor) init(nworkers int) {
@@ -206,29 +579,81 @@ func (p *Processor) init(nworkers int) {
 		wid := i
 		go p.processWorker(wid)
 	}
+	//fork workers
+	for i := 0; i < p.opts.forkWorkers; i++ {
+		go p.forkWorker()
+	}
 }
 
 func (p *Processor) processWorker(workerid int) {
 	defer p.wg.Done()
 	p.logger.Debugf("starting worker %v", workerid)
-	for e := range p.events {
-		//process event
-		p.hrunner.beforeProc(e)
-		e.Started = time.Now()
-		status, _ := p.main.process(p, e)
-		e.Finished = time.Now()
-		p.hrunner.afterProc(e)
-		//check result action
-		if status.Action == ActionReturn ||
-			status.Action == ActionFinish ||
-			status.Action == ActionNext {
-			//only calls finish hooks if exits ok
-			p.hrunner.finishProc(e)
+	for {
+		e, ok := p.workerQueue(workerid).pop()
+		if !ok {
+			break
 		}
+		p.processRequest(p.ctx, e)
 	}
 	p.logger.Debugf("closing worker %v", workerid)
 }
 
+// processRequest processes the request using the pipeline in use. Panics in
+// modules are recovered by the stacks, panics in hooks are recovered here so
+// the worker is not killed.
+func (p *Processor) processRequest(ctx context.Context, e *Request) {
+	defer func() {
+		if r := recover(); r != nil {
+			p.mu.Lock()
+			p.panics++
+			p.mu.Unlock()
+			p.logger.Errorf("eventproc: panic processing event '%s': %v\n%s", e.Event.ID, r, debug.Stack())
+			p.ack(e)
+		}
+	}()
+	//process event
+	verdict, errs := p.hrunner.beforeProc(e)
+	if verdict.Action == VerdictSkip {
+		errs = append(errs, fmt.Errorf("verdict '%v' is not valid before processing", verdict))
+		verdict = Verdict{}
+	}
+	e.Verdict = verdict
+	p.hookErrors(e, errs)
+	e.Started = time.Now()
+	pl := p.acquire()
+	status := func() StackAction {
+		defer pl.release()
+		stack := pl.main
+		switch verdict.Action {
+		case VerdictDrop:
+			e.Result = StackAction{Action: ActionStop}
+			return e.Result
+		case VerdictReroute:
+			var ok bool
+			stack, ok = pl.stacks[verdict.Stack]
+			if !ok {
+				p.logger.Errorf("eventproc: can't find stack '%s' to reroute event '%s'", verdict.Stack, e.Event.ID)
+				e.Result = StackAction{Action: ActionStop}
+				return e.Result
+			}
+		}
+		status, _ := stack.process(ctx, p, pl, e)
+		e.Result = status
+		p.deadLetter(ctx, pl, e)
+		return status
+	}()
+	e.Finished = time.Now()
+	p.hrunner.afterProc(e)
+	//check result action
+	if status.Action == ActionReturn ||
+		status.Action == ActionFinish ||
+		status.Action == ActionNext {
+		//only calls finish hooks if exits ok
+		p.hrunner.finishProc(e)
+	}
+	p.ack(e)
+}
+
 func getPeerAddr(ctx context.Context) (p *peer.Peer, paddr string) {
 	var ok bool
 	p, ok = peer.FromContext(ctx)
@@ -248,7 +673,7 @@ func (p *Processor) validateNotify(e event.Event) (def eventdb.EventDef, err err
 		return
 	}
 	var ok bool
-	def, ok = p.db.FindByCode(e.Code)
+	def, ok = p.database().FindByCode(e.Code)
 	if !ok {
 		err = fmt.Errorf("code '%v' not found", e.Code)
 		return
@@ -277,12 +702,54 @@ func (p *Processor) validateForward(e event.Event) error {
 	return nil
 }
 
-func (p *Processor) queueEvent(e event.Event, pinfo *peer.Peer) error {
-	// enqueues event to process
-	newreq := &Request{Event: e, Enqueued: time.Now(), Peer: pinfo}
-	if p.closed {
+func (p *Processor) queueEvent(e event.Event, pinfo *peer.Peer) (string, error) {
+	newreq := &Request{Event: e, Peer: pinfo}
+	// events are journaled before the deduplication, so the events held
+	// are not lost on crash
+	if err := p.journal(newreq); err != nil {
+		return "", err
+	}
+	if p.dedup != nil {
+		if held, ok := p.dedup.add(newreq); ok {
+			if held != newreq {
+				// merged with the held event
+				p.ack(newreq)
+			}
+			return held.Event.ID, nil
+		}
+	}
+	if err := p.enqueue(newreq, p.opts.overflow); err != nil {
+		p.ack(newreq)
+		return "", err
+	}
+	return e.ID, nil
+}
+
+// journal appends the request to the journal.
+func (p *Processor) journal(newreq *Request) error {
+	if p.opts.journal == nil {
+		return nil
+	}
+	seq, err := p.opts.journal.Append(newreq.Event)
+	if err != nil {
+		p.logger.Errorf("eventproc: journal event '%s': %v", newreq.Event.ID, err)
 		return event.ErrUnavailable
 	}
-	p.events <- newreq
+	newreq.seq, newreq.journaled = seq, true
+	return nil
+}
+
+// enqueue pushes the request applying the overflow policy passed.
+func (p *Processor) enqueue(newreq *Request, policy OverflowPolicy) error {
+	newreq.Enqueued = time.Now()
+	dropped, err := p.queueFor(newreq).push(newreq, policy)
+	if err != nil {
+		p.logger.Warnf("eventproc: queue event '%s': %v", newreq.Event.ID, err)
+		return event.ErrUnavailable
+	}
+	if dropped != nil {
+		p.logger.Warnf("eventproc: queue full, dropped event '%s'", dropped.Event.ID)
+		p.ack(dropped)
+	}
 	return nil
 }
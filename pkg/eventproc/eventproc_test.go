@@ -0,0 +1,333 @@
+// Copyright 2019 Luis Guillén Civera <luisguillenc@gmail.com>. See LICENSE.
+
+package eventproc_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/luids-io/api/event"
+	"github.com/luids-io/event/pkg/eventdb"
+	"github.com/luids-io/event/pkg/eventproc"
+	"github.com/luids-io/event/pkg/eventproc/journal"
+)
+
+func TestCloseAbortsShutdown(t *testing.T) {
+	started := make(chan struct{}, 10)
+	main := eventproc.NewStack("main")
+	main.Add(&eventproc.Module{
+		Name: "block",
+		Plugins: []eventproc.ModulePlugin{func(ctx context.Context, e *event.Event) error {
+			started <- struct{}{}
+			<-ctx.Done()
+			return ctx.Err()
+		}},
+	})
+	db := eventdb.New([]eventdb.EventDef{{Code: 1, Type: event.Security}})
+	p := eventproc.New(main, nil, db, eventproc.Workers(1))
+
+	for i := 0; i < 3; i++ {
+		if _, err := p.NotifyEvent(context.Background(), event.New(1, event.Low)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	<-started
+
+	type shutdownResult struct {
+		abandoned int
+		err       error
+	}
+	res := make(chan shutdownResult, 1)
+	go func() {
+		abandoned, err := p.Shutdown(context.Background())
+		res <- shutdownResult{abandoned, err}
+	}()
+	// waits until shutdown is draining
+	for i := 0; i < 100; i++ {
+		if _, err := p.NotifyEvent(context.Background(), event.New(1, event.Low)); err == event.ErrUnavailable {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	closed := make(chan struct{})
+	go func() {
+		p.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("close didn't abort shutdown")
+	}
+	select {
+	case r := <-res:
+		if r.err != nil {
+			t.Errorf("unexpected error: %v", r.err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("shutdown didn't finish")
+	}
+	if _, err := p.Shutdown(context.Background()); err == nil {
+		t.Error("expected error on closed processor")
+	}
+	p.Close()
+}
+
+func TestShutdownResumes(t *testing.T) {
+	main := eventproc.NewStack("main")
+	main.Add(&eventproc.Module{Name: "noop"})
+	db := eventdb.New([]eventdb.EventDef{{Code: 1, Type: event.Security}})
+	p := eventproc.New(main, nil, db, eventproc.Workers(1))
+	defer p.Close()
+
+	p.Pause()
+	if _, err := p.NotifyEvent(context.Background(), event.New(1, event.Low)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !p.Stats().Paused {
+		t.Error("processor must be paused")
+	}
+	abandoned, err := p.Shutdown(context.Background())
+	if err != nil || abandoned != 0 {
+		t.Errorf("unexpected shutdown result: %v %v", abandoned, err)
+	}
+	if p.Stats().Paused {
+		t.Error("processor must be resumed after shutdown")
+	}
+	p.Pause()
+	if p.Paused() {
+		t.Error("closed processor can't be paused")
+	}
+}
+
+func TestDedupJournal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "eventproc")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	j, err := journal.Open(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	main := eventproc.NewStack("main")
+	main.Add(&eventproc.Module{Name: "noop"})
+	db := eventdb.New([]eventdb.EventDef{{Code: 1, Type: event.Security}})
+	p := eventproc.New(main, nil, db, eventproc.Dedup(time.Hour), eventproc.SetJournal(j))
+	defer p.Close()
+
+	first, err := p.NotifyEvent(context.Background(), event.New(1, event.Low))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	second, err := p.NotifyEvent(context.Background(), event.New(1, event.Low))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if first != second {
+		t.Errorf("event not merged: %v %v", first, second)
+	}
+	// the held event is journaled, the duplicate is acknowledged
+	if got := j.Pending(); got != 1 {
+		t.Errorf("pending mismatch: got %v; want 1", got)
+	}
+	if _, err := p.Shutdown(context.Background()); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestRateLimitRefund(t *testing.T) {
+	main := eventproc.NewStack("main")
+	main.Add(&eventproc.Module{Name: "noop"})
+	db := eventdb.New([]eventdb.EventDef{{Code: 1, Type: event.Security}})
+	p := eventproc.New(main, nil, db,
+		eventproc.RateLimit(eventproc.RateByCode, 0.001, 2),
+		eventproc.RateLimit(eventproc.RateByHostname, 0.001, 1))
+	defer p.Close()
+
+	var tests = []struct {
+		hostname string
+		want     error
+	}{
+		{"host1", nil},
+		{"host1", event.ErrUnavailable},
+		{"host1", event.ErrUnavailable},
+		// tokens of the rejected events are not consumed
+		{"host2", nil},
+		{"host3", event.ErrUnavailable},
+	}
+	for idx, test := range tests {
+		e := event.New(1, event.Low)
+		e.Source.Hostname = test.hostname
+		if _, err := p.NotifyEvent(context.Background(), e); err != test.want {
+			t.Errorf("idx[%v] unexpected error: %v", idx, err)
+		}
+	}
+	if got := p.Stats().Throttled; got != 3 {
+		t.Errorf("throttled mismatch: got %v; want 3", got)
+	}
+}
+
+func TestReloadDeadLetter(t *testing.T) {
+	db := eventdb.New([]eventdb.EventDef{{Code: 1, Type: event.Security}})
+	dead := eventproc.NewStack("dead")
+	p := eventproc.New(eventproc.NewStack("main"), []*eventproc.Stack{dead}, db, eventproc.DeadLetter("dead", nil))
+	defer p.Close()
+
+	if err := p.Reload(eventproc.NewStack("main"), nil, db); err == nil {
+		t.Error("expected error reloading without dead-letter stack")
+	}
+	if err := p.Reload(eventproc.NewStack("main"), []*eventproc.Stack{eventproc.NewStack("dead")}, db); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	if _, err := eventproc.RetryPolicyFromDef(eventproc.RetryDef{Attempts: 3, MaxBackoff: eventproc.Duration(time.Minute)}); err == nil {
+		t.Error("expected error with max backoff exceeded")
+	}
+	policy, err := eventproc.RetryPolicyFromDef(eventproc.RetryDef{Attempts: 3, Backoff: eventproc.Duration(time.Millisecond)})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	calls := 0
+	main := eventproc.NewStack("main")
+	main.Add(&eventproc.Module{
+		Name: "flaky",
+		Plugins: []eventproc.ModulePlugin{eventproc.PluginFunc(func(e *event.Event) error {
+			calls++
+			if calls < 3 {
+				return event.ErrUnavailable
+			}
+			return nil
+		})},
+		OnError: eventproc.StackAction{Action: eventproc.ActionStop},
+		Retry:   policy,
+	})
+	db := eventdb.New([]eventdb.EventDef{{Code: 1, Type: event.Security}})
+	p := eventproc.New(main, nil, db)
+	defer p.Close()
+
+	res, err := p.Process(context.Background(), event.New(1, event.Low))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if res.Action.Action != eventproc.ActionNext || len(res.Trace) != 1 || res.Trace[0].Retries != 2 {
+		t.Errorf("result mismatch: %+v", res)
+	}
+}
+
+func TestFilterPanicTrace(t *testing.T) {
+	main := eventproc.NewStack("main")
+	main.Add(&eventproc.Module{
+		Name: "panic",
+		Filters: []eventproc.ModuleFilter{eventproc.FilterFunc(func(e event.Event) bool {
+			panic("filter")
+		})},
+		FilterClasses: []string{"bad"},
+		OnError:       eventproc.StackAction{Action: eventproc.ActionStop},
+	})
+	db := eventdb.New([]eventdb.EventDef{{Code: 1, Type: event.Security}})
+	p := eventproc.New(main, nil, db)
+	defer p.Close()
+
+	res, err := p.Process(context.Background(), event.New(1, event.Low))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(res.Trace) != 1 {
+		t.Fatalf("trace mismatch: %v", res.Trace)
+	}
+	entry := res.Trace[0]
+	if entry.Matched || entry.Filter != "bad" || entry.Error == "" {
+		t.Errorf("trace entry mismatch: %+v", entry)
+	}
+}
+
+func TestBuildDisabledModule(t *testing.T) {
+	b := eventproc.NewBuilder(nil)
+	stack, err := b.Build(eventproc.StackDef{
+		Name: "main",
+		Modules: []eventproc.ModuleDef{
+			{Name: "on"},
+			// disabled modules are not built, so missing plugins are ignored
+			{Name: "off", Disabled: true, Plugins: []*eventproc.ItemDef{{Class: "notexists"}}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := stack.Module("on"); !ok {
+		t.Error("module not built")
+	}
+	if _, ok := stack.Module("off"); ok {
+		t.Error("disabled module built")
+	}
+	_, err = b.Build(eventproc.StackDef{
+		Name:    "other",
+		Modules: []eventproc.ModuleDef{{Name: "on", Plugins: []*eventproc.ItemDef{{Class: "notexists"}}}},
+	})
+	if err == nil {
+		t.Error("expected error building enabled module")
+	}
+}
+
+type traceSpool struct {
+	traces [][]eventproc.TraceEntry
+}
+
+func (s *traceSpool) Store(r *eventproc.Request) error {
+	trace := make([]eventproc.TraceEntry, len(r.Trace))
+	copy(trace, r.Trace)
+	s.traces = append(s.traces, trace)
+	return nil
+}
+
+type ctxKey struct{}
+
+func TestDeadLetter(t *testing.T) {
+	main := eventproc.NewStack("main")
+	main.Add(&eventproc.Module{
+		Name: "fail",
+		Plugins: []eventproc.ModulePlugin{eventproc.PluginFunc(func(e *event.Event) error {
+			return event.ErrUnavailable
+		})},
+		OnError: eventproc.StackAction{Action: eventproc.ActionStop},
+	})
+	var value interface{}
+	dead := eventproc.NewStack("dead")
+	dead.Add(&eventproc.Module{
+		Name: "notify",
+		Plugins: []eventproc.ModulePlugin{func(ctx context.Context, e *event.Event) error {
+			value = ctx.Value(ctxKey{})
+			return nil
+		}},
+	})
+	spool := &traceSpool{}
+	db := eventdb.New([]eventdb.EventDef{{Code: 1, Type: event.Security}})
+	p := eventproc.New(main, []*eventproc.Stack{dead}, db, eventproc.DeadLetter("dead", spool))
+	defer p.Close()
+
+	ctx := context.WithValue(context.Background(), ctxKey{}, "caller")
+	res, err := p.Process(ctx, event.New(1, event.Low))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(res.Trace) != 2 || res.Trace[1].Module != "notify" {
+		t.Errorf("event not processed by dead-letter stack: %+v", res.Trace)
+	}
+	// the dead-letter stack uses the context of the request
+	if value != "caller" {
+		t.Errorf("context mismatch: %v", value)
+	}
+	// the failure is stored before the dead-letter stack is processed
+	if len(spool.traces) != 1 || len(spool.traces[0]) != 1 || spool.traces[0][0].Module != "fail" {
+		t.Errorf("stored trace mismatch: %+v", spool.traces)
+	}
+	if p.Stats().DeadLettered != 1 {
+		t.Errorf("dead lettered mismatch: %v", p.Stats().DeadLettered)
+	}
+}
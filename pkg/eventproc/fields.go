@@ -0,0 +1,264 @@
+// Copyright 2019 Luis Guillén Civera <luisguillenc@gmail.com>. View LICENSE.
+
+package eventproc
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/luids-io/api/event"
+)
+
+// FieldGetter returns the value of a field of the event, it returns false if
+// the field is not set.
+type FieldGetter func(e *event.Event) (interface{}, bool)
+
+// Field returns a getter for the field name passed. Fields supported are id,
+// code, codename, level, type, tags, source.hostname, source.program,
+// source.instance, source.pid and data.<path>. See DataPath for the format
+// of the paths.
+func Field(name string) (FieldGetter, error) {
+	switch name {
+	case "id":
+		return func(e *event.Event) (interface{}, bool) { return e.ID, true }, nil
+	case "code":
+		return func(e *event.Event) (interface{}, bool) { return e.Code, true }, nil
+	case "codename":
+		return func(e *event.Event) (interface{}, bool) { return e.Codename, true }, nil
+	case "level":
+		return func(e *event.Event) (interface{}, bool) { return e.Level, true }, nil
+	case "type":
+		return func(e *event.Event) (interface{}, bool) { return e.Type, true }, nil
+	case "tags":
+		return func(e *event.Event) (interface{}, bool) { return e.Tags, true }, nil
+	case "source.hostname":
+		return func(e *event.Event) (interface{}, bool) { return e.Source.Hostname, true }, nil
+	case "source.program":
+		return func(e *event.Event) (interface{}, bool) { return e.Source.Program, true }, nil
+	case "source.instance":
+		return func(e *event.Event) (interface{}, bool) { return e.Source.Instance, true }, nil
+	case "source.pid":
+		return func(e *event.Event) (interface{}, bool) { return e.Source.PID, true }, nil
+	}
+	if strings.HasPrefix(name, "data.") {
+		get, err := DataPath(strings.TrimPrefix(name, "data."))
+		if err != nil {
+			return nil, fmt.Errorf("invalid field '%s': %v", name, err)
+		}
+		return get, nil
+	}
+	return nil, fmt.Errorf("invalid field '%s'", name)
+}
+
+// pathElem is a segment of a data path. Index is the position in a list,
+// it's -1 if the key is not a number.
+type pathElem struct {
+	key   string
+	index int
+}
+
+// DataPath returns a getter for the value in the data of the event at the
+// path passed. Paths are dot separated keys of nested objects, indexes of
+// lists are set between brackets or as numeric keys, for example
+// "answers[0].ip" or "answers.0.ip". Data fields with dots in the name are
+// also resolved.
+func DataPath(path string) (FieldGetter, error) {
+	elems, err := parseDataPath(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(elems) == 1 {
+		key := elems[0].key
+		return func(e *event.Event) (interface{}, bool) { return e.Get(key) }, nil
+	}
+	return func(e *event.Event) (interface{}, bool) {
+		if v, ok := e.Get(path); ok {
+			return v, true
+		}
+		return resolvePath(e.Data, elems)
+	}, nil
+}
+
+func parseDataPath(path string) ([]pathElem, error) {
+	if path == "" {
+		return nil, errors.New("empty path")
+	}
+	elems := make([]pathElem, 0)
+	for _, segment := range strings.Split(path, ".") {
+		key := segment
+		var indexes []string
+		if i := strings.Index(segment, "["); i >= 0 {
+			key = segment[:i]
+			rest := segment[i:]
+			for rest != "" {
+				end := strings.Index(rest, "]")
+				if !strings.HasPrefix(rest, "[") || end < 0 {
+					return nil, fmt.Errorf("invalid segment '%s'", segment)
+				}
+				indexes = append(indexes, rest[1:end])
+				rest = rest[end+1:]
+			}
+		}
+		if key == "" && (len(elems) == 0 || len(indexes) == 0) {
+			return nil, fmt.Errorf("empty key in '%s'", path)
+		}
+		if key != "" {
+			elems = append(elems, newPathElem(key))
+		}
+		for _, index := range indexes {
+			elem := newPathElem(index)
+			if elem.index < 0 {
+				return nil, fmt.Errorf("invalid index '%s' in '%s'", index, segment)
+			}
+			elems = append(elems, elem)
+		}
+	}
+	return elems, nil
+}
+
+func newPathElem(key string) pathElem {
+	index, err := strconv.Atoi(key)
+	if err != nil || index < 0 {
+		index = -1
+	}
+	return pathElem{key: key, index: index}
+}
+
+// resolvePath returns the value in the path of nested maps and lists.
+func resolvePath(v interface{}, elems []pathElem) (interface{}, bool) {
+	for _, elem := range elems {
+		switch t := v.(type) {
+		case map[string]interface{}:
+			next, ok := t[elem.key]
+			if !ok {
+				return nil, false
+			}
+			v = next
+		case []interface{}:
+			if elem.index < 0 || elem.index >= len(t) {
+				return nil, false
+			}
+			v = t[elem.index]
+		default:
+			rv := reflect.ValueOf(v)
+			switch rv.Kind() {
+			case reflect.Map:
+				if rv.Type().Key().Kind() != reflect.String {
+					return nil, false
+				}
+				next := rv.MapIndex(reflect.ValueOf(elem.key).Convert(rv.Type().Key()))
+				if !next.IsValid() {
+					return nil, false
+				}
+				v = next.Interface()
+			case reflect.Slice, reflect.Array:
+				if elem.index < 0 || elem.index >= rv.Len() {
+					return nil, false
+				}
+				v = rv.Index(elem.index).Interface()
+			default:
+				return nil, false
+			}
+		}
+	}
+	return v, true
+}
+
+// AsString converts the value of a field to a string. Numbers, booleans and
+// types implementing fmt.Stringer are converted, maps and lists are not.
+func AsString(v interface{}) (string, bool) {
+	switch t := v.(type) {
+	case nil:
+		return "", false
+	case string:
+		return t, true
+	case fmt.Stringer:
+		return t.String(), true
+	case bool:
+		return strconv.FormatBool(t), true
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(rv.Int(), 10), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(rv.Uint(), 10), true
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(rv.Float(), 'f', -1, 64), true
+	case reflect.String:
+		return rv.String(), true
+	}
+	return "", false
+}
+
+// AsInt converts the value of a field to an int. Floats without decimals
+// and strings with integers are converted.
+func AsInt(v interface{}) (int, bool) {
+	if s, ok := v.(string); ok {
+		i, err := strconv.Atoi(strings.TrimSpace(s))
+		return i, err == nil
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return int(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int(rv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		f := rv.Float()
+		if f != float64(int(f)) {
+			return 0, false
+		}
+		return int(f), true
+	}
+	return 0, false
+}
+
+// AsFloat converts the value of a field to a float64. Integers and strings
+// with numbers are converted.
+func AsFloat(v interface{}) (float64, bool) {
+	if s, ok := v.(string); ok {
+		f, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+		return f, err == nil
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), true
+	}
+	return 0, false
+}
+
+// AsBool converts the value of a field to a bool. Strings are converted
+// using strconv.ParseBool.
+func AsBool(v interface{}) (bool, bool) {
+	switch t := v.(type) {
+	case bool:
+		return t, true
+	case string:
+		b, err := strconv.ParseBool(strings.TrimSpace(t))
+		return b, err == nil
+	}
+	return false, false
+}
+
+// fingerprint returns a string with the values of the keys in the event.
+func fingerprint(keys []FieldGetter, e *event.Event) string {
+	values := make([]string, 0, len(keys))
+	for _, key := range keys {
+		v, ok := key(e)
+		if !ok {
+			values = append(values, "")
+			continue
+		}
+		values = append(values, fmt.Sprintf("%v", v))
+	}
+	return strings.Join(values, "\x00")
+}
@@ -0,0 +1,113 @@
+// Copyright 2019 Luis Guillén Civera <luisguillenc@gmail.com>. See LICENSE.
+
+package eventproc_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/luids-io/api/event"
+	"github.com/luids-io/event/pkg/eventproc"
+)
+
+func TestDataPath(t *testing.T) {
+	e := event.New(1, event.High)
+	// data as received from json
+	err := json.Unmarshal([]byte(`{
+		"name": "www.example.com",
+		"dns": {
+			"answers": [ { "ip": "10.0.0.1", "ttl": 300 }, { "ip": "10.0.0.2", "ttl": 60 } ],
+			"matrix": [ [1, 2], [3, 4] ]
+		},
+		"flat.key": "flat"
+	}`), &e.Data)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	e.Data["ports"] = []int{53, 853}
+	e.Data["labels"] = map[string]string{"env": "prod"}
+
+	var tests = []struct {
+		path string
+		want interface{}
+		ok   bool
+	}{
+		{"data.name", "www.example.com", true},
+		{"data.dns.answers[1].ip", "10.0.0.2", true},
+		{"data.dns.answers.0.ip", "10.0.0.1", true},
+		{"data.dns.answers[0].ttl", float64(300), true},
+		{"data.dns.matrix[1][0]", float64(3), true},
+		{"data.ports[1]", 853, true},
+		{"data.labels.env", "prod", true},
+		{"data.flat.key", "flat", true},
+		{"data.dns.answers[2].ip", nil, false},
+		{"data.dns.answers.ip", nil, false},
+		{"data.name.other", nil, false},
+		{"data.notset", nil, false},
+	}
+	for idx, test := range tests {
+		get, err := eventproc.Field(test.path)
+		if err != nil {
+			t.Errorf("idx[%v] unexpected error: %v", idx, err)
+			continue
+		}
+		got, ok := get(&e)
+		if ok != test.ok || (ok && got != test.want) {
+			t.Errorf("idx[%v] %s: got %v, %v; want %v, %v", idx, test.path, got, ok, test.want, test.ok)
+		}
+	}
+	for idx, path := range []string{"data.", "data.a..b", "data.[0]", "data.a[x]", "data.a[0", "other"} {
+		if _, err := eventproc.Field(path); err == nil {
+			t.Errorf("idx[%v] %s: expected error", idx, path)
+		}
+	}
+}
+
+func TestCoercion(t *testing.T) {
+	var strs = []struct {
+		in   interface{}
+		want string
+		ok   bool
+	}{
+		{"text", "text", true},
+		{53, "53", true},
+		{float64(0.5), "0.5", true},
+		{float64(300), "300", true},
+		{true, "true", true},
+		{event.High, "high", true},
+		{event.Code(10001), "10001", true},
+		{[]interface{}{1}, "", false},
+		{nil, "", false},
+	}
+	for idx, test := range strs {
+		got, ok := eventproc.AsString(test.in)
+		if got != test.want || ok != test.ok {
+			t.Errorf("idx[%v] AsString(%v): got %v, %v", idx, test.in, got, ok)
+		}
+	}
+	var ints = []struct {
+		in   interface{}
+		want int
+		ok   bool
+	}{
+		{53, 53, true},
+		{float64(300), 300, true},
+		{float64(0.5), 0, false},
+		{" 42 ", 42, true},
+		{"4x", 0, false},
+		{uint8(7), 7, true},
+		{true, 0, false},
+	}
+	for idx, test := range ints {
+		got, ok := eventproc.AsInt(test.in)
+		if got != test.want || ok != test.ok {
+			t.Errorf("idx[%v] AsInt(%v): got %v, %v", idx, test.in, got, ok)
+		}
+	}
+	if f, ok := eventproc.AsFloat("0.25"); !ok || f != 0.25 {
+		t.Errorf("AsFloat: got %v, %v", f, ok)
+	}
+	if b, ok := eventproc.AsBool("true"); !ok || !b {
+		t.Errorf("AsBool: got %v, %v", b, ok)
+	}
+}
@@ -6,6 +6,7 @@
 package basicexpr
 
 import (
+	"context"
 	"errors"
 	"strconv"
 	"strings"
@@ -64,62 +65,89 @@ func Builder() eventproc.FilterBuilder {
 			}
 			return getLevel(op, vlevel)
 
+		case "codename":
+			return getStringMatch(op, value, b.DataPath, func(e event.Event) (string, bool) {
+				return e.Codename, true
+			})
+
 		case "source.hostname":
-			return getSourceHostname(op, value)
+			return getSourceHostname(op, value, b.DataPath)
 
 		case "source.program":
-			return getSourceProgram(op, value)
+			return getSourceProgram(op, value, b.DataPath)
 
 		}
-		if strings.HasPrefix("data.", field) {
-			fields := strings.Split(field, ".")
-			if len(fields) == 2 {
-				return geData(fields[1], op, value)
+		if strings.HasPrefix(field, "data.") {
+			get, err := eventproc.Field(field)
+			if err != nil {
+				return nil, err
 			}
+			return geData(get, op, value, b.DataPath)
 		}
 		return nil, errors.New("invalid field")
 	}
 }
 
+// New returns a filter for the expression defined by field, operator and
+// value, the same used as args in the filter definitions. List files are
+// relative to the working dir.
+func New(field, op, value string) (eventproc.ModuleFilter, error) {
+	def := &eventproc.ItemDef{Class: FilterClass, Args: []string{field, op, value}}
+	return Builder()(eventproc.NewBuilder(nil), def)
+}
+
+// Parse returns a filter for an expression in the format "field op value".
+func Parse(expr string) (eventproc.ModuleFilter, error) {
+	args := strings.Fields(expr)
+	if len(args) < 2 {
+		return nil, errors.New("invalid expression")
+	}
+	value := ""
+	if len(args) > 2 {
+		value = strings.Join(args[2:], " ")
+	}
+	return New(args[0], args[1], value)
+}
+
 func getCode(op string, value event.Code) (eventproc.ModuleFilter, error) {
 	switch op {
 	case "==":
-		return func(e event.Event) bool {
+		return func(ctx context.Context, e event.Event) bool {
 			if e.Code == event.Code(value) {
 				return true
 			}
 			return false
 		}, nil
 	case "!=":
-		return func(e event.Event) bool {
+		return func(ctx context.Context, e event.Event) bool {
 			if e.Code != event.Code(value) {
 				return true
 			}
 			return false
 		}, nil
 	case "<":
-		return func(e event.Event) bool {
+		return func(ctx context.Context, e event.Event) bool {
 			if e.Code < event.Code(value) {
 				return true
 			}
 			return false
 		}, nil
 	case "<=":
-		return func(e event.Event) bool {
+		return func(ctx context.Context, e event.Event) bool {
 			if e.Code <= event.Code(value) {
 				return true
 			}
 			return false
 		}, nil
 	case ">":
-		return func(e event.Event) bool {
+		return func(ctx context.Context, e event.Event) bool {
 			if e.Code > event.Code(value) {
 				return true
 			}
 			return false
 		}, nil
 	case ">=":
-		return func(e event.Event) bool {
+		return func(ctx context.Context, e event.Event) bool {
 			if e.Code >= event.Code(value) {
 				return true
 			}
@@ -133,14 +161,14 @@ func getCode(op string, value event.Code) (eventproc.ModuleFilter, error) {
 func getType(op string, value event.Type) (eventproc.ModuleFilter, error) {
 	switch op {
 	case "==":
-		return func(e event.Event) bool {
+		return func(ctx context.Context, e event.Event) bool {
 			if e.Type == value {
 				return true
 			}
 			return false
 		}, nil
 	case "!=":
-		return func(e event.Event) bool {
+		return func(ctx context.Context, e event.Event) bool {
 			if e.Type != value {
 				return true
 			}
@@ -154,42 +182,42 @@ func getType(op string, value event.Type) (eventproc.ModuleFilter, error) {
 func getLevel(op string, value event.Level) (eventproc.ModuleFilter, error) {
 	switch op {
 	case "==":
-		return func(e event.Event) bool {
+		return func(ctx context.Context, e event.Event) bool {
 			if e.Level == value {
 				return true
 			}
 			return false
 		}, nil
 	case "!=":
-		return func(e event.Event) bool {
+		return func(ctx context.Context, e event.Event) bool {
 			if e.Level != value {
 				return true
 			}
 			return false
 		}, nil
 	case "<":
-		return func(e event.Event) bool {
+		return func(ctx context.Context, e event.Event) bool {
 			if e.Level < value {
 				return true
 			}
 			return false
 		}, nil
 	case "<=":
-		return func(e event.Event) bool {
+		return func(ctx context.Context, e event.Event) bool {
 			if e.Level <= value {
 				return true
 			}
 			return false
 		}, nil
 	case ">":
-		return func(e event.Event) bool {
+		return func(ctx context.Context, e event.Event) bool {
 			if e.Level > value {
 				return true
 			}
 			return false
 		}, nil
 	case ">=":
-		return func(e event.Event) bool {
+		return func(ctx context.Context, e event.Event) bool {
 			if e.Level >= value {
 				return true
 			}
@@ -200,62 +228,75 @@ func getLevel(op string, value event.Level) (eventproc.ModuleFilter, error) {
 	}
 }
 
-func getSourceHostname(op string, value string) (eventproc.ModuleFilter, error) {
+func getSourceHostname(op string, value string, datapath func(string) string) (eventproc.ModuleFilter, error) {
 	switch op {
 	case "==":
-		return func(e event.Event) bool {
+		return func(ctx context.Context, e event.Event) bool {
 			if e.Source.Hostname == value {
 				return true
 			}
 			return false
 		}, nil
 	case "!=":
-		return func(e event.Event) bool {
+		return func(ctx context.Context, e event.Event) bool {
 			if e.Source.Hostname != value {
 				return true
 			}
 			return false
 		}, nil
 	default:
-		return nil, errors.New("invalid operator")
+		return getStringMatch(op, value, datapath, func(e event.Event) (string, bool) {
+			return e.Source.Hostname, true
+		})
 	}
 }
 
-func getSourceProgram(op string, value string) (eventproc.ModuleFilter, error) {
+func getSourceProgram(op string, value string, datapath func(string) string) (eventproc.ModuleFilter, error) {
 	switch op {
 	case "==":
-		return func(e event.Event) bool {
+		return func(ctx context.Context, e event.Event) bool {
 			if e.Source.Program == value {
 				return true
 			}
 			return false
 		}, nil
 	case "!=":
-		return func(e event.Event) bool {
+		return func(ctx context.Context, e event.Event) bool {
 			if e.Source.Program != value {
 				return true
 			}
 			return false
 		}, nil
 	default:
-		return nil, errors.New("invalid operator")
+		return getStringMatch(op, value, datapath, func(e event.Event) (string, bool) {
+			return e.Source.Program, true
+		})
 	}
 }
 
-func geData(field, op, value string) (eventproc.ModuleFilter, error) {
+func geData(get eventproc.FieldGetter, op, value string, datapath func(string) string) (eventproc.ModuleFilter, error) {
 	switch op {
+	case "=~", "glob", "in", "notin", "cidr":
+		return getStringMatch(op, value, datapath, func(e event.Event) (string, bool) {
+			datav, ok := get(&e)
+			if !ok {
+				return "", false
+			}
+			datas, ok := eventproc.AsString(datav)
+			return datas, ok
+		})
 	case "isset":
-		return func(e event.Event) bool {
-			_, ok := e.Get(field)
+		return func(ctx context.Context, e event.Event) bool {
+			_, ok := get(&e)
 			return ok
 		}, nil
 	case "==":
-		return func(e event.Event) bool {
-			datav, ok := e.Get(field)
+		return func(ctx context.Context, e event.Event) bool {
+			datav, ok := get(&e)
 			if !ok {
 				return false
 			}
-			datas, ok := datav.(string)
+			datas, ok := eventproc.AsString(datav)
 			if !ok {
 				return false
 			}
@@ -265,12 +306,12 @@ func geData(field, op, value string) (eventproc.ModuleFilter, error) {
 			return false
 		}, nil
 	case "!=":
-		return func(e event.Event) bool {
-			datav, ok := e.Get(field)
+		return func(ctx context.Context, e event.Event) bool {
+			datav, ok := get(&e)
 			if !ok {
 				return true
 			}
-			datas, ok := datav.(string)
+			datas, ok := eventproc.AsString(datav)
 			if !ok {
 				return true
 			}
@@ -284,12 +325,12 @@ func geData(field, op, value string) (eventproc.ModuleFilter, error) {
 		if err != nil {
 			return nil, errors.New("invalid value")
 		}
-		return func(e event.Event) bool {
-			datav, ok := e.Get(field)
+		return func(ctx context.Context, e event.Event) bool {
+			datav, ok := get(&e)
 			if !ok {
 				return false
 			}
-			datai, ok := datav.(int)
+			datai, ok := eventproc.AsInt(datav)
 			if !ok {
 				return false
 			}
@@ -303,12 +344,12 @@ func geData(field, op, value string) (eventproc.ModuleFilter, error) {
 		if err != nil {
 			return nil, errors.New("invalid value")
 		}
-		return func(e event.Event) bool {
-			datav, ok := e.Get(field)
+		return func(ctx context.Context, e event.Event) bool {
+			datav, ok := get(&e)
 			if !ok {
 				return true
 			}
-			datai, ok := datav.(int)
+			datai, ok := eventproc.AsInt(datav)
 			if !ok {
 				return true
 			}
@@ -322,12 +363,12 @@ func geData(field, op, value string) (eventproc.ModuleFilter, error) {
 		if err != nil {
 			return nil, errors.New("invalid value")
 		}
-		return func(e event.Event) bool {
-			datav, ok := e.Get(field)
+		return func(ctx context.Context, e event.Event) bool {
+			datav, ok := get(&e)
 			if !ok {
 				return false
 			}
-			datai, ok := datav.(int)
+			datai, ok := eventproc.AsInt(datav)
 			if !ok {
 				return false
 			}
@@ -341,12 +382,12 @@ func geData(field, op, value string) (eventproc.ModuleFilter, error) {
 		if err != nil {
 			return nil, errors.New("invalid value")
 		}
-		return func(e event.Event) bool {
-			datav, ok := e.Get(field)
+		return func(ctx context.Context, e event.Event) bool {
+			datav, ok := get(&e)
 			if !ok {
 				return false
 			}
-			datai, ok := datav.(int)
+			datai, ok := eventproc.AsInt(datav)
 			if !ok {
 				return false
 			}
@@ -360,12 +401,12 @@ func geData(field, op, value string) (eventproc.ModuleFilter, error) {
 		if err != nil {
 			return nil, errors.New("invalid value")
 		}
-		return func(e event.Event) bool {
-			datav, ok := e.Get(field)
+		return func(ctx context.Context, e event.Event) bool {
+			datav, ok := get(&e)
 			if !ok {
 				return false
 			}
-			datai, ok := datav.(int)
+			datai, ok := eventproc.AsInt(datav)
 			if !ok {
 				return false
 			}
@@ -379,12 +420,12 @@ func geData(field, op, value string) (eventproc.ModuleFilter, error) {
 		if err != nil {
 			return nil, errors.New("invalid value")
 		}
-		return func(e event.Event) bool {
-			datav, ok := e.Get(field)
+		return func(ctx context.Context, e event.Event) bool {
+			datav, ok := get(&e)
 			if !ok {
 				return false
 			}
-			datai, ok := datav.(int)
+			datai, ok := eventproc.AsInt(datav)
 			if !ok {
 				return false
 			}
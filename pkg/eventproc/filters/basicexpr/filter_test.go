@@ -0,0 +1,121 @@
+// Copyright 2019 Luis Guillén Civera <luisguillenc@gmail.com>. See LICENSE.
+
+package basicexpr_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/luids-io/api/event"
+	"github.com/luids-io/event/pkg/eventproc"
+	"github.com/luids-io/event/pkg/eventproc/filters/basicexpr"
+)
+
+func TestFilter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "basicexpr")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	list := "# trusted hosts\nfw1\n\n  fw2  \n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "hosts.txt"), []byte(list), 0644); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	nets := "10.0.0.0/8\n192.168.1.1\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "nets.txt"), []byte(nets), 0644); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	b := eventproc.NewBuilder(nil, eventproc.DataDir(dir))
+
+	e := event.New(10001, event.High)
+	e.Codename = "dns.blacklisted"
+	e.Source = event.Source{Hostname: "fw2", Program: "dnsd"}
+	e.Data = map[string]interface{}{"ip": "192.168.1.1", "name": "www.example.com", "port": 53}
+	e.Data["dns"] = map[string]interface{}{
+		"answers": []interface{}{map[string]interface{}{"ip": "10.1.1.1", "ttl": float64(300)}},
+	}
+
+	var tests = []struct {
+		args []string
+		want bool
+	}{
+		{[]string{"code", "==", "10001"}, true},
+		{[]string{"codename", "==", "dns.blacklisted"}, true},
+		{[]string{"codename", "glob", "dns.*"}, true},
+		{[]string{"codename", "=~", "^ip\\."}, false},
+		{[]string{"source.hostname", "=~", "^fw[0-9]+$"}, true},
+		{[]string{"source.hostname", "glob", "fw?"}, true},
+		{[]string{"source.hostname", "in", "fw1, fw2"}, true},
+		{[]string{"source.hostname", "notin", "fw1,fw3"}, true},
+		{[]string{"source.hostname", "in", "@hosts.txt"}, true},
+		{[]string{"source.hostname", "notin", "@hosts.txt"}, false},
+		{[]string{"source.program", "in", "named,unbound"}, false},
+		{[]string{"data.name", "==", "www.example.com"}, true},
+		{[]string{"data.name", "glob", "*.example.com"}, true},
+		{[]string{"data.ip", "cidr", "10.0.0.0/8,192.168.0.0/16"}, true},
+		{[]string{"data.ip", "cidr", "10.0.0.0/8"}, false},
+		{[]string{"data.ip", "cidr", "@nets.txt"}, true},
+		{[]string{"data.ip", "cidr", "192.168.1.1"}, true},
+		{[]string{"data.ip", "=~", "^192\\.168\\."}, true},
+		{[]string{"data.ip", "in", "10.1.1.1, 192.168.1.1"}, true},
+		{[]string{"data.ip", "notin", "@nets.txt"}, false},
+		{[]string{"data.name", "cidr", "0.0.0.0/0"}, false},
+		{[]string{"data.notset", "in", "a,b"}, false},
+		{[]string{"data.notset", "notin", "a,b"}, true},
+		{[]string{"data.port", "eq", "53"}, true},
+		{[]string{"data.port", "isset", ""}, true},
+		{[]string{"data.port", "==", "53"}, true},
+		{[]string{"data.dns.answers[0].ip", "cidr", "10.0.0.0/8"}, true},
+		{[]string{"data.dns.answers.0.ttl", "ge", "300"}, true},
+		{[]string{"data.dns.answers[1].ip", "isset", ""}, false},
+	}
+	builder := basicexpr.Builder()
+	for idx, test := range tests {
+		filter, err := builder(b, &eventproc.ItemDef{Class: basicexpr.FilterClass, Args: test.args})
+		if err != nil {
+			t.Errorf("idx[%v] unexpected error: %v", idx, err)
+			continue
+		}
+		if got := filter(context.Background(), e); got != test.want {
+			t.Errorf("idx[%v] %v: got %v; want %v", idx, test.args, got, test.want)
+		}
+	}
+}
+
+func TestBuildErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "basicexpr")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "empty.txt"), []byte("# no hosts\n\n"), 0644); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	b := eventproc.NewBuilder(nil, eventproc.DataDir(dir))
+
+	var tests = [][]string{
+		{"source.hostname", "=~", "(["},
+		{"source.hostname", "glob", "[a-"},
+		{"source.hostname", "in", " , "},
+		{"source.hostname", "in", "@notfound.txt"},
+		{"source.hostname", "in", "@empty.txt"},
+		{"data.ip", "cidr", "@empty.txt"},
+		{"data.ip", "in", ","},
+		{"source.hostname", "cidr", "10.0.0.0/33"},
+		{"source.hostname", "cidr", "host"},
+		{"codename", "<", "a"},
+		{"other", "==", "a"},
+		{"data.ip", "cidr", "10.0.0.0/33"},
+		{"data.a[x]", "==", "a"},
+	}
+	builder := basicexpr.Builder()
+	for idx, test := range tests {
+		def := &eventproc.ItemDef{Class: basicexpr.FilterClass, Args: test}
+		if _, err := builder(b, def); err == nil {
+			t.Errorf("idx[%v] %v: expected error", idx, test)
+		}
+	}
+}
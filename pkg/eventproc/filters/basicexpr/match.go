@@ -0,0 +1,159 @@
+// Copyright 2019 Luis Guillén Civera <luisguillenc@gmail.com>. View LICENSE.
+
+package basicexpr
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/luids-io/api/event"
+	"github.com/luids-io/event/pkg/eventproc"
+)
+
+// ListFilePrefix is the prefix used in the values of the operators in, notin
+// and cidr to load the list from a file. The path of the file is relative to
+// the data dir of the builder.
+const ListFilePrefix = "@"
+
+type matchFn func(s string) bool
+
+// getMatch compiles the operators for string fields. If negate is true, the
+// result of match must be negated.
+func getMatch(op, value string, datapath func(string) string) (match matchFn, negate bool, err error) {
+	switch op {
+	case "==":
+		return func(s string) bool { return s == value }, false, nil
+	case "!=":
+		return func(s string) bool { return s == value }, true, nil
+	case "=~":
+		re, err := regexp.Compile(value)
+		if err != nil {
+			return nil, false, fmt.Errorf("invalid regexp: %v", err)
+		}
+		return re.MatchString, false, nil
+	case "glob":
+		if _, err := path.Match(value, ""); err != nil {
+			return nil, false, fmt.Errorf("invalid glob: %v", err)
+		}
+		return func(s string) bool {
+			matched, _ := path.Match(value, s)
+			return matched
+		}, false, nil
+	case "in", "notin":
+		items, err := getList(value, datapath)
+		if err != nil {
+			return nil, false, err
+		}
+		set := make(map[string]bool, len(items))
+		for _, item := range items {
+			set[item] = true
+		}
+		return func(s string) bool { return set[s] }, op == "notin", nil
+	case "cidr":
+		items, err := getList(value, datapath)
+		if err != nil {
+			return nil, false, err
+		}
+		nets := make([]*net.IPNet, 0, len(items))
+		for _, item := range items {
+			if !strings.Contains(item, "/") {
+				ip := net.ParseIP(item)
+				if ip == nil {
+					return nil, false, fmt.Errorf("invalid ip '%s'", item)
+				}
+				bits := 8 * net.IPv6len
+				if ip.To4() != nil {
+					ip, bits = ip.To4(), 8*net.IPv4len
+				}
+				nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+				continue
+			}
+			_, ipnet, err := net.ParseCIDR(item)
+			if err != nil {
+				return nil, false, fmt.Errorf("invalid cidr '%s'", item)
+			}
+			nets = append(nets, ipnet)
+		}
+		return func(s string) bool {
+			ip := net.ParseIP(s)
+			if ip == nil {
+				return false
+			}
+			for _, ipnet := range nets {
+				if ipnet.Contains(ip) {
+					return true
+				}
+			}
+			return false
+		}, false, nil
+	}
+	return nil, false, errors.New("invalid operator")
+}
+
+// getStringMatch returns a filter for a string field of the event. If the
+// field is not set, the filter returns true only for negated operators.
+func getStringMatch(op, value string, datapath func(string) string, get func(e event.Event) (string, bool)) (eventproc.ModuleFilter, error) {
+	match, negate, err := getMatch(op, value, datapath)
+	if err != nil {
+		return nil, err
+	}
+	return func(ctx context.Context, e event.Event) bool {
+		s, ok := get(e)
+		if !ok {
+			return negate
+		}
+		return match(s) != negate
+	}, nil
+}
+
+// getList returns the items in a comma separated list or in a list file if
+// value has the prefix ListFilePrefix.
+func getList(value string, datapath func(string) string) ([]string, error) {
+	if strings.HasPrefix(value, ListFilePrefix) {
+		return readList(datapath(strings.TrimPrefix(value, ListFilePrefix)))
+	}
+	items := make([]string, 0)
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			items = append(items, item)
+		}
+	}
+	if len(items) == 0 {
+		return nil, errors.New("empty list")
+	}
+	return items, nil
+}
+
+// readList reads a list file, with an item per line. Empty lines and lines
+// starting with # are ignored, the file must contain at least one item.
+func readList(fname string) ([]string, error) {
+	f, err := os.Open(fname)
+	if err != nil {
+		return nil, fmt.Errorf("opening list file: %v", err)
+	}
+	defer f.Close()
+	items := make([]string, 0)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		items = append(items, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading list file: %v", err)
+	}
+	if len(items) == 0 {
+		return nil, errors.New("empty list file")
+	}
+	return items, nil
+}
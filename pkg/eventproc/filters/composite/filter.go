@@ -0,0 +1,119 @@
+// Copyright 2019 Luis Guillén Civera <luisguillenc@gmail.com>. View LICENSE.
+
+// Package composite implements filters that combine other filters for event
+// processing. The combined filters are defined in the items of the filter
+// definition and can be nested.
+//
+// This package is a work in progress and makes no API stability promises.
+package composite
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/luids-io/api/event"
+	"github.com/luids-io/event/pkg/eventproc"
+)
+
+// Filter classes registered.
+const (
+	AnyClass = "any"
+	AllClass = "all"
+	NotClass = "not"
+)
+
+// AnyBuilder returns a builder of filters that pass if any of the items pass.
+func AnyBuilder() eventproc.FilterBuilder {
+	return func(b *eventproc.Builder, def *eventproc.ItemDef) (eventproc.ModuleFilter, error) {
+		filters, err := buildItems(b, def)
+		if err != nil {
+			return nil, err
+		}
+		return Any(filters...), nil
+	}
+}
+
+// AllBuilder returns a builder of filters that pass if all of the items pass.
+func AllBuilder() eventproc.FilterBuilder {
+	return func(b *eventproc.Builder, def *eventproc.ItemDef) (eventproc.ModuleFilter, error) {
+		filters, err := buildItems(b, def)
+		if err != nil {
+			return nil, err
+		}
+		return All(filters...), nil
+	}
+}
+
+// NotBuilder returns a builder of filters that negate the result of the
+// item.
+func NotBuilder() eventproc.FilterBuilder {
+	return func(b *eventproc.Builder, def *eventproc.ItemDef) (eventproc.ModuleFilter, error) {
+		if len(def.Items) != 1 {
+			return nil, errors.New("items must be 1")
+		}
+		filters, err := buildItems(b, def)
+		if err != nil {
+			return nil, err
+		}
+		return Not(filters[0]), nil
+	}
+}
+
+func buildItems(b *eventproc.Builder, def *eventproc.ItemDef) ([]eventproc.ModuleFilter, error) {
+	b.Logger().Debugf("building %s filter with %v items", def.Class, len(def.Items))
+	if len(def.Args) > 0 {
+		return nil, errors.New("args not allowed")
+	}
+	if len(def.Items) == 0 {
+		return nil, errors.New("items are required")
+	}
+	filters := make([]eventproc.ModuleFilter, 0, len(def.Items))
+	for idx, item := range def.Items {
+		filter, err := b.BuildFilter(item)
+		if err != nil {
+			return nil, eventproc.WrapItemError(fmt.Sprintf("items[%d]", idx), err)
+		}
+		filters = append(filters, filter)
+	}
+	return filters, nil
+}
+
+// Any returns a filter that passes if any of the filters pass. Filters are
+// evaluated in order until one passes.
+func Any(filters ...eventproc.ModuleFilter) eventproc.ModuleFilter {
+	return func(ctx context.Context, e event.Event) bool {
+		for _, filter := range filters {
+			if filter(ctx, e) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// All returns a filter that passes if all of the filters pass. Filters are
+// evaluated in order until one fails.
+func All(filters ...eventproc.ModuleFilter) eventproc.ModuleFilter {
+	return func(ctx context.Context, e event.Event) bool {
+		for _, filter := range filters {
+			if !filter(ctx, e) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// Not returns a filter that negates the result of the filter.
+func Not(filter eventproc.ModuleFilter) eventproc.ModuleFilter {
+	return func(ctx context.Context, e event.Event) bool {
+		return !filter(ctx, e)
+	}
+}
+
+func init() {
+	eventproc.RegisterFilter(AnyClass, AnyBuilder())
+	eventproc.RegisterFilter(AllClass, AllBuilder())
+	eventproc.RegisterFilter(NotClass, NotBuilder())
+}
@@ -0,0 +1,104 @@
+// Copyright 2019 Luis Guillén Civera <luisguillenc@gmail.com>. See LICENSE.
+
+package composite_test
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/luids-io/api/event"
+	"github.com/luids-io/event/pkg/eventproc"
+	_ "github.com/luids-io/event/pkg/eventproc/filters/basicexpr"
+	_ "github.com/luids-io/event/pkg/eventproc/filters/composite"
+)
+
+func buildFilter(t *testing.T, def string) (eventproc.ModuleFilter, error) {
+	var item eventproc.ItemDef
+	if err := json.Unmarshal([]byte(def), &item); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return eventproc.NewBuilder(nil).BuildFilter(&item)
+}
+
+func TestFilters(t *testing.T) {
+	// level >= high or (code == 2 and not hostname == trusted)
+	filter, err := buildFilter(t, `{
+		"class": "any",
+		"items": [
+			{ "class": "basicexpr", "args": [ "level", ">=", "high" ] },
+			{ "class": "all", "items": [
+				{ "class": "basicexpr", "args": [ "code", "==", "2" ] },
+				{ "class": "not", "items": [
+					{ "class": "basicexpr", "args": [ "source.hostname", "==", "trusted" ] }
+				]}
+			]}
+		]}`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var tests = []struct {
+		code     event.Code
+		level    event.Level
+		hostname string
+		want     bool
+	}{
+		{1, event.High, "trusted", true},
+		{1, event.Low, "other", false},
+		{2, event.Low, "other", true},
+		{2, event.Low, "trusted", false},
+		{2, event.Critical, "trusted", true},
+	}
+	for idx, test := range tests {
+		e := event.New(test.code, test.level)
+		e.Source.Hostname = test.hostname
+		if got := filter(context.Background(), e); got != test.want {
+			t.Errorf("idx[%v] got %v; want %v", idx, got, test.want)
+		}
+	}
+}
+
+func TestBuildErrors(t *testing.T) {
+	var tests = []struct {
+		def  string
+		want string
+	}{
+		{`{"class": "any"}`, "items are required"},
+		{`{"class": "not", "items": [{"class": "any"}, {"class": "any"}]}`, "items must be 1"},
+		{`{"class": "all", "args": ["a"], "items": [{"class": "any"}]}`, "args not allowed"},
+		{`{"class": "any", "items": [
+			{"class": "basicexpr", "args": ["code", "==", "1"]},
+			{"class": "not", "items": [{"class": "notfound"}]}
+		]}`, "items[1].items[0]: filter builder for 'notfound' not found"},
+		{`{"class": "all", "items": [{"class": "basicexpr", "args": ["code", "~", "1"]}]}`, "items[0]: invalid operator"},
+	}
+	for idx, test := range tests {
+		_, err := buildFilter(t, test.def)
+		if err == nil {
+			t.Errorf("idx[%v] expected error", idx)
+			continue
+		}
+		if !strings.HasPrefix(err.Error(), test.want) {
+			t.Errorf("idx[%v] got %v; want %v", idx, err, test.want)
+		}
+	}
+}
+
+func TestModulePath(t *testing.T) {
+	b := eventproc.NewBuilder(nil)
+	_, err := b.Build(eventproc.StackDef{
+		Name: "main",
+		Modules: []eventproc.ModuleDef{{
+			Name: "m1",
+			Filters: []*eventproc.ItemDef{
+				{Class: "basicexpr", Args: []string{"code", "==", "1"}},
+				{Class: "all", Items: []*eventproc.ItemDef{{Class: "notfound"}}},
+			},
+		}},
+	})
+	want := "building module 'm1': filters[1].items[0]: filter builder for 'notfound' not found"
+	if err == nil || err.Error() != want {
+		t.Errorf("got %v; want %v", err, want)
+	}
+}
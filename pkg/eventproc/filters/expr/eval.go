@@ -0,0 +1,530 @@
+// Copyright 2019 Luis Guillén Civera <luisguillenc@gmail.com>. View LICENSE.
+
+package expr
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/luids-io/api/event"
+	"github.com/luids-io/event/pkg/eventproc"
+)
+
+type kind uint8
+
+const (
+	kindNull kind = iota
+	kindBool
+	kindNumber
+	kindString
+	kindTime
+	kindList
+)
+
+// value is the result of evaluating an operand. Lists of strings are stored
+// in ss to avoid conversions of the event fields.
+type value struct {
+	kind kind
+	b    bool
+	n    float64
+	s    string
+	t    time.Time
+	ss   []string
+	l    []value
+}
+
+func boolValue(b bool) value         { return value{kind: kindBool, b: b} }
+func numberValue(n float64) value    { return value{kind: kindNumber, n: n} }
+func stringValue(s string) value     { return value{kind: kindString, s: s} }
+func timeValue(t time.Time) value    { return value{kind: kindTime, t: t} }
+func listValue(l []value) value      { return value{kind: kindList, l: l} }
+func stringsValue(ss []string) value { return value{kind: kindList, ss: ss} }
+
+// fromInterface converts the values stored in the data of the events.
+func fromInterface(i interface{}) value {
+	switch v := i.(type) {
+	case nil:
+		return value{}
+	case string:
+		return stringValue(v)
+	case bool:
+		return boolValue(v)
+	case int:
+		return numberValue(float64(v))
+	case int8:
+		return numberValue(float64(v))
+	case int16:
+		return numberValue(float64(v))
+	case int32:
+		return numberValue(float64(v))
+	case int64:
+		return numberValue(float64(v))
+	case uint:
+		return numberValue(float64(v))
+	case uint8:
+		return numberValue(float64(v))
+	case uint16:
+		return numberValue(float64(v))
+	case uint32:
+		return numberValue(float64(v))
+	case uint64:
+		return numberValue(float64(v))
+	case float32:
+		return numberValue(float64(v))
+	case float64:
+		return numberValue(v)
+	case time.Time:
+		return timeValue(v)
+	case []string:
+		return stringsValue(v)
+	case []interface{}:
+		l := make([]value, 0, len(v))
+		for _, item := range v {
+			l = append(l, fromInterface(item))
+		}
+		return listValue(l)
+	}
+	return stringValue(fmt.Sprintf("%v", i))
+}
+
+func (v value) truthy() bool {
+	switch v.kind {
+	case kindBool:
+		return v.b
+	case kindNumber:
+		return v.n != 0
+	case kindString:
+		return v.s != ""
+	case kindTime:
+		return !v.t.IsZero()
+	case kindList:
+		return len(v.ss) > 0 || len(v.l) > 0
+	}
+	return false
+}
+
+// coerce converts strings compared with numbers or booleans, so the values
+// stored as strings in the data of the events can be compared with literals
+// and vice versa. If the string can't be converted, the number is converted
+// to a string.
+func coerce(a, b value) (value, value) {
+	if a.kind == kindString && (b.kind == kindNumber || b.kind == kindBool) {
+		b, a = coerce(b, a)
+		return a, b
+	}
+	if b.kind != kindString {
+		return a, b
+	}
+	switch a.kind {
+	case kindNumber:
+		if n, ok := eventproc.AsFloat(b.s); ok {
+			return a, numberValue(n)
+		}
+		s, _ := eventproc.AsString(a.n)
+		return stringValue(s), b
+	case kindBool:
+		if v, ok := eventproc.AsBool(b.s); ok {
+			return a, boolValue(v)
+		}
+	}
+	return a, b
+}
+
+func equal(a, b value) bool {
+	a, b = coerce(a, b)
+	if a.kind != b.kind {
+		return false
+	}
+	switch a.kind {
+	case kindBool:
+		return a.b == b.b
+	case kindNumber:
+		return a.n == b.n
+	case kindString:
+		return a.s == b.s
+	case kindTime:
+		return a.t.Equal(b.t)
+	}
+	return false
+}
+
+// order returns -1, 0 or 1 comparing a and b, it returns false if the values
+// can't be ordered.
+func order(a, b value) (int, bool) {
+	a, b = coerce(a, b)
+	if a.kind != b.kind {
+		return 0, false
+	}
+	switch a.kind {
+	case kindNumber:
+		switch {
+		case a.n < b.n:
+			return -1, true
+		case a.n > b.n:
+			return 1, true
+		}
+		return 0, true
+	case kindString:
+		return strings.Compare(a.s, b.s), true
+	case kindTime:
+		switch {
+		case a.t.Before(b.t):
+			return -1, true
+		case a.t.After(b.t):
+			return 1, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// member returns true if x is an item of the list. If list is a string, it
+// returns true if x is a substring.
+func member(list, x value) bool {
+	if x.kind == kindNumber && (list.kind == kindString || len(list.ss) > 0) {
+		s, _ := eventproc.AsString(x.n)
+		x = stringValue(s)
+	}
+	switch list.kind {
+	case kindString:
+		return x.kind == kindString && strings.Contains(list.s, x.s)
+	case kindList:
+		if x.kind == kindString {
+			for _, s := range list.ss {
+				if s == x.s {
+					return true
+				}
+			}
+		}
+		for _, item := range list.l {
+			if equal(item, x) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// getter returns the value of an operand, it returns false if the field is
+// not set in the event.
+type getter func(e *event.Event) (value, bool)
+
+// fields of the events, data fields are resolved using eventproc.Field.
+var fields = map[string]getter{
+	"id":          func(e *event.Event) (value, bool) { return stringValue(e.ID), true },
+	"code":        func(e *event.Event) (value, bool) { return numberValue(float64(e.Code)), true },
+	"codename":    func(e *event.Event) (value, bool) { return stringValue(e.Codename), true },
+	"description": func(e *event.Event) (value, bool) { return stringValue(e.Description), true },
+	"level":       func(e *event.Event) (value, bool) { return numberValue(float64(e.Level)), true },
+	"type":        func(e *event.Event) (value, bool) { return stringValue(e.Type.String()), true },
+	"tags":        func(e *event.Event) (value, bool) { return stringsValue(e.Tags), true },
+	"duplicates":  func(e *event.Event) (value, bool) { return numberValue(float64(e.Duplicates)), true },
+	"created":     func(e *event.Event) (value, bool) { return timeValue(e.Created), true },
+	"received":    func(e *event.Event) (value, bool) { return timeValue(e.Received), true },
+	"processors": func(e *event.Event) (value, bool) {
+		hosts := make([]string, 0, len(e.Processors))
+		for _, p := range e.Processors {
+			hosts = append(hosts, p.Processor.Hostname)
+		}
+		return stringsValue(hosts), true
+	},
+	"source.hostname": func(e *event.Event) (value, bool) { return stringValue(e.Source.Hostname), true },
+	"source.program":  func(e *event.Event) (value, bool) { return stringValue(e.Source.Program), true },
+	"source.instance": func(e *event.Event) (value, bool) { return stringValue(e.Source.Instance), true },
+	"source.pid":      func(e *event.Event) (value, bool) { return numberValue(float64(e.Source.PID)), true },
+}
+
+var types = map[string]event.Type{
+	"undefined": event.Undefined,
+	"security":  event.Security,
+}
+
+var levels = map[string]event.Level{
+	"info":     event.Info,
+	"low":      event.Low,
+	"medium":   event.Medium,
+	"high":     event.High,
+	"critical": event.Critical,
+}
+
+func dataGetter(get eventproc.FieldGetter) getter {
+	return func(e *event.Event) (value, bool) {
+		v, ok := get(e)
+		if !ok {
+			return value{}, false
+		}
+		return fromInterface(v), true
+	}
+}
+
+func lookupField(name string) (getter, error) {
+	if get, ok := fields[name]; ok {
+		return get, nil
+	}
+	if strings.HasPrefix(name, "data.") {
+		get, err := eventproc.Field(name)
+		if err != nil {
+			return nil, err
+		}
+		return dataGetter(get), nil
+	}
+	return nil, fmt.Errorf("unknown field '%s'", name)
+}
+
+// evalFn is the compiled expression.
+type evalFn func(e *event.Event) bool
+
+func compile(n node) (evalFn, error) {
+	switch n := n.(type) {
+	case *logicalNode:
+		left, err := compile(n.left)
+		if err != nil {
+			return nil, err
+		}
+		right, err := compile(n.right)
+		if err != nil {
+			return nil, err
+		}
+		if n.op == "and" {
+			return func(e *event.Event) bool { return left(e) && right(e) }, nil
+		}
+		return func(e *event.Event) bool { return left(e) || right(e) }, nil
+	case *notNode:
+		x, err := compile(n.x)
+		if err != nil {
+			return nil, err
+		}
+		return func(e *event.Event) bool { return !x(e) }, nil
+	case *compareNode:
+		return compileCompare(n)
+	case *fieldNode:
+		get, err := lookupField(n.name)
+		if err != nil {
+			return nil, errorf(n.pos, "%v", err)
+		}
+		return func(e *event.Event) bool {
+			v, ok := get(e)
+			return ok && v.truthy()
+		}, nil
+	case *literalNode:
+		if n.v.kind != kindBool {
+			return nil, errorf(n.pos, "expected a condition")
+		}
+		result := n.v.b
+		return func(e *event.Event) bool { return result }, nil
+	}
+	return nil, errorf(n.position(), "invalid expression")
+}
+
+// operand is a compiled operand of a comparison.
+type operand struct {
+	get   getter
+	field string
+	lit   *literalNode
+	pos   int
+}
+
+func compileOperand(n node) (operand, error) {
+	switch n := n.(type) {
+	case *fieldNode:
+		get, err := lookupField(n.name)
+		if err != nil {
+			return operand{}, errorf(n.pos, "%v", err)
+		}
+		return operand{get: get, field: n.name, pos: n.pos}, nil
+	case *literalNode:
+		// getter is set once the literal is converted
+		return operand{lit: n, pos: n.pos}, nil
+	}
+	return operand{}, errorf(n.position(), "invalid operand")
+}
+
+func constant(v value) getter {
+	return func(e *event.Event) (value, bool) { return v, true }
+}
+
+// bareValue converts identifiers that are not fields into strings when they
+// are compared with level or type, so "level >= high" is valid.
+func bareValue(field node, n node) node {
+	f, ok := field.(*fieldNode)
+	if !ok || (f.name != "level" && f.name != "type") {
+		return n
+	}
+	ident, ok := n.(*fieldNode)
+	if !ok {
+		return n
+	}
+	if _, err := lookupField(ident.name); err == nil {
+		return n
+	}
+	return &literalNode{v: stringValue(ident.name), pos: ident.pos, str: true}
+}
+
+// convertLiteral converts the literal compared with a field to the type of
+// the field.
+func convertLiteral(field string, lit *literalNode) error {
+	convert := func(v value, pos int) (value, error) {
+		if v.kind != kindString {
+			return v, nil
+		}
+		switch field {
+		case "level":
+			level, ok := levels[strings.ToLower(v.s)]
+			if !ok {
+				return v, errorf(pos, "invalid level '%s'", v.s)
+			}
+			return numberValue(float64(level)), nil
+		case "type":
+			t, ok := types[strings.ToLower(v.s)]
+			if !ok {
+				return v, errorf(pos, "invalid type '%s'", v.s)
+			}
+			return stringValue(t.String()), nil
+		case "created", "received":
+			t, err := time.Parse(time.RFC3339, v.s)
+			if err != nil {
+				return v, errorf(pos, "invalid time '%s', expected RFC3339 format", v.s)
+			}
+			return timeValue(t), nil
+		}
+		return v, nil
+	}
+	if lit.v.kind == kindList {
+		l := make([]value, 0, len(lit.v.l))
+		for _, item := range lit.v.l {
+			v, err := convert(item, lit.pos)
+			if err != nil {
+				return err
+			}
+			l = append(l, v)
+		}
+		lit.v = listValue(l)
+		return nil
+	}
+	v, err := convert(lit.v, lit.pos)
+	if err != nil {
+		return err
+	}
+	lit.v = v
+	return nil
+}
+
+func compileCompare(n *compareNode) (evalFn, error) {
+	left, err := compileOperand(bareValue(n.right, n.left))
+	if err != nil {
+		return nil, err
+	}
+	right, err := compileOperand(bareValue(n.left, n.right))
+	if err != nil {
+		return nil, err
+	}
+	for _, o := range [][2]operand{{left, right}, {right, left}} {
+		lit, other := o[0].lit, o[1].field
+		if lit != nil && lit.bare && other != "level" && other != "type" {
+			return nil, errorf(lit.pos, "identifiers in lists are only allowed with level and type")
+		}
+	}
+	if left.field != "" && right.lit != nil {
+		if err := convertLiteral(left.field, right.lit); err != nil {
+			return nil, err
+		}
+	}
+	if right.field != "" && left.lit != nil {
+		if err := convertLiteral(right.field, left.lit); err != nil {
+			return nil, err
+		}
+	}
+	for _, o := range []*operand{&left, &right} {
+		if o.lit != nil {
+			o.get = constant(o.lit.v)
+		}
+	}
+	var cmp func(l, r value) bool
+	switch n.op {
+	case "==":
+		cmp = equal
+	case "!=":
+		cmp = func(l, r value) bool { return !equal(l, r) }
+	case "<", "<=", ">", ">=":
+		for _, o := range []operand{left, right} {
+			if o.lit != nil && (o.lit.v.kind == kindBool || o.lit.v.kind == kindList) {
+				return nil, errorf(o.pos, "operator '%s' requires numbers, strings or times", n.op)
+			}
+		}
+		op := n.op
+		cmp = func(l, r value) bool {
+			c, ok := order(l, r)
+			if !ok {
+				return false
+			}
+			switch op {
+			case "<":
+				return c < 0
+			case "<=":
+				return c <= 0
+			case ">":
+				return c > 0
+			}
+			return c >= 0
+		}
+	case "in":
+		if right.lit != nil && right.lit.v.kind != kindList && right.lit.v.kind != kindString {
+			return nil, errorf(right.pos, "operator 'in' requires a list or a string")
+		}
+		cmp = func(l, r value) bool { return member(r, l) }
+	case "contains":
+		if left.lit != nil && left.lit.v.kind != kindList && left.lit.v.kind != kindString {
+			return nil, errorf(left.pos, "operator 'contains' requires a list or a string")
+		}
+		if right.lit != nil && right.lit.v.kind == kindList {
+			return nil, errorf(right.pos, "operator 'contains' requires a string, a number or a boolean")
+		}
+		cmp = member
+	case "matches":
+		if right.lit == nil || !right.lit.str {
+			return nil, errorf(right.pos, "operator 'matches' requires a string with a regular expression")
+		}
+		re, err := regexp.Compile(right.lit.v.s)
+		if err != nil {
+			return nil, errorf(right.pos, "invalid regular expression: %v", err)
+		}
+		cmp = func(l, r value) bool { return matches(re, l) }
+	default:
+		return nil, errorf(n.pos, "invalid operator '%s'", n.op)
+	}
+	lget, rget := left.get, right.get
+	return func(e *event.Event) bool {
+		l, ok := lget(e)
+		if !ok {
+			return false
+		}
+		r, ok := rget(e)
+		if !ok {
+			return false
+		}
+		return cmp(l, r)
+	}, nil
+}
+
+// matches returns true if the value is a string that matches the regular
+// expression or a list with any string that matches it.
+func matches(re *regexp.Regexp, v value) bool {
+	switch v.kind {
+	case kindString:
+		return re.MatchString(v.s)
+	case kindList:
+		for _, s := range v.ss {
+			if re.MatchString(s) {
+				return true
+			}
+		}
+		for _, item := range v.l {
+			if item.kind == kindString && re.MatchString(item.s) {
+				return true
+			}
+		}
+	}
+	return false
+}
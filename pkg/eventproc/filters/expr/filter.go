@@ -0,0 +1,65 @@
+// Copyright 2019 Luis Guillén Civera <luisguillenc@gmail.com>. View LICENSE.
+
+// Package expr implements an expression language filter for event
+// processing. Expressions are compiled when the filter is built, for
+// example:
+//
+//	level >= high and (tags contains "honeypot" or source.hostname in ["fw1", "fw2"])
+//
+// Operators are ==, !=, <, <=, >, >=, in, contains and matches (regular
+// expressions), conditions can be combined using and (&&), or (||), not (!)
+// and parentheses. Available fields are id, code, codename, description,
+// level, type, tags, duplicates, created, received, processors (hostnames of
+// the processors), source.hostname, source.program, source.instance,
+// source.pid and data.<path>, with paths of nested data as in
+// eventproc.DataPath (e.g. data.answers[0].ip). Levels and types can be
+// compared using their names, also in lists (level in [high, critical]), and
+// times using strings in RFC3339 format. Unknown names are rejected. Strings
+// are converted when compared with numbers or booleans, so data.port == "53"
+// matches numeric values. The operator contains checks a single value, use in
+// to check lists. Comparisons with fields that are not set in the event are
+// false.
+//
+// This package is a work in progress and makes no API stability promises.
+package expr
+
+import (
+	"errors"
+
+	"github.com/luids-io/api/event"
+	"github.com/luids-io/event/pkg/eventproc"
+)
+
+// FilterClass registered.
+const FilterClass = "expr"
+
+// Builder returns a filter builder.
+func Builder() eventproc.FilterBuilder {
+	return func(b *eventproc.Builder, def *eventproc.ItemDef) (eventproc.ModuleFilter, error) {
+		b.Logger().Debugf("building filter with args: %v", def.Args)
+		if len(def.Args) != 1 {
+			return nil, errors.New("args must be 1")
+		}
+		return New(def.Args[0])
+	}
+}
+
+// New returns a filter for the expression passed. If the expression is not
+// valid, the error returned is an *Error with the position.
+func New(s string) (eventproc.ModuleFilter, error) {
+	tree, err := parse(s)
+	if err != nil {
+		return nil, err
+	}
+	fn, err := compile(tree)
+	if err != nil {
+		return nil, err
+	}
+	return eventproc.FilterFunc(func(e event.Event) bool {
+		return fn(&e)
+	}), nil
+}
+
+func init() {
+	eventproc.RegisterFilter(FilterClass, Builder())
+}
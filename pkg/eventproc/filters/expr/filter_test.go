@@ -0,0 +1,143 @@
+// Copyright 2019 Luis Guillén Civera <luisguillenc@gmail.com>. See LICENSE.
+
+package expr_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/luids-io/api/event"
+	"github.com/luids-io/event/pkg/eventproc/filters/expr"
+)
+
+func testEvent() event.Event {
+	e := event.New(10001, event.High)
+	e.Type = event.Security
+	e.Codename = "dns.blacklisted"
+	e.Tags = []string{"honeypot", "dns"}
+	e.Source = event.Source{Hostname: "fw1", Program: "dnsd", PID: 100}
+	e.Received = time.Date(2020, 5, 1, 10, 0, 0, 0, time.UTC)
+	e.Processors = []event.ProcessInfo{{Processor: event.Source{Hostname: "proc1"}}}
+	e.Data = map[string]interface{}{
+		"name":  "www.example.com",
+		"port":  53,
+		"score": 0.75,
+		"ok":    true,
+		"año":   "2020",
+		"ips":   []interface{}{"10.0.0.1", "10.0.0.2"},
+		"dns": map[string]interface{}{
+			"answers": []interface{}{map[string]interface{}{"ip": "10.1.1.1", "ttl": float64(300)}},
+		},
+	}
+	return e
+}
+
+func TestFilter(t *testing.T) {
+	var tests = []struct {
+		expr string
+		want bool
+	}{
+		{`code == 10001`, true},
+		{`code != 10001`, false},
+		{`codename == "dns.blacklisted"`, true},
+		{`level >= high`, true},
+		{`level > "high"`, false},
+		{`level in ["high", "critical"]`, true},
+		{`type == security`, true},
+		{`tags contains "honeypot"`, true},
+		{`"dns" in tags`, true},
+		{`tags matches "^honey"`, true},
+		{`source.hostname in ['fw1', 'fw2'] && source.pid < 1000`, true},
+		{`source.program matches "^dns[a-z]$"`, true},
+		{`data.name matches "example\\.com$"`, true},
+		{`data.name contains "example"`, true},
+		{`data.port == 53 and data.score >= 0.5`, true},
+		{`data.ok`, true},
+		{`data.notset`, false},
+		{`data.notset != 1`, false},
+		{`not data.notset`, true},
+		{`"10.0.0.2" in data.ips`, true},
+		{`data.ips[1] == "10.0.0.2"`, true},
+		{`data.dns.answers[0].ttl >= 300 and data.dns.answers[0].ip matches "^10\\."`, true},
+		{`data.dns.answers[1].ip`, false},
+		{`processors contains "proc1"`, true},
+		{`received > "2020-01-01T00:00:00Z"`, true},
+		{`received < "2020-01-01T00:00:00Z"`, false},
+		{`level < medium or tags contains "dns"`, true},
+		{`(level < medium or tags contains "x") and code == 10001`, false},
+		{`level < medium or tags contains "x" and code == 10001`, false},
+		{`!(code == 1) && (false || true)`, true},
+		{`NOT code == 1 AND code == 10001`, true},
+		{`level in [high, critical]`, true},
+		{`NOT level in [low, medium]`, true},
+		{`type in [security]`, true},
+		{`type != "Undefined"`, true},
+		{`type in ["undefined"]`, false},
+		{`data.año == "2020"`, true},
+		{`data.port == "53"`, true},
+		{`"53" == data.port`, true},
+		{`data.port > "50"`, true},
+		{`data.año == 2020`, true},
+		{`data.port in ["53", "80"]`, true},
+		{`data.name == 53`, false},
+		{`data.ok == "true"`, true},
+		{`53 in data.name`, false},
+	}
+	e := testEvent()
+	for idx, test := range tests {
+		filter, err := expr.New(test.expr)
+		if err != nil {
+			t.Errorf("idx[%v] unexpected error: %v", idx, err)
+			continue
+		}
+		if got := filter(context.Background(), e); got != test.want {
+			t.Errorf("idx[%v] %s: got %v; want %v", idx, test.expr, got, test.want)
+		}
+	}
+}
+
+func TestErrors(t *testing.T) {
+	var tests = []struct {
+		expr string
+		pos  int
+		want string
+	}{
+		{``, 1, "position 1: empty expression"},
+		{`code == `, 9, "position 9: unexpected end of expression"},
+		{`code = 1`, 6, "position 6: unexpected character '='"},
+		{`codes == 1`, 1, "position 1: unknown field 'codes'"},
+		{`data.a..b == 1`, 1, "position 1: invalid field 'data.a..b': empty key in 'a..b'"},
+		{`code == 1 and (level > low`, 15, "position 15: unclosed parenthesis"},
+		{`code == 1)`, 10, "position 10: unexpected ')'"},
+		{`level >= hihg`, 10, "position 10: invalid level 'hihg'"},
+		{`data.name matches "(["`, 19, "position 19: invalid regular expression: error parsing regexp: missing closing ]: `[`"},
+		{`data.name matches data.other`, 19, "position 19: operator 'matches' requires a string with a regular expression"},
+		{`code in 1`, 9, "position 9: operator 'in' requires a list or a string"},
+		{`code in [1, code]`, 9, "position 9: identifiers in lists are only allowed with level and type"},
+		{`type == foo`, 9, "position 9: invalid type 'foo'"},
+		{`type in [security, foo]`, 9, "position 9: invalid type 'foo'"},
+		{`tags contains ["a"]`, 15, "position 15: operator 'contains' requires a string, a number or a boolean"},
+		{`code in [1, [2]]`, 13, "position 13: list items must be identifiers, strings, numbers or booleans"},
+		{`code ≈ 1`, 6, "position 6: unexpected character '≈'"},
+		{`received > "yesterday"`, 12, "position 12: invalid time 'yesterday', expected RFC3339 format"},
+		{`"unterminated`, 1, "position 1: unterminated string"},
+		{`code == 1 2`, 11, "position 11: unexpected '2'"},
+		{`"text"`, 1, "position 1: expected a condition"},
+	}
+	for idx, test := range tests {
+		_, err := expr.New(test.expr)
+		if err == nil {
+			t.Errorf("idx[%v] expected error", idx)
+			continue
+		}
+		perr, ok := err.(*expr.Error)
+		if !ok {
+			t.Errorf("idx[%v] unexpected error type: %T", idx, err)
+			continue
+		}
+		if perr.Pos != test.pos || err.Error() != test.want {
+			t.Errorf("idx[%v] got %v (%v); want %v", idx, err, perr.Pos, test.want)
+		}
+	}
+}
@@ -0,0 +1,207 @@
+// Copyright 2019 Luis Guillén Civera <luisguillenc@gmail.com>. View LICENSE.
+
+package expr
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Error is returned when an expression is not valid. Pos is the position of
+// the error in the expression, starting at 1.
+type Error struct {
+	Pos int
+	Msg string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("position %d: %s", e.Pos, e.Msg)
+}
+
+func errorf(pos int, format string, args ...interface{}) error {
+	return &Error{Pos: pos + 1, Msg: fmt.Sprintf(format, args...)}
+}
+
+type tokenKind uint8
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokString
+	tokNumber
+	tokOp
+	tokLParen
+	tokRParen
+	tokLBracket
+	tokRBracket
+	tokComma
+)
+
+type token struct {
+	kind tokenKind
+	// text is the operator, the identifier or the unquoted string
+	text string
+	pos  int
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokEOF:
+		return "end of expression"
+	case tokString:
+		return strconv.Quote(t.text)
+	}
+	return fmt.Sprintf("'%s'", t.text)
+}
+
+// keywords used as operators.
+var keywords = map[string]string{
+	"and":      "and",
+	"or":       "or",
+	"not":      "not",
+	"in":       "in",
+	"contains": "contains",
+	"matches":  "matches",
+}
+
+// lex splits the expression in tokens, the last one is always tokEOF.
+func lex(s string) ([]token, error) {
+	var tokens []token
+	pos := 0
+	for pos < len(s) {
+		c := s[pos]
+		r, size := utf8.DecodeRuneInString(s[pos:])
+		switch {
+		case unicode.IsSpace(r):
+			pos += size
+		case c == '(':
+			tokens = append(tokens, token{kind: tokLParen, text: "(", pos: pos})
+			pos++
+		case c == ')':
+			tokens = append(tokens, token{kind: tokRParen, text: ")", pos: pos})
+			pos++
+		case c == '[':
+			tokens = append(tokens, token{kind: tokLBracket, text: "[", pos: pos})
+			pos++
+		case c == ']':
+			tokens = append(tokens, token{kind: tokRBracket, text: "]", pos: pos})
+			pos++
+		case c == ',':
+			tokens = append(tokens, token{kind: tokComma, text: ",", pos: pos})
+			pos++
+		case c == '"' || c == '\'':
+			text, end, err := lexString(s, pos)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, token{kind: tokString, text: text, pos: pos})
+			pos = end
+		case c == '-' || (c >= '0' && c <= '9'):
+			end := pos + 1
+			for end < len(s) && (s[end] == '.' || (s[end] >= '0' && s[end] <= '9')) {
+				end++
+			}
+			if _, err := strconv.ParseFloat(s[pos:end], 64); err != nil {
+				return nil, errorf(pos, "invalid number '%s'", s[pos:end])
+			}
+			tokens = append(tokens, token{kind: tokNumber, text: s[pos:end], pos: pos})
+			pos = end
+		case isIdentChar(r):
+			end := pos
+			for end < len(s) {
+				if r, size := utf8.DecodeRuneInString(s[end:]); isIdentChar(r) {
+					end += size
+					continue
+				}
+				// indexes of data paths
+				if n := indexLen(s[end:]); n > 0 && strings.HasPrefix(s[pos:end], "data.") {
+					end += n
+					continue
+				}
+				break
+			}
+			word := s[pos:end]
+			if op, ok := keywords[strings.ToLower(word)]; ok {
+				tokens = append(tokens, token{kind: tokOp, text: op, pos: pos})
+			} else {
+				tokens = append(tokens, token{kind: tokIdent, text: word, pos: pos})
+			}
+			pos = end
+		default:
+			op := ""
+			for _, candidate := range []string{"==", "!=", "<=", ">=", "&&", "||", "<", ">", "!"} {
+				if strings.HasPrefix(s[pos:], candidate) {
+					op = candidate
+					break
+				}
+			}
+			if op == "" {
+				return nil, errorf(pos, "unexpected character '%c'", r)
+			}
+			tokens = append(tokens, token{kind: tokOp, text: normalizeOp(op), pos: pos})
+			pos += len(op)
+		}
+	}
+	tokens = append(tokens, token{kind: tokEOF, pos: len(s)})
+	return tokens, nil
+}
+
+func normalizeOp(op string) string {
+	switch op {
+	case "&&":
+		return "and"
+	case "||":
+		return "or"
+	case "!":
+		return "not"
+	}
+	return op
+}
+
+func isIdentChar(c rune) bool {
+	return c == '_' || c == '.' || unicode.IsLetter(c) || unicode.IsDigit(c)
+}
+
+// indexLen returns the length of the index at the start of s, in the
+// format "[n]". It returns 0 if there is no index.
+func indexLen(s string) int {
+	if !strings.HasPrefix(s, "[") {
+		return 0
+	}
+	end := 1
+	for end < len(s) && s[end] >= '0' && s[end] <= '9' {
+		end++
+	}
+	if end == 1 || end >= len(s) || s[end] != ']' {
+		return 0
+	}
+	return end + 1
+}
+
+// lexString returns the unquoted string starting at pos and the position
+// after the closing quote. Escape sequences are only allowed in double
+// quoted strings.
+func lexString(s string, pos int) (string, int, error) {
+	quote := s[pos]
+	end := pos + 1
+	for end < len(s) && s[end] != quote {
+		if quote == '"' && s[end] == '\\' {
+			end++
+		}
+		end++
+	}
+	if end >= len(s) {
+		return "", 0, errorf(pos, "unterminated string")
+	}
+	if quote == '\'' {
+		return s[pos+1 : end], end + 1, nil
+	}
+	text, err := strconv.Unquote(s[pos : end+1])
+	if err != nil {
+		return "", 0, errorf(pos, "invalid string %s", s[pos:end+1])
+	}
+	return text, end + 1, nil
+}
@@ -0,0 +1,247 @@
+// Copyright 2019 Luis Guillén Civera <luisguillenc@gmail.com>. View LICENSE.
+
+package expr
+
+import (
+	"strconv"
+)
+
+// node of the syntax tree.
+type node interface {
+	position() int
+}
+
+// logicalNode is an and/or operation.
+type logicalNode struct {
+	op          string
+	left, right node
+	pos         int
+}
+
+// notNode negates the result of x.
+type notNode struct {
+	x   node
+	pos int
+}
+
+// compareNode compares two operands.
+type compareNode struct {
+	op          string
+	left, right node
+	pos         int
+}
+
+// fieldNode references a field of the event.
+type fieldNode struct {
+	name string
+	pos  int
+}
+
+// literalNode is a string, number, boolean or list literal.
+type literalNode struct {
+	v   value
+	pos int
+	// str is true if the literal is a string
+	str bool
+	// bare is true if the literal is a list with identifiers
+	bare bool
+}
+
+func (n *logicalNode) position() int { return n.pos }
+func (n *notNode) position() int     { return n.pos }
+func (n *compareNode) position() int { return n.pos }
+func (n *fieldNode) position() int   { return n.pos }
+func (n *literalNode) position() int { return n.pos }
+
+// parser implements a recursive descent parser with the grammar:
+//
+//	expr       = and { "or" and }
+//	and        = unary { "and" unary }
+//	unary      = "not" unary | primary
+//	primary    = "(" expr ")" | comparison
+//	comparison = operand [ compareop operand ]
+//	operand    = field | string | number | "true" | "false" | list
+//	list       = "[" [ item { "," item } ] "]"
+//	item       = ident | string | number | "true" | "false"
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func parse(s string) (node, error) {
+	tokens, err := lex(s)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	if p.peek().kind == tokEOF {
+		return nil, errorf(0, "empty expression")
+	}
+	n, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, errorf(t.pos, "unexpected %v", t)
+	}
+	return n, nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) isOp(ops ...string) bool {
+	t := p.peek()
+	if t.kind != tokOp {
+		return false
+	}
+	for _, op := range ops {
+		if t.text == op {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp("or") {
+		t := p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &logicalNode{op: "or", left: left, right: right, pos: t.pos}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp("and") {
+		t := p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &logicalNode{op: "and", left: left, right: right, pos: t.pos}
+	}
+	return left, nil
+}
+
+func (p *parser) parseUnary() (node, error) {
+	if p.isOp("not") {
+		t := p.next()
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &notNode{x: x, pos: t.pos}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	if p.peek().kind == tokLParen {
+		open := p.next()
+		x, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if t := p.next(); t.kind != tokRParen {
+			if t.kind == tokEOF {
+				return nil, errorf(open.pos, "unclosed parenthesis")
+			}
+			return nil, errorf(t.pos, "expected ')', found %v", t)
+		}
+		return x, nil
+	}
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	if !p.isOp("==", "!=", "<", "<=", ">", ">=", "in", "contains", "matches") {
+		return left, nil
+	}
+	t := p.next()
+	right, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	return &compareNode{op: t.text, left: left, right: right, pos: t.pos}, nil
+}
+
+func (p *parser) parseOperand() (node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokIdent:
+		switch t.text {
+		case "true":
+			return &literalNode{v: boolValue(true), pos: t.pos}, nil
+		case "false":
+			return &literalNode{v: boolValue(false), pos: t.pos}, nil
+		}
+		return &fieldNode{name: t.text, pos: t.pos}, nil
+	case tokString:
+		return &literalNode{v: stringValue(t.text), pos: t.pos, str: true}, nil
+	case tokNumber:
+		n, _ := strconv.ParseFloat(t.text, 64)
+		return &literalNode{v: numberValue(n), pos: t.pos}, nil
+	case tokLBracket:
+		return p.parseList(t)
+	case tokEOF:
+		return nil, errorf(t.pos, "unexpected end of expression")
+	}
+	return nil, errorf(t.pos, "unexpected %v", t)
+}
+
+func (p *parser) parseList(open token) (node, error) {
+	list := make([]value, 0)
+	if p.peek().kind == tokRBracket {
+		p.next()
+		return &literalNode{v: listValue(list), pos: open.pos}, nil
+	}
+	bare := false
+	for {
+		item, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		switch n := item.(type) {
+		case *fieldNode:
+			// identifiers are bare values, such as levels
+			bare = true
+			list = append(list, stringValue(n.name))
+		case *literalNode:
+			if n.v.kind == kindList {
+				return nil, errorf(item.position(), "list items must be identifiers, strings, numbers or booleans")
+			}
+			list = append(list, n.v)
+		}
+		t := p.next()
+		switch t.kind {
+		case tokComma:
+			continue
+		case tokRBracket:
+			return &literalNode{v: listValue(list), pos: open.pos, bare: bare}, nil
+		case tokEOF:
+			return nil, errorf(open.pos, "unclosed list")
+		}
+		return nil, errorf(t.pos, "expected ',' or ']', found %v", t)
+	}
+}
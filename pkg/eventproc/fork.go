@@ -0,0 +1,192 @@
+// Copyright 2019 Luis Guillén Civera <luisguillenc@gmail.com>. View LICENSE.
+
+package eventproc
+
+import (
+	"context"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/luids-io/api/event"
+)
+
+// DefaultForkWorkers is the default number of goroutines used to process
+// forked events.
+const DefaultForkWorkers = 4
+
+// ForkWorkers option defines the number of goroutines used to process the
+// events forked by the fork action. The size of the fork buffer is the size
+// of the event request buffer, when it's full the forked events are dropped.
+func ForkWorkers(n int) Option {
+	return func(o *options) {
+		if n > 0 {
+			o.forkWorkers = n
+		}
+	}
+}
+
+// forker processes the forked requests asynchronously.
+type forker struct {
+	mu     sync.Mutex
+	c      chan *forkRequest
+	closed bool
+	wg     sync.WaitGroup
+	// counters
+	forked    uint64
+	dropped   uint64
+	abandoned uint64
+}
+
+type forkRequest struct {
+	pl    *pipeline
+	stack *Stack
+	req   *Request
+}
+
+func newForker(workers, size int) *forker {
+	f := &forker{c: make(chan *forkRequest, size)}
+	f.wg.Add(workers)
+	return f
+}
+
+// fork sends a copy of the request to be processed in the stack passed.
+func (p *Processor) fork(pl *pipeline, stack *Stack, from string, e *Request) {
+	f := p.forker
+	jumps := make([]string, 0, len(e.jumps)+1)
+	jumps = append(jumps, e.jumps...)
+	jumps = append(jumps, from)
+	newreq := &Request{
+		Event:    copyEvent(e.Event),
+		Enqueued: time.Now(),
+		Peer:     e.Peer,
+		jumps:    jumps,
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		f.dropped++
+		p.logger.Warnf("eventproc: processor closed, dropped fork of event '%s' to stack '%s'", e.Event.ID, stack.name)
+		return
+	}
+	// the pipeline is acquired so the stacks are not released until the
+	// forked request is processed
+	pl.wg.Add(1)
+	select {
+	case f.c <- &forkRequest{pl: pl, stack: stack, req: newreq}:
+		f.forked++
+	default:
+		pl.release()
+		f.dropped++
+		p.logger.Warnf("eventproc: fork buffer full, dropped fork of event '%s' to stack '%s'", e.Event.ID, stack.name)
+	}
+}
+
+func (p *Processor) forkWorker() {
+	f := p.forker
+	defer f.wg.Done()
+	for fr := range f.c {
+		if p.ctx.Err() != nil {
+			fr.pl.release()
+			f.mu.Lock()
+			f.abandoned++
+			f.mu.Unlock()
+			continue
+		}
+		p.processFork(fr)
+	}
+}
+
+func (p *Processor) processFork(fr *forkRequest) {
+	defer fr.pl.release()
+	defer func() {
+		if r := recover(); r != nil {
+			p.mu.Lock()
+			p.panics++
+			p.mu.Unlock()
+			p.logger.Errorf("eventproc: panic processing fork of event '%s': %v\n%s", fr.req.Event.ID, r, debug.Stack())
+		}
+	}()
+	e := fr.req
+	e.Started = time.Now()
+	e.Result, _ = fr.stack.process(p.ctx, p, fr.pl, e)
+	e.Finished = time.Now()
+	if failure, ok := e.Failure(); ok {
+		p.logger.Warnf("eventproc: fork of event '%s' failed in '%s.%s': %s",
+			e.Event.ID, failure.Stack, failure.Module, failure.Error)
+	}
+}
+
+// stopForks closes the intake of forked requests and waits until pending
+// requests are processed. If the context expires before, the processing is
+// canceled and the pending requests are abandoned. It returns the number of
+// abandoned requests.
+func (p *Processor) stopForks(ctx context.Context) int {
+	f := p.forker
+	f.mu.Lock()
+	if !f.closed {
+		f.closed = true
+		close(f.c)
+	}
+	f.mu.Unlock()
+	done := make(chan struct{})
+	go func() {
+		f.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		p.cancel()
+		<-done
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return int(f.abandoned)
+}
+
+func (f *forker) stats(s *Stats) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	s.Forked = f.forked
+	s.ForkDropped = f.dropped
+}
+
+// copyEvent returns a deep copy of the event.
+func copyEvent(e event.Event) event.Event {
+	c := e
+	if e.Data != nil {
+		c.Data = copyValue(e.Data).(map[string]interface{})
+	}
+	if e.Processors != nil {
+		c.Processors = make([]event.ProcessInfo, len(e.Processors))
+		copy(c.Processors, e.Processors)
+	}
+	if e.Tags != nil {
+		c.Tags = make([]string, len(e.Tags))
+		copy(c.Tags, e.Tags)
+	}
+	return c
+}
+
+func copyValue(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(t))
+		for k, val := range t {
+			m[k] = copyValue(val)
+		}
+		return m
+	case []interface{}:
+		s := make([]interface{}, len(t))
+		for i, val := range t {
+			s[i] = copyValue(val)
+		}
+		return s
+	case []string:
+		s := make([]string, len(t))
+		copy(s, t)
+		return s
+	}
+	return v
+}
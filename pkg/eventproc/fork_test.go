@@ -0,0 +1,113 @@
+// Copyright 2019 Luis Guillén Civera <luisguillenc@gmail.com>. See LICENSE.
+
+package eventproc_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/luids-io/api/event"
+	"github.com/luids-io/event/pkg/eventdb"
+	"github.com/luids-io/event/pkg/eventproc"
+)
+
+func TestFork(t *testing.T) {
+	started := make(chan struct{}, 10)
+	release := make(chan struct{})
+	forked := make(chan event.Event, 10)
+	main := eventproc.NewStack("main")
+	main.Add(&eventproc.Module{
+		Name:      "fork",
+		OnSuccess: eventproc.StackAction{Action: eventproc.ActionFork, Label: "slow"},
+	})
+	main.Add(&eventproc.Module{
+		Name: "tag",
+		Plugins: []eventproc.ModulePlugin{eventproc.PluginFunc(func(e *event.Event) error {
+			e.Tags = append(e.Tags, "main")
+			e.Data["value"] = "main"
+			return nil
+		})},
+	})
+	slow := eventproc.NewStack("slow")
+	slow.Add(&eventproc.Module{
+		Name: "wait",
+		Plugins: []eventproc.ModulePlugin{eventproc.PluginFunc(func(e *event.Event) error {
+			started <- struct{}{}
+			<-release
+			e.Tags = append(e.Tags, "slow")
+			forked <- *e
+			return nil
+		})},
+	})
+	db := eventdb.New([]eventdb.EventDef{{Code: 1, Type: event.Security, Fields: []eventdb.FieldDef{{Name: "value", Type: "string"}}}})
+	p := eventproc.New(main, []*eventproc.Stack{slow}, db, eventproc.Workers(1), eventproc.ForkWorkers(1), eventproc.SetBufferSize(1))
+	defer p.Close()
+
+	ctx := context.Background()
+	notified := event.New(1, event.Low)
+	notified.Set("value", "notified")
+	// original continues without waiting the forked
+	result, err := p.Process(ctx, notified)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Action.Action != eventproc.ActionNext || len(result.Trace) != 2 {
+		t.Fatalf("result mismatch: %+v", result)
+	}
+	if result.Trace[0].Action.Action != eventproc.ActionFork {
+		t.Errorf("trace mismatch: %+v", result.Trace[0])
+	}
+	// first fork is in process and second is buffered, third is dropped
+	<-started
+	p.Process(ctx, notified)
+	p.Process(ctx, notified)
+	stats := p.Stats()
+	if stats.Forked != 2 || stats.ForkDropped != 1 {
+		t.Errorf("stats mismatch: %+v", stats)
+	}
+	close(release)
+	e := <-forked
+	if len(e.Tags) != 1 || e.Tags[0] != "slow" {
+		t.Errorf("forked tags mismatch: %v", e.Tags)
+	}
+	if e.Data["value"] != "notified" {
+		t.Errorf("forked event not copied: %v", e.Data)
+	}
+	// pending forks are processed on shutdown
+	p.Shutdown(ctx)
+	if len(forked) != 1 {
+		t.Errorf("forked events not processed on shutdown: %v", len(forked))
+	}
+}
+
+func TestStackActionJSON(t *testing.T) {
+	var tests = []struct {
+		in   string
+		want eventproc.StackAction
+		err  bool
+	}{
+		{`"next"`, eventproc.StackAction{Action: eventproc.ActionNext}, false},
+		{`"jump other"`, eventproc.StackAction{Action: eventproc.ActionJump, Label: "other"}, false},
+		{`"fork other"`, eventproc.StackAction{Action: eventproc.ActionFork, Label: "other"}, false},
+		{`"fork"`, eventproc.StackAction{}, true},
+	}
+	for idx, test := range tests {
+		var got eventproc.StackAction
+		err := json.Unmarshal([]byte(test.in), &got)
+		if test.err {
+			if err == nil {
+				t.Errorf("idx[%v] expected error", idx)
+			}
+			continue
+		}
+		if err != nil || got != test.want {
+			t.Errorf("idx[%v] got %v, %v; want %v", idx, got, err, test.want)
+			continue
+		}
+		data, err := json.Marshal(got)
+		if err != nil || string(data) != test.in {
+			t.Errorf("idx[%v] marshal got %s, %v; want %s", idx, data, err, test.in)
+		}
+	}
+}
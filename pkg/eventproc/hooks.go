@@ -2,9 +2,56 @@
 
 package eventproc
 
+import "fmt"
+
 // CbRequest defines the format of the callbacks used by the hooks.
 type CbRequest func(*Request)
 
+// CbPolicy defines the format of the callbacks used by the policy hooks. The
+// verdict returned decides the processing flow, errors returned will be
+// logged and stored in the request.
+type CbPolicy func(*Request) (Verdict, error)
+
+// Verdict is returned by policy hooks.
+type Verdict struct {
+	Action VerdictAction
+	// Stack is the destination of VerdictReroute.
+	Stack string
+}
+
+// VerdictAction defines the decisions of the policy hooks.
+type VerdictAction uint8
+
+// Policy hooks decisions.
+const (
+	// VerdictContinue doesn't change the processing.
+	VerdictContinue VerdictAction = iota
+	// VerdictDrop stops the processing of the event. Returned before the
+	// processing, the event will not be processed by any stack.
+	VerdictDrop
+	// VerdictSkip skips the module, it's only valid in module hooks.
+	VerdictSkip
+	// VerdictReroute sends the event to the stack. Returned before the
+	// processing, the stack will be used instead of the main stack. Returned
+	// before a module, the module will not be executed and the event will
+	// jump to the stack.
+	VerdictReroute
+)
+
+func (v Verdict) String() string {
+	switch v.Action {
+	case VerdictContinue:
+		return "continue"
+	case VerdictDrop:
+		return "drop"
+	case VerdictSkip:
+		return "skip"
+	case VerdictReroute:
+		return fmt.Sprintf("reroute %s", v.Stack)
+	}
+	return fmt.Sprintf("unknown(%d)", v.Action)
+}
+
 // Hooks stores information about the hooks.
 type Hooks struct {
 	beforeProc   []CbRequest
@@ -12,16 +59,21 @@ type Hooks struct {
 	finishProc   []CbRequest
 	beforeModule []CbRequest
 	afterModule  []CbRequest
+	// policies
+	procPolicies   []CbPolicy
+	modulePolicies []CbPolicy
 }
 
 // NewHooks creates a new Hooks instance.
 func NewHooks() *Hooks {
 	return &Hooks{
-		beforeProc:   []CbRequest{},
-		afterProc:    []CbRequest{},
-		finishProc:   []CbRequest{},
-		beforeModule: []CbRequest{},
-		afterModule:  []CbRequest{},
+		beforeProc:     []CbRequest{},
+		afterProc:      []CbRequest{},
+		finishProc:     []CbRequest{},
+		beforeModule:   []CbRequest{},
+		afterModule:    []CbRequest{},
+		procPolicies:   []CbPolicy{},
+		modulePolicies: []CbPolicy{},
 	}
 }
 
@@ -45,20 +97,35 @@ func (h *Hooks) BeforeModule(fn CbRequest) {
 	h.beforeModule = append(h.beforeModule, fn)
 }
 
-// AfterModule adds a callback that will be executed before a stack module starts.
+// AfterModule adds a callback that will be executed after a stack module ends.
 func (h *Hooks) AfterModule(fn CbRequest) {
 	h.afterModule = append(h.afterModule, fn)
 }
 
+// BeforeProcPolicy adds a policy that will be executed before the process
+// starts, after the BeforeProc callbacks. Policies are executed in order
+// until one of them returns a verdict other than continue. A skip verdict is
+// not valid, it's stored as a HookError and the processing continues.
+func (h *Hooks) BeforeProcPolicy(fn CbPolicy) {
+	h.procPolicies = append(h.procPolicies, fn)
+}
+
+// BeforeModulePolicy adds a policy that will be executed before a stack
+// module starts, after the BeforeModule callbacks. Policies are executed in
+// order until one of them returns a verdict other than continue.
+func (h *Hooks) BeforeModulePolicy(fn CbPolicy) {
+	h.modulePolicies = append(h.modulePolicies, fn)
+}
+
 type hooksRunner struct {
 	hooks *Hooks
 }
 
-func (h *hooksRunner) beforeProc(e *Request) error {
+func (h *hooksRunner) beforeProc(e *Request) (Verdict, []error) {
 	for _, cb := range h.hooks.beforeProc {
 		cb(e)
 	}
-	return nil
+	return runPolicies(h.hooks.procPolicies, e)
 }
 
 func (h *hooksRunner) afterProc(e *Request) error {
@@ -75,11 +142,11 @@ func (h *hooksRunner) finishProc(e *Request) error {
 	return nil
 }
 
-func (h *hooksRunner) beforeModule(e *Request) error {
+func (h *hooksRunner) beforeModule(e *Request) (Verdict, []error) {
 	for _, cb := range h.hooks.beforeModule {
 		cb(e)
 	}
-	return nil
+	return runPolicies(h.hooks.modulePolicies, e)
 }
 
 func (h *hooksRunner) afterModule(e *Request) error {
@@ -88,3 +155,57 @@ func (h *hooksRunner) afterModule(e *Request) error {
 	}
 	return nil
 }
+
+func runPolicies(policies []CbPolicy, e *Request) (v Verdict, errs []error) {
+	for _, cb := range policies {
+		var err error
+		v, err = cb(e)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		if v.Action != VerdictContinue {
+			return
+		}
+	}
+	return
+}
+
+// HookError is the error stored in the request when a policy hook fails.
+type HookError struct {
+	// Stack and Module are empty if the error was returned before the
+	// processing.
+	Stack  string
+	Module string
+	Err    error
+}
+
+// Error implements error interface.
+func (e *HookError) Error() string {
+	if e.Module == "" {
+		return fmt.Sprintf("hook: %v", e.Err)
+	}
+	return fmt.Sprintf("hook %s.%s: %v", e.Stack, e.Module, e.Err)
+}
+
+// Unwrap returns the error returned by the hook.
+func (e *HookError) Unwrap() error {
+	return e.Err
+}
+
+// hookErrors logs and stores the errors returned by policy hooks.
+func (p *Processor) hookErrors(e *Request, errs []error) {
+	if len(errs) == 0 {
+		return
+	}
+	p.mu.Lock()
+	p.hookErrs += uint64(len(errs))
+	p.mu.Unlock()
+	for _, err := range errs {
+		herr := &HookError{Err: err}
+		if e.Module.Module != nil {
+			herr.Stack, herr.Module = e.Module.Stack, e.Module.Module.Name
+		}
+		p.logger.Warnf("eventproc: event '%s': %v", e.Event.ID, herr)
+		e.errs = append(e.errs, herr)
+	}
+}
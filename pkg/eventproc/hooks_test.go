@@ -0,0 +1,114 @@
+// Copyright 2019 Luis Guillén Civera <luisguillenc@gmail.com>. See LICENSE.
+
+package eventproc_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/luids-io/api/event"
+	"github.com/luids-io/event/pkg/eventdb"
+	"github.com/luids-io/event/pkg/eventproc"
+)
+
+func TestPolicies(t *testing.T) {
+	tagger := func(tag string) eventproc.ModulePlugin {
+		return eventproc.PluginFunc(func(e *event.Event) error {
+			e.Tags = append(e.Tags, tag)
+			return nil
+		})
+	}
+	main := eventproc.NewStack("main")
+	main.Add(&eventproc.Module{Name: "m1", Plugins: []eventproc.ModulePlugin{tagger("m1")}})
+	main.Add(&eventproc.Module{Name: "m2", Plugins: []eventproc.ModulePlugin{tagger("m2")}})
+	other := eventproc.NewStack("other")
+	other.Add(&eventproc.Module{Name: "o1", Plugins: []eventproc.ModulePlugin{tagger("o1")}})
+
+	errPolicy := errors.New("policy error")
+	hooks := eventproc.NewHooks()
+	// policies are selected using the level of the event
+	hooks.BeforeProcPolicy(func(r *eventproc.Request) (eventproc.Verdict, error) {
+		if r.Event.Code == 2 {
+			// skip is only valid in module policies
+			return eventproc.Verdict{Action: eventproc.VerdictSkip}, nil
+		}
+		switch r.Event.Level {
+		case event.Info:
+			return eventproc.Verdict{Action: eventproc.VerdictDrop}, nil
+		case event.Critical:
+			return eventproc.Verdict{Action: eventproc.VerdictReroute, Stack: "other"}, nil
+		}
+		return eventproc.Verdict{}, nil
+	})
+	hooks.BeforeModulePolicy(func(r *eventproc.Request) (eventproc.Verdict, error) {
+		if r.Module.Stack != "main" || r.Module.Module.Name != "m1" {
+			return eventproc.Verdict{}, nil
+		}
+		switch r.Event.Level {
+		case event.Medium:
+			return eventproc.Verdict{Action: eventproc.VerdictSkip}, errPolicy
+		case event.High:
+			return eventproc.Verdict{Action: eventproc.VerdictReroute, Stack: "other"}, nil
+		}
+		return eventproc.Verdict{}, nil
+	})
+	db := eventdb.New([]eventdb.EventDef{{Code: 1, Type: event.Security}, {Code: 2, Type: event.Security}})
+	p := eventproc.New(main, []*eventproc.Stack{other}, db, eventproc.SetHooks(hooks))
+	defer p.Close()
+
+	var tests = []struct {
+		level  event.Level
+		action eventproc.Action
+		tags   []string
+		errors int
+	}{
+		{event.Info, eventproc.ActionStop, nil, 0},
+		{event.Low, eventproc.ActionNext, []string{"m1", "m2"}, 0},
+		{event.Medium, eventproc.ActionNext, []string{"m2"}, 1},
+		{event.High, eventproc.ActionNext, []string{"o1", "m2"}, 0},
+		{event.Critical, eventproc.ActionNext, []string{"o1"}, 0},
+	}
+	for idx, test := range tests {
+		res, err := p.Process(context.Background(), event.New(1, test.level))
+		if err != nil {
+			t.Fatalf("idx[%v] unexpected error: %v", idx, err)
+		}
+		if res.Action.Action != test.action {
+			t.Errorf("idx[%v] action mismatch exp=%v got=%v", idx, test.action, res.Action)
+		}
+		if len(res.Event.Tags) != len(test.tags) {
+			t.Errorf("idx[%v] tags mismatch exp=%v got=%v", idx, test.tags, res.Event.Tags)
+		} else {
+			for i := range test.tags {
+				if res.Event.Tags[i] != test.tags[i] {
+					t.Errorf("idx[%v] tags mismatch exp=%v got=%v", idx, test.tags, res.Event.Tags)
+					break
+				}
+			}
+		}
+		if len(res.Errors) != test.errors {
+			t.Errorf("idx[%v] errors mismatch exp=%v got=%v", idx, test.errors, res.Errors)
+		} else if test.errors > 0 && !errors.Is(res.Errors[0], errPolicy) {
+			t.Errorf("idx[%v] unexpected error: %v", idx, res.Errors[0])
+		}
+	}
+	if got := p.Stats().HookErrors; got != 1 {
+		t.Errorf("hook errors mismatch exp=1 got=%v", got)
+	}
+	// invalid verdict before processing
+	res, err := p.Process(context.Background(), event.New(2, event.Low))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if res.Action.Action != eventproc.ActionNext || len(res.Event.Tags) != 2 {
+		t.Errorf("processing mismatch: %v %v", res.Action, res.Event.Tags)
+	}
+	var herr *eventproc.HookError
+	if len(res.Errors) != 1 || !errors.As(res.Errors[0], &herr) || herr.Module != "" {
+		t.Errorf("unexpected errors: %v", res.Errors)
+	}
+	if got := p.Stats().HookErrors; got != 2 {
+		t.Errorf("hook errors mismatch exp=2 got=%v", got)
+	}
+}
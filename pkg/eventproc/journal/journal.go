@@ -0,0 +1,465 @@
+// Copyright 2019 Luis Guillén Civera <luisguillenc@gmail.com>. View LICENSE.
+
+// Package journal implements a disk-backed write-ahead log that can be used
+// by the event processor to recover the accepted events after a crash or
+// restart.
+//
+// This package is a work in progress and makes no API stability promises.
+package journal
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/luids-io/api/event"
+	"github.com/luids-io/core/yalogi"
+)
+
+// Journal stores events in segment files. Each event appended must be
+// acknowledged when processed, events not acknowledged will be replayed when
+// the journal is opened again.
+type Journal struct {
+	opts   options
+	logger yalogi.Logger
+	dir    string
+
+	mu       sync.Mutex
+	segments []*segment
+	active   *segment
+	where    map[uint64]*segment
+	seq      uint64
+	replay   []entry
+	closed   bool
+}
+
+// Option is used for journal configuration.
+type Option func(*options)
+
+type options struct {
+	logger      yalogi.Logger
+	segmentSize int64
+	maxSegments int
+	sync        bool
+}
+
+var defaultOptions = options{
+	logger:      yalogi.LogNull,
+	segmentSize: 4 * 1024 * 1024,
+	maxSegments: 4,
+}
+
+// SetLogger option sets a logger for the component.
+func SetLogger(l yalogi.Logger) Option {
+	return func(o *options) {
+		o.logger = l
+	}
+}
+
+// SegmentSize option sets the size in bytes that triggers the rotation of
+// the active segment.
+func SegmentSize(n int64) Option {
+	return func(o *options) {
+		if n > 0 {
+			o.segmentSize = n
+		}
+	}
+}
+
+// MaxSegments option sets the number of closed segments that triggers the
+// compaction of the oldest segment.
+func MaxSegments(n int) Option {
+	return func(o *options) {
+		if n > 0 {
+			o.maxSegments = n
+		}
+	}
+}
+
+// SyncWrites option forces a sync to disk after each append.
+func SyncWrites(b bool) Option {
+	return func(o *options) {
+		o.sync = b
+	}
+}
+
+const (
+	segmentExt    = ".wal"
+	maxRecordSize = 64 * 1024 * 1024
+
+	recEvent byte = 'e'
+	recAck   byte = 'a'
+)
+
+type segment struct {
+	id      uint64
+	path    string
+	file    *os.File
+	size    int64
+	pending map[uint64]bool
+}
+
+type entry struct {
+	seq uint64
+	e   event.Event
+}
+
+// Open opens the journal stored in dir, it will be created if it doesn't
+// exist.
+func Open(dir string, opt ...Option) (*Journal, error) {
+	opts := defaultOptions
+	for _, o := range opt {
+		o(&opts)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("creating journal dir: %v", err)
+	}
+	j := &Journal{
+		opts:   opts,
+		logger: opts.logger,
+		dir:    dir,
+		where:  make(map[uint64]*segment),
+	}
+	if err := j.load(); err != nil {
+		return nil, err
+	}
+	if err := j.rotate(); err != nil {
+		return nil, err
+	}
+	j.compact()
+	return j, nil
+}
+
+// Append stores the event and returns its sequence number.
+func (j *Journal) Append(e event.Event) (uint64, error) {
+	data, err := encodeEvent(e)
+	if err != nil {
+		return 0, fmt.Errorf("encoding event: %v", err)
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.closed {
+		return 0, errors.New("journal: closed")
+	}
+	j.seq++
+	seq := j.seq
+	if err := j.write(recEvent, seq, data); err != nil {
+		return 0, err
+	}
+	if j.opts.sync {
+		if err := j.active.file.Sync(); err != nil {
+			return 0, fmt.Errorf("journal: sync: %v", err)
+		}
+	}
+	j.active.pending[seq] = true
+	j.where[seq] = j.active
+	if j.active.size >= j.opts.segmentSize {
+		if err := j.rotate(); err != nil {
+			return seq, err
+		}
+		j.compact()
+	}
+	return seq, nil
+}
+
+// Ack marks the event with the sequence number passed as processed.
+func (j *Journal) Ack(seq uint64) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.closed {
+		return errors.New("journal: closed")
+	}
+	s, ok := j.where[seq]
+	if !ok {
+		return nil
+	}
+	delete(j.where, seq)
+	delete(s.pending, seq)
+	return j.write(recAck, seq, nil)
+}
+
+// Replay calls fn for each event that was not acknowledged when the journal
+// was opened, in the order they were appended. Events are returned only once.
+func (j *Journal) Replay(fn func(seq uint64, e event.Event) error) error {
+	j.mu.Lock()
+	pending := j.replay
+	j.replay = nil
+	j.mu.Unlock()
+	for idx, entry := range pending {
+		if err := fn(entry.seq, entry.e); err != nil {
+			j.mu.Lock()
+			j.replay = append(pending[idx:], j.replay...)
+			j.mu.Unlock()
+			return err
+		}
+	}
+	return nil
+}
+
+// Pending returns the number of events not acknowledged.
+func (j *Journal) Pending() int {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return len(j.where)
+}
+
+// Close journal.
+func (j *Journal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.closed {
+		return nil
+	}
+	j.closed = true
+	j.compact()
+	if err := j.active.file.Sync(); err != nil {
+		j.active.file.Close()
+		return err
+	}
+	return j.active.file.Close()
+}
+
+// load reads all segments in dir.
+func (j *Journal) load() error {
+	files, err := ioutil.ReadDir(j.dir)
+	if err != nil {
+		return fmt.Errorf("reading journal dir: %v", err)
+	}
+	ids := make([]uint64, 0, len(files))
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), segmentExt) {
+			continue
+		}
+		var id uint64
+		_, err := fmt.Sscanf(f.Name(), "%016x"+segmentExt, &id)
+		if err != nil {
+			j.logger.Warnf("journal: ignoring file '%s'", f.Name())
+			continue
+		}
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(a, b int) bool { return ids[a] < ids[b] })
+	loaded := make(map[uint64]event.Event)
+	for _, id := range ids {
+		s := &segment{id: id, path: j.segmentPath(id), pending: make(map[uint64]bool)}
+		err := j.readSegment(s, func(rtype byte, seq uint64, data []byte) error {
+			if seq > j.seq {
+				j.seq = seq
+			}
+			switch rtype {
+			case recEvent:
+				e, err := decodeEvent(data)
+				if err != nil {
+					return err
+				}
+				if prev, ok := j.where[seq]; ok {
+					delete(prev.pending, seq)
+				}
+				j.where[seq] = s
+				s.pending[seq] = true
+				loaded[seq] = e
+			case recAck:
+				if prev, ok := j.where[seq]; ok {
+					delete(prev.pending, seq)
+					delete(j.where, seq)
+					delete(loaded, seq)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		j.segments = append(j.segments, s)
+	}
+	j.replay = make([]entry, 0, len(loaded))
+	for seq, e := range loaded {
+		j.replay = append(j.replay, entry{seq: seq, e: e})
+	}
+	sort.Slice(j.replay, func(a, b int) bool { return j.replay[a].seq < j.replay[b].seq })
+	if len(j.replay) > 0 {
+		j.logger.Infof("journal: %v events pending", len(j.replay))
+	}
+	return nil
+}
+
+// readSegment calls fn for each valid record in the segment. If a corrupt
+// record is found, the segment is truncated at that point.
+func (j *Journal) readSegment(s *segment, fn func(byte, uint64, []byte) error) error {
+	f, err := os.OpenFile(s.path, os.O_RDWR, 0644)
+	if err != nil {
+		return fmt.Errorf("opening segment: %v", err)
+	}
+	defer f.Close()
+	var offset int64
+	header := make([]byte, 8)
+	for {
+		_, err := io.ReadFull(f, header)
+		if err == io.EOF {
+			break
+		}
+		var payload []byte
+		if err == nil {
+			size := binary.BigEndian.Uint32(header[0:4])
+			if size > maxRecordSize {
+				err = errors.New("bad record size")
+			} else {
+				payload = make([]byte, size)
+				_, err = io.ReadFull(f, payload)
+			}
+		}
+		if err == nil && (len(payload) < 9 || crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(header[4:8])) {
+			err = errors.New("bad checksum")
+		}
+		if err != nil {
+			j.logger.Warnf("journal: segment '%s' corrupt at offset %v: %v", s.path, offset, err)
+			if err := f.Truncate(offset); err != nil {
+				return fmt.Errorf("truncating segment: %v", err)
+			}
+			break
+		}
+		if err := fn(payload[0], binary.BigEndian.Uint64(payload[1:9]), payload[9:]); err != nil {
+			return fmt.Errorf("segment '%s' offset %v: %v", s.path, offset, err)
+		}
+		offset += int64(len(header) + len(payload))
+	}
+	s.size = offset
+	return nil
+}
+
+// write must be called with the lock held.
+func (j *Journal) write(rtype byte, seq uint64, data []byte) error {
+	buf := make([]byte, 8+9+len(data))
+	payload := buf[8:]
+	payload[0] = rtype
+	binary.BigEndian.PutUint64(payload[1:9], seq)
+	copy(payload[9:], data)
+	binary.BigEndian.PutUint32(buf[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(buf[4:8], crc32.ChecksumIEEE(payload))
+	n, err := j.active.file.Write(buf)
+	j.active.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("journal: writing: %v", err)
+	}
+	return nil
+}
+
+// rotate creates a new active segment, it must be called with the lock held.
+func (j *Journal) rotate() error {
+	var id uint64
+	if len(j.segments) > 0 {
+		id = j.segments[len(j.segments)-1].id + 1
+	}
+	s := &segment{id: id, path: j.segmentPath(id), pending: make(map[uint64]bool)}
+	f, err := os.OpenFile(s.path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return fmt.Errorf("journal: creating segment: %v", err)
+	}
+	if j.active != nil {
+		j.active.file.Sync()
+		j.active.file.Close()
+		j.active.file = nil
+	}
+	s.file = f
+	j.active = s
+	j.segments = append(j.segments, s)
+	return nil
+}
+
+// compact removes the oldest segments without pending events. Segments are
+// only removed in order, so acknowledgements stored in newer segments are
+// never lost. If there are too many closed segments, pending events of the
+// oldest segment are moved to the active segment. It must be called with the
+// lock held.
+func (j *Journal) compact() {
+	for len(j.segments) > 1 {
+		oldest := j.segments[0]
+		if len(oldest.pending) > 0 {
+			if len(j.segments)-1 <= j.opts.maxSegments {
+				return
+			}
+			if err := j.relocate(oldest); err != nil {
+				j.logger.Warnf("journal: relocating segment '%s': %v", oldest.path, err)
+				return
+			}
+		}
+		if err := os.Remove(oldest.path); err != nil {
+			j.logger.Warnf("journal: removing segment '%s': %v", oldest.path, err)
+			return
+		}
+		j.segments = j.segments[1:]
+	}
+}
+
+// relocate copies the pending events of the segment to the active segment.
+func (j *Journal) relocate(s *segment) error {
+	return j.readSegment(s, func(rtype byte, seq uint64, data []byte) error {
+		if rtype != recEvent || !s.pending[seq] {
+			return nil
+		}
+		if err := j.write(recEvent, seq, data); err != nil {
+			return err
+		}
+		delete(s.pending, seq)
+		j.active.pending[seq] = true
+		j.where[seq] = j.active
+		return nil
+	})
+}
+
+func (j *Journal) segmentPath(id uint64) string {
+	return filepath.Join(j.dir, fmt.Sprintf("%016x%s", id, segmentExt))
+}
+
+// record is the encoded event. Data is stored as JSON when it holds types
+// that gob can't encode, as in the wire format, numbers are replayed as
+// float64.
+type record struct {
+	Event    event.Event
+	JSONData []byte
+}
+
+func encodeEvent(e event.Event) ([]byte, error) {
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(record{Event: e})
+	if err == nil {
+		return buf.Bytes(), nil
+	}
+	data, jerr := json.Marshal(e.Data)
+	if jerr != nil {
+		return nil, fmt.Errorf("encoding data: %v", jerr)
+	}
+	e.Data = nil
+	buf.Reset()
+	err = gob.NewEncoder(&buf).Encode(record{Event: e, JSONData: data})
+	return buf.Bytes(), err
+}
+
+func decodeEvent(data []byte) (event.Event, error) {
+	var r record
+	err := gob.NewDecoder(bytes.NewReader(data)).Decode(&r)
+	if err != nil {
+		return event.Event{}, err
+	}
+	if r.JSONData != nil {
+		err = json.Unmarshal(r.JSONData, &r.Event.Data)
+	}
+	return r.Event, err
+}
+
+func init() {
+	// register types used in event data
+	gob.Register(map[string]interface{}{})
+	gob.Register([]interface{}{})
+}
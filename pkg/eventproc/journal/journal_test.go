@@ -0,0 +1,150 @@
+// Copyright 2019 Luis Guillén Civera <luisguillenc@gmail.com>. See LICENSE.
+
+package journal_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/luids-io/api/event"
+	"github.com/luids-io/event/pkg/eventproc/journal"
+)
+
+func TestJournal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "journal")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	j, err := journal.Open(dir, journal.SegmentSize(512), journal.MaxSegments(2))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	seqs := make([]uint64, 0, 20)
+	for i := 0; i < 20; i++ {
+		e := event.New(event.Code(i), event.Low)
+		e.ID = "test"
+		e.Set("score", i)
+		seq, err := j.Append(e)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		seqs = append(seqs, seq)
+	}
+	// ack all except 3 and 15
+	for i, seq := range seqs {
+		if i == 3 || i == 15 {
+			continue
+		}
+		if err := j.Ack(seq); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if j.Pending() != 2 {
+		t.Errorf("unexpected pending: %v", j.Pending())
+	}
+	if err := j.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "*.wal"))
+	if len(files) > 4 {
+		t.Errorf("segments not compacted: %v", len(files))
+	}
+
+	// reopen and replay
+	j, err = journal.Open(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	replayed := make([]event.Event, 0)
+	err = j.Replay(func(seq uint64, e event.Event) error {
+		replayed = append(replayed, e)
+		return j.Ack(seq)
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(replayed) != 2 {
+		t.Fatalf("unexpected replayed: %v", len(replayed))
+	}
+	if replayed[0].Code != 3 || replayed[1].Code != 15 {
+		t.Errorf("unexpected replayed codes: %v %v", replayed[0].Code, replayed[1].Code)
+	}
+	if v, ok := replayed[1].Get("score"); !ok || v.(int) != 15 {
+		t.Errorf("unexpected data: %v", v)
+	}
+	// appended after reopen must not reuse sequences
+	seq, err := j.Append(event.New(100, event.Info))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if seq <= seqs[len(seqs)-1] {
+		t.Errorf("sequence reused: %v", seq)
+	}
+	j.Ack(seq)
+	j.Close()
+
+	// reopen, nothing to replay
+	j, err = journal.Open(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer j.Close()
+	if j.Pending() != 0 {
+		t.Errorf("unexpected pending: %v", j.Pending())
+	}
+}
+
+func TestJournalData(t *testing.T) {
+	dir, err := ioutil.TempDir("", "journal")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	j, err := journal.Open(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	created := time.Date(2020, 5, 1, 10, 0, 0, 0, time.UTC)
+	e := event.New(1, event.Low)
+	e.Set("labels", map[string]string{"zone": "dmz"})
+	e.Set("ports", []int{53, 80})
+	e.Set("seen", created)
+	if _, err := j.Append(e); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	j.Close()
+
+	j, err = journal.Open(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer j.Close()
+	var replayed []event.Event
+	err = j.Replay(func(seq uint64, e event.Event) error {
+		replayed = append(replayed, e)
+		return j.Ack(seq)
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(replayed) != 1 {
+		t.Fatalf("unexpected replayed: %v", len(replayed))
+	}
+	// data is replayed with json types
+	data := replayed[0].Data
+	if labels, ok := data["labels"].(map[string]interface{}); !ok || labels["zone"] != "dmz" {
+		t.Errorf("unexpected labels: %v", data["labels"])
+	}
+	if ports, ok := data["ports"].([]interface{}); !ok || len(ports) != 2 || ports[1] != float64(80) {
+		t.Errorf("unexpected ports: %v", data["ports"])
+	}
+	if data["seen"] != created.Format(time.RFC3339) {
+		t.Errorf("unexpected seen: %v", data["seen"])
+	}
+}
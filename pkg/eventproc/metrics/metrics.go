@@ -0,0 +1,295 @@
+// Copyright 2019 Luis Guillén Civera <luisguillenc@gmail.com>. View LICENSE.
+
+// Package metrics implements prometheus metrics for the event processor. The
+// metrics are fed by the hooks of the processor.
+//
+// This package is a work in progress and makes no API stability promises.
+package metrics
+
+import (
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/luids-io/api/event"
+	"github.com/luids-io/event/pkg/eventproc"
+)
+
+// Metrics implements prometheus.Collector.
+type Metrics struct {
+	stats func() eventproc.Stats
+	// processor
+	processed *prometheus.CounterVec
+	latency   prometheus.Histogram
+	wait      prometheus.Histogram
+	// stacks and modules
+	stackEvents  *prometheus.CounterVec
+	moduleEvents *prometheus.CounterVec
+	moduleTime   *prometheus.HistogramVec
+	filterHits   *prometheus.CounterVec
+	filterMisses *prometheus.CounterVec
+	pluginRuns   *prometheus.CounterVec
+	pluginErrors *prometheus.CounterVec
+	retries      *prometheus.CounterVec
+	panics       *prometheus.CounterVec
+	// queue
+	queued    *prometheus.Desc
+	shards    *prometheus.Desc
+	rejected  *prometheus.Desc
+	dropped   *prometheus.Desc
+	abandoned *prometheus.Desc
+	throttled *prometheus.Desc
+	dups      *prometheus.Desc
+	held      *prometheus.Desc
+	dead      *prometheus.Desc
+	allPanics *prometheus.Desc
+	hookErrs  *prometheus.Desc
+	forked    *prometheus.Desc
+	forkDrops *prometheus.Desc
+}
+
+// Option is used for metrics configuration.
+type Option func(*options)
+
+type options struct {
+	namespace string
+	buckets   []float64
+}
+
+var defaultOptions = options{
+	namespace: "eventproc",
+	buckets:   prometheus.DefBuckets,
+}
+
+// Namespace option sets the namespace of the metrics.
+func Namespace(s string) Option {
+	return func(o *options) {
+		o.namespace = s
+	}
+}
+
+// Buckets option sets the buckets used in latency histograms.
+func Buckets(b []float64) Option {
+	return func(o *options) {
+		if len(b) > 0 {
+			o.buckets = b
+		}
+	}
+}
+
+// New creates the metrics.
+func New(opt ...Option) *Metrics {
+	opts := defaultOptions
+	for _, o := range opt {
+		o(&opts)
+	}
+	ns := opts.namespace
+	return &Metrics{
+		processed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: ns, Name: "events_processed_total",
+			Help: "Events processed by the main stack, by result action.",
+		}, []string{"action"}),
+		latency: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: ns, Name: "event_processing_seconds",
+			Help:    "Time spent processing events.",
+			Buckets: opts.buckets,
+		}),
+		wait: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: ns, Name: "event_queue_seconds",
+			Help:    "Time events spent waiting in the queue.",
+			Buckets: opts.buckets,
+		}),
+		stackEvents: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: ns, Name: "stack_events_total",
+			Help: "Events that entered the stack.",
+		}, []string{"stack"}),
+		moduleEvents: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: ns, Name: "module_events_total",
+			Help: "Events processed by the module, by result action.",
+		}, []string{"stack", "module", "action"}),
+		moduleTime: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: ns, Name: "module_duration_seconds",
+			Help:    "Time spent by the module processing events.",
+			Buckets: opts.buckets,
+		}, []string{"stack", "module"}),
+		filterHits: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: ns, Name: "filter_hits_total",
+			Help: "Events that passed all filters of the module.",
+		}, []string{"stack", "module"}),
+		filterMisses: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: ns, Name: "filter_misses_total",
+			Help: "Events rejected by a filter, by filter class.",
+		}, []string{"stack", "module", "class"}),
+		pluginRuns: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: ns, Name: "plugin_runs_total",
+			Help: "Plugin executions, by plugin class.",
+		}, []string{"stack", "module", "class"}),
+		pluginErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: ns, Name: "plugin_errors_total",
+			Help: "Plugin execution errors, by plugin class.",
+		}, []string{"stack", "module", "class"}),
+		retries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: ns, Name: "module_retries_total",
+			Help: "Plugin executions retried by the module.",
+		}, []string{"stack", "module"}),
+		panics: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: ns, Name: "module_panics_total",
+			Help: "Panics recovered in filters and plugins of the module.",
+		}, []string{"stack", "module"}),
+		queued: prometheus.NewDesc(ns+"_queue_events",
+			"Events waiting in the queue, by lane.", []string{"lane"}, nil),
+		shards: prometheus.NewDesc(ns+"_shard_events",
+			"Events waiting in the queue of each worker, if sharding is enabled.", []string{"shard"}, nil),
+		rejected: prometheus.NewDesc(ns+"_queue_rejected_total",
+			"Events rejected because the queue was full.", nil, nil),
+		dropped: prometheus.NewDesc(ns+"_queue_dropped_total",
+			"Queued events dropped to make room.", nil, nil),
+		abandoned: prometheus.NewDesc(ns+"_queue_abandoned_total",
+			"Queued events discarded on shutdown.", nil, nil),
+		throttled: prometheus.NewDesc(ns+"_throttled_total",
+			"Events rejected by rate limits.", nil, nil),
+		dups: prometheus.NewDesc(ns+"_duplicates_total",
+			"Events merged by deduplication.", nil, nil),
+		held: prometheus.NewDesc(ns+"_dedup_held_events",
+			"Events held by deduplication.", nil, nil),
+		dead: prometheus.NewDesc(ns+"_deadletter_total",
+			"Failed events sent to dead-letter.", nil, nil),
+		allPanics: prometheus.NewDesc(ns+"_panics_total",
+			"Panics recovered by the processor.", nil, nil),
+		hookErrs: prometheus.NewDesc(ns+"_hook_errors_total",
+			"Errors returned by policy hooks.", nil, nil),
+		forked: prometheus.NewDesc(ns+"_forked_total",
+			"Events forked to other stacks.", nil, nil),
+		forkDrops: prometheus.NewDesc(ns+"_fork_dropped_total",
+			"Forks dropped because the fork buffer was full.", nil, nil),
+	}
+}
+
+// Hooks registers the metrics in the hooks of the processor.
+func (m *Metrics) Hooks(h *eventproc.Hooks) {
+	h.AfterProc(m.afterProc)
+	h.AfterModule(m.afterModule)
+}
+
+// SetStats sets the function used to get the statistics of the processor.
+func (m *Metrics) SetStats(fn func() eventproc.Stats) {
+	m.stats = fn
+}
+
+func (m *Metrics) afterProc(r *eventproc.Request) {
+	m.processed.WithLabelValues(r.Result.Action.String()).Inc()
+	m.latency.Observe(r.Finished.Sub(r.Started).Seconds())
+	if !r.Enqueued.IsZero() {
+		m.wait.Observe(r.Started.Sub(r.Enqueued).Seconds())
+	}
+}
+
+func (m *Metrics) afterModule(r *eventproc.Request) {
+	info := r.Module
+	name := info.Module.Name
+	if info.Index == 0 {
+		m.stackEvents.WithLabelValues(info.Stack).Inc()
+	}
+	m.moduleEvents.WithLabelValues(info.Stack, name, info.Action.Action.String()).Inc()
+	m.moduleTime.WithLabelValues(info.Stack, name).Observe(info.Finished.Sub(info.Started).Seconds())
+	if info.Retries > 0 {
+		m.retries.WithLabelValues(info.Stack, name).Add(float64(info.Retries))
+	}
+	if info.Panicked {
+		m.panics.WithLabelValues(info.Stack, name).Inc()
+	}
+	if info.Disabled || info.Verdict.Action != eventproc.VerdictContinue ||
+		(info.Err != nil && info.Plugin < 0) {
+		// module not executed or a filter panicked
+		return
+	}
+	if info.Filter >= 0 {
+		m.filterMisses.WithLabelValues(info.Stack, name, info.FilterClass()).Inc()
+		return
+	}
+	if len(info.Module.Filters) > 0 {
+		m.filterHits.WithLabelValues(info.Stack, name).Inc()
+	}
+	executed := len(info.Module.Plugins)
+	if info.Plugin >= 0 {
+		executed = info.Plugin + 1
+		m.pluginErrors.WithLabelValues(info.Stack, name, info.PluginClass()).Inc()
+	}
+	for idx := 0; idx < executed; idx++ {
+		class := ""
+		if idx < len(info.Module.PluginClasses) {
+			class = info.Module.PluginClasses[idx]
+		}
+		m.pluginRuns.WithLabelValues(info.Stack, name, class).Inc()
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (m *Metrics) Describe(ch chan<- *prometheus.Desc) {
+	m.processed.Describe(ch)
+	m.latency.Describe(ch)
+	m.wait.Describe(ch)
+	m.stackEvents.Describe(ch)
+	m.moduleEvents.Describe(ch)
+	m.moduleTime.Describe(ch)
+	m.filterHits.Describe(ch)
+	m.filterMisses.Describe(ch)
+	m.pluginRuns.Describe(ch)
+	m.pluginErrors.Describe(ch)
+	m.retries.Describe(ch)
+	m.panics.Describe(ch)
+	ch <- m.queued
+	ch <- m.shards
+	ch <- m.rejected
+	ch <- m.dropped
+	ch <- m.abandoned
+	ch <- m.throttled
+	ch <- m.dups
+	ch <- m.held
+	ch <- m.dead
+	ch <- m.allPanics
+	ch <- m.hookErrs
+	ch <- m.forked
+	ch <- m.forkDrops
+}
+
+// Collect implements prometheus.Collector.
+func (m *Metrics) Collect(ch chan<- prometheus.Metric) {
+	m.processed.Collect(ch)
+	m.latency.Collect(ch)
+	m.wait.Collect(ch)
+	m.stackEvents.Collect(ch)
+	m.moduleEvents.Collect(ch)
+	m.moduleTime.Collect(ch)
+	m.filterHits.Collect(ch)
+	m.filterMisses.Collect(ch)
+	m.pluginRuns.Collect(ch)
+	m.pluginErrors.Collect(ch)
+	m.retries.Collect(ch)
+	m.panics.Collect(ch)
+	if m.stats == nil {
+		return
+	}
+	s := m.stats()
+	for idx, n := range s.Lanes {
+		lane := "all"
+		if len(s.Lanes) > 1 {
+			lane = event.Level(idx).String()
+		}
+		ch <- prometheus.MustNewConstMetric(m.queued, prometheus.GaugeValue, float64(n), lane)
+	}
+	for idx, n := range s.Shards {
+		ch <- prometheus.MustNewConstMetric(m.shards, prometheus.GaugeValue, float64(n), strconv.Itoa(idx))
+	}
+	ch <- prometheus.MustNewConstMetric(m.rejected, prometheus.CounterValue, float64(s.Rejected))
+	ch <- prometheus.MustNewConstMetric(m.dropped, prometheus.CounterValue, float64(s.Dropped))
+	ch <- prometheus.MustNewConstMetric(m.abandoned, prometheus.CounterValue, float64(s.Abandoned))
+	ch <- prometheus.MustNewConstMetric(m.throttled, prometheus.CounterValue, float64(s.Throttled))
+	ch <- prometheus.MustNewConstMetric(m.dups, prometheus.CounterValue, float64(s.Duplicates))
+	ch <- prometheus.MustNewConstMetric(m.held, prometheus.GaugeValue, float64(s.Held))
+	ch <- prometheus.MustNewConstMetric(m.dead, prometheus.CounterValue, float64(s.DeadLettered))
+	ch <- prometheus.MustNewConstMetric(m.allPanics, prometheus.CounterValue, float64(s.Panics))
+	ch <- prometheus.MustNewConstMetric(m.hookErrs, prometheus.CounterValue, float64(s.HookErrors))
+	ch <- prometheus.MustNewConstMetric(m.forked, prometheus.CounterValue, float64(s.Forked))
+	ch <- prometheus.MustNewConstMetric(m.forkDrops, prometheus.CounterValue, float64(s.ForkDropped))
+}
@@ -0,0 +1,102 @@
+// Copyright 2019 Luis Guillén Civera <luisguillenc@gmail.com>. See LICENSE.
+
+package metrics_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/luids-io/api/event"
+	"github.com/luids-io/event/pkg/eventdb"
+	"github.com/luids-io/event/pkg/eventproc"
+	"github.com/luids-io/event/pkg/eventproc/metrics"
+)
+
+const expected = `
+# HELP eventproc_events_processed_total Events processed by the main stack, by result action.
+# TYPE eventproc_events_processed_total counter
+eventproc_events_processed_total{action="next"} 2
+eventproc_events_processed_total{action="stop"} 1
+# HELP eventproc_filter_hits_total Events that passed all filters of the module.
+# TYPE eventproc_filter_hits_total counter
+eventproc_filter_hits_total{module="high",stack="main"} 2
+# HELP eventproc_filter_misses_total Events rejected by a filter, by filter class.
+# TYPE eventproc_filter_misses_total counter
+eventproc_filter_misses_total{class="level",module="high",stack="main"} 1
+# HELP eventproc_module_events_total Events processed by the module, by result action.
+# TYPE eventproc_module_events_total counter
+eventproc_module_events_total{action="next",module="high",stack="main"} 2
+eventproc_module_events_total{action="stop",module="high",stack="main"} 1
+# HELP eventproc_plugin_errors_total Plugin execution errors, by plugin class.
+# TYPE eventproc_plugin_errors_total counter
+eventproc_plugin_errors_total{class="check",module="high",stack="main"} 1
+# HELP eventproc_plugin_runs_total Plugin executions, by plugin class.
+# TYPE eventproc_plugin_runs_total counter
+eventproc_plugin_runs_total{class="check",module="high",stack="main"} 2
+# HELP eventproc_queue_events Events waiting in the queue, by lane.
+# TYPE eventproc_queue_events gauge
+eventproc_queue_events{lane="all"} 2
+# HELP eventproc_stack_events_total Events that entered the stack.
+# TYPE eventproc_stack_events_total counter
+eventproc_stack_events_total{stack="main"} 3
+`
+
+func TestMetrics(t *testing.T) {
+	main := eventproc.NewStack("main")
+	main.Add(&eventproc.Module{
+		Name: "high",
+		Filters: []eventproc.ModuleFilter{eventproc.FilterFunc(func(e event.Event) bool {
+			return e.Level >= event.High
+		})},
+		FilterClasses: []string{"level"},
+		Plugins: []eventproc.ModulePlugin{eventproc.PluginFunc(func(e *event.Event) error {
+			if e.Code == 2 {
+				return errors.New("check failed")
+			}
+			return nil
+		})},
+		PluginClasses: []string{"check"},
+		OnError:       eventproc.StackAction{Action: eventproc.ActionStop},
+	})
+	db := eventdb.New([]eventdb.EventDef{{Code: 1, Type: event.Security}, {Code: 2, Type: event.Security}})
+	hooks := eventproc.NewHooks()
+	m := metrics.New()
+	m.Hooks(hooks)
+	p := eventproc.New(main, nil, db, eventproc.SetHooks(hooks))
+	defer p.Close()
+	m.SetStats(p.Stats)
+	reg := prometheus.NewRegistry()
+	if err := reg.Register(m); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, e := range []event.Event{event.New(1, event.Low), event.New(1, event.High), event.New(2, event.High)} {
+		if _, err := p.Process(context.Background(), e); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	// queued events
+	p.Pause()
+	for i := 0; i < 2; i++ {
+		if _, err := p.NotifyEvent(context.Background(), event.New(1, event.Low)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	err := testutil.GatherAndCompare(reg, strings.NewReader(expected),
+		"eventproc_events_processed_total",
+		"eventproc_filter_hits_total",
+		"eventproc_filter_misses_total",
+		"eventproc_module_events_total",
+		"eventproc_plugin_errors_total",
+		"eventproc_plugin_runs_total",
+		"eventproc_queue_events",
+		"eventproc_stack_events_total")
+	if err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,90 @@
+// Copyright 2019 Luis Guillén Civera <luisguillenc@gmail.com>. View LICENSE.
+
+package eventproc
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"sync/atomic"
+
+	"github.com/luids-io/api/event"
+)
+
+// PanicError is the error returned when a filter or a plugin panics.
+type PanicError struct {
+	Value interface{}
+	Stack []byte
+}
+
+// Error implements error interface.
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.Value)
+}
+
+// Disabled returns true if the module has been disabled, at runtime or
+// because it exceeded the max number of panics.
+func (m *Module) Disabled() bool {
+	return atomic.LoadInt32(&m.disabled) == 1
+}
+
+// SetDisabled disables or enables the module at runtime. Enabling the module
+// resets the number of panics. The changes are lost when the stacks are
+// reloaded. Modules disabled in their definitions are not built, so they
+// can't be enabled at runtime.
+func (m *Module) SetDisabled(b bool) {
+	if b {
+		atomic.StoreInt32(&m.disabled, 1)
+		return
+	}
+	atomic.StoreInt32(&m.panics, 0)
+	atomic.StoreInt32(&m.disabled, 0)
+}
+
+// Panics returns the number of panics recovered in the module.
+func (m *Module) Panics() int {
+	return int(atomic.LoadInt32(&m.panics))
+}
+
+// panicked registers a panic in the module, it returns true if the module
+// has been disabled by this panic.
+func (m *Module) panicked() bool {
+	n := atomic.AddInt32(&m.panics, 1)
+	if m.MaxPanics > 0 && int(n) >= m.MaxPanics {
+		return atomic.CompareAndSwapInt32(&m.disabled, 0, 1)
+	}
+	return false
+}
+
+func safeFilter(ctx context.Context, filter ModuleFilter, e event.Event) (result bool, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &PanicError{Value: r, Stack: debug.Stack()}
+		}
+	}()
+	result = filter(ctx, e)
+	return
+}
+
+func safePlugin(ctx context.Context, plugin ModulePlugin, e *event.Event) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &PanicError{Value: r, Stack: debug.Stack()}
+		}
+	}()
+	err = plugin(ctx, e)
+	return
+}
+
+// modulePanic registers a panic recovered in the module in execution.
+func (p *Processor) modulePanic(r *Module, e *Request, perr *PanicError) {
+	p.mu.Lock()
+	p.panics++
+	p.mu.Unlock()
+	e.Module.Panicked = true
+	p.logger.Errorf("eventproc: panic in module trace %v processing event '%s': %v\n%s",
+		e.StackTrace, e.Event.ID, perr.Value, perr.Stack)
+	if r.panicked() {
+		p.logger.Errorf("eventproc: module '%s.%s' disabled after %v panics", e.Module.Stack, r.Name, r.Panics())
+	}
+}
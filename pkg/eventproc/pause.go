@@ -0,0 +1,38 @@
+// Copyright 2019 Luis Guillén Civera <luisguillenc@gmail.com>. View LICENSE.
+
+package eventproc
+
+import "sync/atomic"
+
+// Pause stops the processing of queued events, events will be queued until
+// Resume is called. Events in process and events processed with Process are
+// not affected. If the processor is shutdown, it will be resumed to drain
+// the queue and it can't be paused again.
+func (p *Processor) Pause() {
+	p.smu.Lock()
+	defer p.smu.Unlock()
+	if !p.running() {
+		return
+	}
+	if atomic.CompareAndSwapInt32(&p.paused, 0, 1) {
+		for _, q := range p.queues {
+			q.pause(true)
+		}
+		p.logger.Infof("eventproc: paused")
+	}
+}
+
+// Resume the processing of queued events.
+func (p *Processor) Resume() {
+	if atomic.CompareAndSwapInt32(&p.paused, 1, 0) {
+		for _, q := range p.queues {
+			q.pause(false)
+		}
+		p.logger.Infof("eventproc: resumed")
+	}
+}
+
+// Paused returns true if the processor is paused.
+func (p *Processor) Paused() bool {
+	return atomic.LoadInt32(&p.paused) == 1
+}
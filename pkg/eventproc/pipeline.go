@@ -0,0 +1,126 @@
+// Copyright 2019 Luis Guillén Civera <luisguillenc@gmail.com>. View LICENSE.
+
+package eventproc
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/luids-io/event/pkg/eventdb"
+)
+
+// pipeline stores the stacks and the database used by the processor. Each
+// event is processed using the pipeline in use when the processing starts.
+type pipeline struct {
+	db     eventdb.Database
+	main   *Stack
+	stacks map[string]*Stack
+	// events in process
+	wg sync.WaitGroup
+}
+
+func newPipeline(main *Stack, others []*Stack, db eventdb.Database) *pipeline {
+	pl := &pipeline{
+		db:     db,
+		main:   main,
+		stacks: make(map[string]*Stack, len(others)),
+	}
+	for _, stack := range others {
+		pl.stacks[stack.name] = stack
+	}
+	return pl
+}
+
+// validate checks that all stacks referenced by jump and fork actions and the
+// dead-letter stack exist.
+func (pl *pipeline) validate(deadStack string) error {
+	if deadStack != "" {
+		if _, ok := pl.stacks[deadStack]; !ok {
+			return fmt.Errorf("can't find dead-letter stack '%s'", deadStack)
+		}
+	}
+	check := func(s *Stack) error {
+		for _, m := range s.modules {
+			for _, action := range []StackAction{m.OnSuccess, m.OnError} {
+				if action.Action != ActionJump && action.Action != ActionFork {
+					continue
+				}
+				if _, ok := pl.stacks[action.Label]; !ok {
+					return fmt.Errorf("stack '%s' module '%s': %s to unknown stack '%s'", s.name, m.Name, action.Action, action.Label)
+				}
+			}
+		}
+		return nil
+	}
+	if err := check(pl.main); err != nil {
+		return err
+	}
+	for _, s := range pl.stacks {
+		if err := check(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (pl *pipeline) release() {
+	pl.wg.Done()
+}
+
+// acquire returns the pipeline in use, it must be released when the event is
+// processed.
+func (p *Processor) acquire() *pipeline {
+	p.pmu.RLock()
+	defer p.pmu.RUnlock()
+	pl := p.pipeline
+	pl.wg.Add(1)
+	return pl
+}
+
+func (p *Processor) database() eventdb.Database {
+	p.pmu.RLock()
+	defer p.pmu.RUnlock()
+	return p.pipeline.db
+}
+
+// Stacks returns the main stack and the other stacks in use, sorted by name.
+func (p *Processor) Stacks() (*Stack, []*Stack) {
+	p.pmu.RLock()
+	defer p.pmu.RUnlock()
+	others := make([]*Stack, 0, len(p.pipeline.stacks))
+	for _, s := range p.pipeline.stacks {
+		others = append(others, s)
+	}
+	sort.Slice(others, func(i, j int) bool { return others[i].name < others[j].name })
+	return p.pipeline.main, others
+}
+
+// Reload replaces the stacks and the event database of the processor. Events
+// in process will finish with the previous stacks, new events will use the
+// stacks passed. When it returns, previous stacks are not in use and can be
+// safely shutdown. If there is an error, nothing is replaced.
+func (p *Processor) Reload(main *Stack, others []*Stack, db eventdb.Database) error {
+	if atomic.LoadInt32(&p.state) == stateClosed {
+		return errors.New("eventproc: processor closed")
+	}
+	if main == nil {
+		return errors.New("eventproc: main stack is required")
+	}
+	if db == nil {
+		return errors.New("eventproc: event database is required")
+	}
+	pl := newPipeline(main, others, db)
+	if err := pl.validate(p.opts.deadStack); err != nil {
+		return fmt.Errorf("eventproc: %v", err)
+	}
+	p.pmu.Lock()
+	prev := p.pipeline
+	p.pipeline = pl
+	p.pmu.Unlock()
+	prev.wg.Wait()
+	p.logger.Infof("eventproc: stacks and event database reloaded")
+	return nil
+}
@@ -0,0 +1,107 @@
+// Copyright 2019 Luis Guillén Civera <luisguillenc@gmail.com>. See LICENSE.
+
+package eventproc_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/luids-io/api/event"
+	"github.com/luids-io/event/pkg/eventdb"
+	"github.com/luids-io/event/pkg/eventproc"
+)
+
+func TestReloadInFlight(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	old := eventproc.NewStack("main")
+	old.Add(&eventproc.Module{
+		Name: "old",
+		Plugins: []eventproc.ModulePlugin{eventproc.PluginFunc(func(e *event.Event) error {
+			if e.Code == 1 {
+				close(started)
+				<-release
+			}
+			return nil
+		})},
+	})
+	db := eventdb.New([]eventdb.EventDef{{Code: 1, Type: event.Security}, {Code: 2, Type: event.Security}})
+	p := eventproc.New(old, nil, db)
+	defer p.Close()
+
+	inflight := make(chan *eventproc.Result, 1)
+	go func() {
+		res, _ := p.Process(context.Background(), event.New(1, event.Low))
+		inflight <- res
+	}()
+	<-started
+
+	main := eventproc.NewStack("main")
+	main.Add(&eventproc.Module{Name: "new"})
+	reloaded := make(chan error, 1)
+	go func() {
+		reloaded <- p.Reload(main, nil, db)
+	}()
+	// new events use the new stacks while the reload waits
+	for i := 0; i < 100; i++ {
+		if inUse, _ := p.Stacks(); inUse == main {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	res, err := p.Process(context.Background(), event.New(2, event.Low))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(res.Trace) != 1 || res.Trace[0].Module != "new" {
+		t.Errorf("event not processed by the new stacks: %+v", res.Trace)
+	}
+	select {
+	case err := <-reloaded:
+		t.Fatalf("reload didn't wait for the events in process: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	res = <-inflight
+	if res == nil || len(res.Trace) != 1 || res.Trace[0].Module != "old" {
+		t.Errorf("event not processed by the previous stacks: %+v", res)
+	}
+	if err := <-reloaded; err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestReloadValidate(t *testing.T) {
+	db := eventdb.New([]eventdb.EventDef{{Code: 1, Type: event.Security}})
+	old := eventproc.NewStack("main")
+	p := eventproc.New(old, nil, db)
+	defer p.Close()
+
+	var tests = []struct {
+		action eventproc.StackAction
+		others []*eventproc.Stack
+		valid  bool
+	}{
+		{eventproc.StackAction{Action: eventproc.ActionJump, Label: "other"}, nil, false},
+		{eventproc.StackAction{Action: eventproc.ActionFork, Label: "other"}, nil, false},
+		{eventproc.StackAction{Action: eventproc.ActionJump, Label: "other"}, []*eventproc.Stack{eventproc.NewStack("other")}, true},
+		{eventproc.StackAction{Action: eventproc.ActionFork, Label: "other"}, []*eventproc.Stack{eventproc.NewStack("other")}, true},
+	}
+	for idx, test := range tests {
+		main := eventproc.NewStack("main")
+		main.Add(&eventproc.Module{Name: "target", OnSuccess: test.action})
+		err := p.Reload(main, test.others, db)
+		if test.valid && err != nil {
+			t.Errorf("idx[%v] unexpected error: %v", idx, err)
+		}
+		if !test.valid && err == nil {
+			t.Errorf("idx[%v] expected error", idx)
+		}
+		inUse, _ := p.Stacks()
+		if test.valid != (inUse == main) {
+			t.Errorf("idx[%v] stacks in use mismatch", idx)
+		}
+	}
+}
@@ -35,8 +35,8 @@ func Builder() eventproc.PluginBuilder {
 			return nil, fmt.Errorf("service '%s' is not an archiver instance", sname)
 		}
 		//return module function
-		return func(e *event.Event) error {
-			sid, err := archive.SaveEvent(context.Background(), *e)
+		return func(ctx context.Context, e *event.Event) error {
+			sid, err := archive.SaveEvent(ctx, *e)
 			if err == nil {
 				b.Logger().Debugf("saved event: %s", sid)
 			}
@@ -6,10 +6,10 @@
 package executor
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"os/exec"
-	"strconv"
 	"strings"
 
 	"github.com/luids-io/api/event"
@@ -28,55 +28,52 @@ func Builder() eventproc.PluginBuilder {
 		}
 		//first argument is application to exec
 		app := def.Args[0]
+		//args between brackets are replaced by the value of the field, unknown
+		//fields are replaced by an empty string
 		args := make([]string, 0, len(def.Args)-1)
-		for idx, arg := range def.Args {
-			if idx != 0 {
-				args = append(args, arg)
+		getters := make([]eventproc.FieldGetter, 0, len(def.Args)-1)
+		for _, arg := range def.Args[1:] {
+			var getter eventproc.FieldGetter
+			if strings.HasPrefix(arg, "[") && strings.HasSuffix(arg, "]") {
+				var err error
+				getter, err = eventproc.Field(arg[1 : len(arg)-1])
+				if err != nil {
+					b.Logger().Warnf("arg '%s' will be empty: %v", arg, err)
+					getter = notSet
+				}
 			}
+			args = append(args, arg)
+			getters = append(getters, getter)
 		}
 		//return module function
-		return func(e *event.Event) error {
+		return func(ctx context.Context, e *event.Event) error {
 			fargs := make([]string, 0, len(args))
-			for _, arg := range args {
-				if strings.HasPrefix(arg, "[") && strings.HasSuffix(arg, "]") {
-					field := strings.Trim(arg, "[")
-					field = strings.Trim(field, "]")
-					arg = getField(field, e)
+			for idx, arg := range args {
+				if getters[idx] != nil {
+					arg = getField(getters[idx], e)
 				}
 				fargs = append(fargs, arg)
 			}
 			b.Logger().Debugf("exec %v %v", app, fargs)
-			cmd := exec.Command(app, fargs...)
+			cmd := exec.CommandContext(ctx, app, fargs...)
 			return cmd.Run()
 		}, nil
 	}
 }
 
-func getField(field string, e *event.Event) string {
-	switch field {
-	case "code":
-		return strconv.Itoa(int(e.Code))
-	case "codename":
-		return e.Codename
-	case "type":
-		return e.Type.String()
-	case "level":
-		return e.Level.String()
-	case "source.hostname":
-		return e.Source.Hostname
-	case "source.program":
-		return e.Source.Program
+func notSet(e *event.Event) (interface{}, bool) {
+	return nil, false
+}
+
+func getField(get eventproc.FieldGetter, e *event.Event) string {
+	v, ok := get(e)
+	if !ok {
+		return ""
 	}
-	if strings.HasPrefix(field, "data.") {
-		fields := strings.Split(field, ".")
-		if len(fields) == 2 {
-			v, ok := e.Get(fields[1])
-			if ok {
-				return fmt.Sprintf("%v", v)
-			}
-		}
+	if s, ok := eventproc.AsString(v); ok {
+		return s
 	}
-	return ""
+	return fmt.Sprintf("%v", v)
 }
 
 func init() {
@@ -0,0 +1,48 @@
+// Copyright 2019 Luis Guillén Civera <luisguillenc@gmail.com>. See LICENSE.
+
+package executor_test
+
+import (
+	"context"
+	"os/exec"
+	"testing"
+
+	"github.com/luids-io/api/event"
+	"github.com/luids-io/event/pkg/eventproc"
+	"github.com/luids-io/event/pkg/eventproc/plugins/executor"
+)
+
+func TestExecutor(t *testing.T) {
+	if _, err := exec.LookPath("test"); err != nil {
+		t.Skip("test command not found")
+	}
+	e := event.New(10001, event.High)
+	e.Source.Hostname = "fw1"
+	e.Set("port", 53)
+
+	var tests = []struct {
+		args []string
+		want bool
+	}{
+		{[]string{"test", "[source.hostname]", "=", "fw1"}, true},
+		{[]string{"test", "[data.port]", "=", "53"}, true},
+		{[]string{"test", "[data.port]", "=", "80"}, false},
+		{[]string{"test", "-z", "[data.notset]"}, true},
+		// unknown fields are replaced by an empty string
+		{[]string{"test", "-z", "[unknown]"}, true},
+		{[]string{"test", "-n", "[unknown]"}, false},
+	}
+	b := eventproc.NewBuilder(nil)
+	builder := executor.Builder()
+	for idx, test := range tests {
+		plugin, err := builder(b, &eventproc.ItemDef{Class: executor.PluginClass, Args: test.args})
+		if err != nil {
+			t.Errorf("idx[%v] unexpected error: %v", idx, err)
+			continue
+		}
+		err = plugin(context.Background(), &e)
+		if got := err == nil; got != test.want {
+			t.Errorf("idx[%v] %v: got %v; want %v", idx, test.args, err, test.want)
+		}
+	}
+}
@@ -35,8 +35,8 @@ func Builder() eventproc.PluginBuilder {
 			return nil, fmt.Errorf("service '%s' is not a forwarder instance", sname)
 		}
 		//return module function
-		return func(e *event.Event) error {
-			err := forwarder.ForwardEvent(context.Background(), *e)
+		return func(ctx context.Context, e *event.Event) error {
+			err := forwarder.ForwardEvent(ctx, *e)
 			if err == nil {
 				b.Logger().Debugf("forwarded event '%s' to '%s'", e.ID, sname)
 			}
@@ -6,45 +6,69 @@ import (
 	"encoding/json"
 	"io"
 	"os"
+	"sync"
 )
 
 const dataBuffSize = 100
 
+// jsonfile is shared by all plugins writing to the same path. It's opened by
+// the first plugin started and closed by the last plugin shutdown, so stacks
+// can be rebuilt while the file is in use.
 type jsonfile struct {
-	path   string
-	file   *os.File
-	data   chan interface{}
-	closed bool
+	path string
+
+	mu   sync.RWMutex
+	refs int
+	file *os.File
+	data chan interface{}
+	done chan struct{}
 }
 
 func (j *jsonfile) open(bsize int) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.refs > 0 {
+		j.refs++
+		return nil
+	}
 	fh, err := os.OpenFile(j.path, os.O_WRONLY|os.O_CREATE, 0644)
 	if err != nil {
 		return err
 	}
+	j.refs = 1
 	j.file = fh
 	j.data = make(chan interface{}, bsize)
-	go writeData(fh, j.data)
+	j.done = make(chan struct{})
+	go writeData(fh, j.data, j.done)
 	return nil
 }
 
 func (j *jsonfile) write(e interface{}) {
-	if !j.closed {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	if j.refs > 0 {
 		j.data <- e
 	}
 }
 
 func (j *jsonfile) close() {
-	if !j.closed {
-		j.closed = true
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.refs == 0 {
+		return
+	}
+	j.refs--
+	if j.refs == 0 {
 		close(j.data)
+		<-j.done
 		j.file.Sync()
 		j.file.Close()
 		j.file = nil
 	}
 }
 
-func writeData(w io.Writer, data <-chan interface{}) {
+func writeData(w io.Writer, data <-chan interface{}, done chan<- struct{}) {
+	defer close(done)
 	for e := range data {
 		bytes, err := json.Marshal(e)
 		if err != nil {
@@ -6,6 +6,7 @@
 package jsonwriter
 
 import (
+	"context"
 	"errors"
 
 	"github.com/luids-io/api/event"
@@ -25,6 +26,14 @@ func Builder() eventproc.PluginBuilder {
 		//first argument is output filename
 		fpath := b.DataPath(def.Args[0])
 		file := getJSONFile(fpath)
+		//trace option writes the processing trace with the event
+		trace := false
+		if v, ok := def.Opts["trace"]; ok {
+			trace, ok = v.(bool)
+			if !ok {
+				return nil, errors.New("invalid value for 'trace'")
+			}
+		}
 
 		b.OnStartup(func() error {
 			return file.open(dataBuffSize)
@@ -34,13 +43,25 @@ func Builder() eventproc.PluginBuilder {
 			return nil
 		})
 		//return module function
-		return func(e *event.Event) error {
+		if trace {
+			return func(ctx context.Context, e *event.Event) error {
+				t, _ := eventproc.TraceFromContext(ctx)
+				file.write(tracedEvent{Event: e, Trace: t})
+				return nil
+			}, nil
+		}
+		return eventproc.PluginFunc(func(e *event.Event) error {
 			file.write(e)
 			return nil
-		}, nil
+		}), nil
 	}
 }
 
+type tracedEvent struct {
+	*event.Event
+	Trace []eventproc.TraceEntry `json:"trace"`
+}
+
 func init() {
 	eventproc.RegisterPlugin(PluginCass, Builder())
 }
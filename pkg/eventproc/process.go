@@ -0,0 +1,86 @@
+// Copyright 2019 Luis Guillén Civera <luisguillenc@gmail.com>. View LICENSE.
+
+package eventproc
+
+import (
+	"context"
+	"time"
+
+	"github.com/luids-io/api/event"
+)
+
+// Result stores the outcome of an event processed synchronously.
+type Result struct {
+	// Event processed, completed by the processor and modified by plugins.
+	Event event.Event
+	// Action returned by the main stack.
+	Action StackAction
+	// Trace stores the outcome of each module executed.
+	Trace []TraceEntry
+	// Errors returned by the plugins and panics recovered, in order. If the
+	// processing was aborted, the last one is the error of the context.
+	Errors []error
+	// Started and Finished times of the processing.
+	Started  time.Time
+	Finished time.Time
+}
+
+// Process notifies an event and processes it in the goroutine of the caller,
+// it returns when the processing ends. Events are processed by the same
+// stacks and hooks that the events notified with NotifyEvent, but they are
+// not queued, deduplicated nor stored in the journal. The processing will be
+// canceled if the context passed is canceled. Shutdown waits for the calls in
+// progress and new calls are refused once the shutdown has started.
+func (p *Processor) Process(ctx context.Context, e event.Event) (*Result, error) {
+	if !p.enter() {
+		return nil, event.ErrUnavailable
+	}
+	defer p.wg.Done()
+	// gets peer info
+	peerData, peerAddr := getPeerAddr(ctx)
+
+	// checks event
+	def, err := p.validateNotify(e)
+	if err != nil {
+		p.logger.Warnf("eventproc: [peer=%s] process event: %v", peerAddr, err)
+		return nil, event.ErrBadRequest
+	}
+	// checks rate limits
+	if !p.checkRate(e, peerData, peerAddr) {
+		return nil, event.ErrUnavailable
+	}
+	e = p.complete(e, def)
+
+	// the processing is canceled if the processor is closed
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-p.ctx.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	req := &Request{Event: e, Peer: peerData}
+	p.processRequest(ctx, req)
+	return &Result{
+		Event:    req.Event,
+		Action:   req.Result,
+		Trace:    req.Trace,
+		Errors:   req.errs,
+		Started:  req.Started,
+		Finished: req.Finished,
+	}, nil
+}
+
+// enter registers a synchronous call in the wait group of the workers. It
+// returns false if the processor is not running.
+func (p *Processor) enter() bool {
+	p.smu.Lock()
+	defer p.smu.Unlock()
+	if !p.running() {
+		return false
+	}
+	p.wg.Add(1)
+	return true
+}
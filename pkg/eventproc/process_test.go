@@ -0,0 +1,216 @@
+// Copyright 2019 Luis Guillén Civera <luisguillenc@gmail.com>. See LICENSE.
+
+package eventproc_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/luids-io/api/event"
+	"github.com/luids-io/event/pkg/eventdb"
+	"github.com/luids-io/event/pkg/eventproc"
+)
+
+func TestProcess(t *testing.T) {
+	errPlugin := errors.New("plugin error")
+	tag := eventproc.PluginFunc(func(e *event.Event) error {
+		e.Tags = append(e.Tags, "tagged")
+		return nil
+	})
+	fail := eventproc.PluginFunc(func(e *event.Event) error {
+		return errPlugin
+	})
+	isHigh := eventproc.FilterFunc(func(e event.Event) bool {
+		return e.Level >= event.High
+	})
+
+	main := eventproc.NewStack("main")
+	main.Add(&eventproc.Module{
+		Name:      "tag",
+		Plugins:   []eventproc.ModulePlugin{tag},
+		OnSuccess: eventproc.StackAction{Action: eventproc.ActionNext},
+	})
+	main.Add(&eventproc.Module{
+		Name:      "high",
+		Filters:   []eventproc.ModuleFilter{isHigh},
+		Plugins:   []eventproc.ModulePlugin{fail},
+		OnSuccess: eventproc.StackAction{Action: eventproc.ActionNext},
+		OnError:   eventproc.StackAction{Action: eventproc.ActionStop},
+	})
+	db := eventdb.New([]eventdb.EventDef{{Code: 1, Type: event.Security}})
+	p := eventproc.New(main, nil, db)
+	defer p.Close()
+
+	var tests = []struct {
+		level   event.Level
+		action  eventproc.Action
+		matched bool
+		errors  int
+	}{
+		{event.Low, eventproc.ActionNext, false, 0},
+		{event.High, eventproc.ActionStop, true, 1},
+	}
+	for idx, test := range tests {
+		res, err := p.Process(context.Background(), event.New(1, test.level))
+		if err != nil {
+			t.Fatalf("idx[%v] unexpected error: %v", idx, err)
+		}
+		if res.Event.ID == "" {
+			t.Errorf("idx[%v] event id is empty", idx)
+		}
+		if len(res.Event.Tags) == 0 || res.Event.Tags[len(res.Event.Tags)-1] != "tagged" {
+			t.Errorf("idx[%v] event not modified by plugin: %v", idx, res.Event.Tags)
+		}
+		if res.Action.Action != test.action {
+			t.Errorf("idx[%v] action mismatch exp=%v got=%v", idx, test.action, res.Action)
+		}
+		if len(res.Trace) != 2 {
+			t.Fatalf("idx[%v] trace mismatch: %v", idx, res.Trace)
+		}
+		if res.Trace[1].Matched != test.matched {
+			t.Errorf("idx[%v] matched mismatch exp=%v got=%v", idx, test.matched, res.Trace[1].Matched)
+		}
+		if len(res.Errors) != test.errors {
+			t.Errorf("idx[%v] errors mismatch exp=%v got=%v", idx, test.errors, res.Errors)
+		}
+		if test.errors > 0 && res.Errors[0] != errPlugin {
+			t.Errorf("idx[%v] error mismatch: %v", idx, res.Errors[0])
+		}
+	}
+	// event not defined
+	_, err := p.Process(context.Background(), event.New(2, event.Low))
+	if err != event.ErrBadRequest {
+		t.Errorf("unexpected error: %v", err)
+	}
+	// processor closed
+	p.Close()
+	_, err = p.Process(context.Background(), event.New(1, event.Low))
+	if err != event.ErrUnavailable {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestShutdownWaitsProcess(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	main := eventproc.NewStack("main")
+	main.Add(&eventproc.Module{
+		Name: "wait",
+		Plugins: []eventproc.ModulePlugin{eventproc.PluginFunc(func(e *event.Event) error {
+			close(started)
+			<-release
+			return nil
+		})},
+	})
+	db := eventdb.New([]eventdb.EventDef{{Code: 1, Type: event.Security}})
+	p := eventproc.New(main, nil, db)
+	defer p.Close()
+
+	processed := make(chan error, 1)
+	go func() {
+		_, err := p.Process(context.Background(), event.New(1, event.Low))
+		processed <- err
+	}()
+	<-started
+	shutdown := make(chan struct{})
+	go func() {
+		p.Shutdown(context.Background())
+		close(shutdown)
+	}()
+	select {
+	case <-shutdown:
+		t.Fatal("shutdown didn't wait for process")
+	case <-time.After(100 * time.Millisecond):
+	}
+	// new calls are refused while draining
+	if _, err := p.Process(context.Background(), event.New(1, event.Low)); err != event.ErrUnavailable {
+		t.Errorf("unexpected error: %v", err)
+	}
+	close(release)
+	if err := <-processed; err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	<-shutdown
+}
+
+func TestModuleTimeout(t *testing.T) {
+	ran := false
+	main := eventproc.NewStack("main")
+	main.Add(&eventproc.Module{
+		Name: "slow",
+		Plugins: []eventproc.ModulePlugin{func(ctx context.Context, e *event.Event) error {
+			<-ctx.Done()
+			return ctx.Err()
+		}},
+		OnError: eventproc.StackAction{Action: eventproc.ActionStop},
+		Timeout: 20 * time.Millisecond,
+	})
+	main.Add(&eventproc.Module{
+		Name: "next",
+		Plugins: []eventproc.ModulePlugin{eventproc.PluginFunc(func(e *event.Event) error {
+			ran = true
+			return nil
+		})},
+	})
+	db := eventdb.New([]eventdb.EventDef{{Code: 1, Type: event.Security}})
+	p := eventproc.New(main, nil, db)
+	defer p.Close()
+
+	res, err := p.Process(context.Background(), event.New(1, event.Low))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if res.Action.Action != eventproc.ActionStop || ran {
+		t.Errorf("on error not applied: %v %v", res.Action, ran)
+	}
+	if len(res.Trace) != 1 || res.Trace[0].Error != context.DeadlineExceeded.Error() {
+		t.Errorf("trace mismatch: %+v", res.Trace)
+	}
+	if len(res.Errors) != 1 || res.Errors[0] != context.DeadlineExceeded {
+		t.Errorf("errors mismatch: %v", res.Errors)
+	}
+}
+
+func TestProcessCanceled(t *testing.T) {
+	ran := false
+	started := make(chan struct{})
+	main := eventproc.NewStack("main")
+	main.Add(&eventproc.Module{
+		Name: "block",
+		Plugins: []eventproc.ModulePlugin{func(ctx context.Context, e *event.Event) error {
+			close(started)
+			<-ctx.Done()
+			return ctx.Err()
+		}},
+		OnError: eventproc.StackAction{Action: eventproc.ActionNext},
+	})
+	main.Add(&eventproc.Module{
+		Name: "next",
+		Plugins: []eventproc.ModulePlugin{eventproc.PluginFunc(func(e *event.Event) error {
+			ran = true
+			return nil
+		})},
+	})
+	db := eventdb.New([]eventdb.EventDef{{Code: 1, Type: event.Security}})
+	p := eventproc.New(main, nil, db)
+	defer p.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-started
+		cancel()
+	}()
+	res, err := p.Process(ctx, event.New(1, event.Low))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// the next module is not executed
+	if res.Action.Action != eventproc.ActionStop || ran || len(res.Trace) != 1 {
+		t.Errorf("processing not aborted: %v %v %v", res.Action, ran, res.Trace)
+	}
+	if len(res.Errors) != 2 || res.Errors[1] != context.Canceled {
+		t.Errorf("errors mismatch: %v", res.Errors)
+	}
+}
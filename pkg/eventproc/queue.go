@@ -0,0 +1,344 @@
+// Copyright 2019 Luis Guillén Civera <luisguillenc@gmail.com>. View LICENSE.
+
+package eventproc
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// OverflowPolicy defines the behaviour of the processor when the event
+// request queue is full.
+type OverflowPolicy uint8
+
+// Overflow policies.
+const (
+	// OverflowBlock blocks the caller until there is space in the queue.
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDeadline blocks the caller until there is space in the queue
+	// or the timeout expires, then rejects the event.
+	OverflowDeadline
+	// OverflowReject rejects the event.
+	OverflowReject
+	// OverflowDropOldest drops the oldest event in the queue.
+	OverflowDropOldest
+	// OverflowDropLowest drops the oldest event with the lowest level in the
+	// queue. If the level of the new event is the lowest, then it will be
+	// rejected.
+	OverflowDropLowest
+)
+
+func (o OverflowPolicy) String() string {
+	switch o {
+	case OverflowBlock:
+		return "block"
+	case OverflowDeadline:
+		return "deadline"
+	case OverflowReject:
+		return "reject"
+	case OverflowDropOldest:
+		return "dropoldest"
+	case OverflowDropLowest:
+		return "droplowest"
+	}
+	return fmt.Sprintf("unknown(%d)", o)
+}
+
+// ToOverflowPolicy returns the policy from a string.
+func ToOverflowPolicy(s string) (OverflowPolicy, error) {
+	switch s {
+	case "block":
+		return OverflowBlock, nil
+	case "deadline":
+		return OverflowDeadline, nil
+	case "reject":
+		return OverflowReject, nil
+	case "dropoldest":
+		return OverflowDropOldest, nil
+	case "droplowest":
+		return OverflowDropLowest, nil
+	}
+	return OverflowBlock, fmt.Errorf("invalid overflow policy '%s'", s)
+}
+
+var (
+	errQueueFull   = errors.New("queue is full")
+	errQueueClosed = errors.New("queue is closed")
+)
+
+// queue is a bounded queue of requests that applies an overflow policy. If
+// priority is enabled, there will be a lane for each event level and requests
+// will be dequeued using a smooth weighted round robin.
+type queue struct {
+	mu       sync.Mutex
+	notEmpty *sync.Cond
+	notFull  *sync.Cond
+
+	lanes   []*lane
+	count   int
+	size    int
+	timeout time.Duration
+	maxWait time.Duration
+	closed  bool
+	paused  bool
+	// counters
+	rejected  uint64
+	dropped   uint64
+	abandoned uint64
+}
+
+type lane struct {
+	items   []*Request
+	weight  int
+	current int
+}
+
+func newQueue(opts options) *queue {
+	q := &queue{
+		size:    opts.buffSize,
+		timeout: opts.timeout,
+		maxWait: opts.maxWait,
+	}
+	if len(opts.weights) > 0 {
+		q.lanes = make([]*lane, 0, len(opts.weights))
+		for _, w := range opts.weights {
+			q.lanes = append(q.lanes, &lane{weight: w})
+		}
+	} else {
+		q.lanes = []*lane{{items: make([]*Request, 0, opts.buffSize), weight: 1}}
+	}
+	q.notEmpty = sync.NewCond(&q.mu)
+	q.notFull = sync.NewCond(&q.mu)
+	return q
+}
+
+// push enqueues the request applying the overflow policy passed. If a queued
+// request is dropped to make room, it will be returned.
+func (q *queue) push(r *Request, policy OverflowPolicy) (dropped *Request, err error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return nil, errQueueClosed
+	}
+	if q.count >= q.size {
+		switch policy {
+		case OverflowBlock:
+			for q.count >= q.size && !q.closed {
+				q.notFull.Wait()
+			}
+		case OverflowDeadline:
+			deadline := time.Now().Add(q.timeout)
+			timer := time.AfterFunc(q.timeout, func() {
+				q.mu.Lock()
+				q.notFull.Broadcast()
+				q.mu.Unlock()
+			})
+			defer timer.Stop()
+			for q.count >= q.size && !q.closed {
+				if !time.Now().Before(deadline) {
+					q.rejected++
+					return nil, errQueueFull
+				}
+				q.notFull.Wait()
+			}
+		case OverflowReject:
+			q.rejected++
+			return nil, errQueueFull
+		case OverflowDropOldest:
+			dropped = q.remove(q.oldest(), 0)
+		case OverflowDropLowest:
+			l, idx := q.lowest()
+			if l.items[idx].Event.Level >= r.Event.Level {
+				q.rejected++
+				return nil, errQueueFull
+			}
+			dropped = q.remove(l, idx)
+		}
+		if q.closed {
+			return nil, errQueueClosed
+		}
+	}
+	if dropped != nil {
+		q.dropped++
+	}
+	q.add(r)
+	return dropped, nil
+}
+
+// put enqueues the request waiting for space, regardless of the policy.
+func (q *queue) put(r *Request) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for q.count >= q.size && !q.closed {
+		q.notFull.Wait()
+	}
+	if q.closed {
+		return errQueueClosed
+	}
+	q.add(r)
+	return nil
+}
+
+// pop dequeues a request, it blocks until a request is available and the
+// queue is not paused. It returns false if the queue is closed and there are
+// no requests. Closed queues are never paused.
+func (q *queue) pop() (*Request, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for (q.count == 0 || q.paused) && !q.closed {
+		q.notEmpty.Wait()
+	}
+	if q.count == 0 {
+		return nil, false
+	}
+	r := q.remove(q.next(), 0)
+	q.notFull.Signal()
+	return r, true
+}
+
+// close the queue, pending requests can be dequeued.
+func (q *queue) close() {
+	q.mu.Lock()
+	q.closed = true
+	q.notEmpty.Broadcast()
+	q.notFull.Broadcast()
+	q.mu.Unlock()
+}
+
+// pause or resume the dequeue of requests.
+func (q *queue) pause(b bool) {
+	q.mu.Lock()
+	q.paused = b
+	q.notEmpty.Broadcast()
+	q.mu.Unlock()
+}
+
+// discard removes all pending requests and returns the number of them.
+func (q *queue) discard() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	n := q.count
+	for _, l := range q.lanes {
+		for i := range l.items {
+			l.items[i] = nil
+		}
+		l.items = l.items[:0]
+	}
+	q.count = 0
+	q.abandoned += uint64(n)
+	q.notFull.Broadcast()
+	return n
+}
+
+func (q *queue) stats() (lanes []uint64, rejected, dropped, abandoned uint64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	lanes = make([]uint64, 0, len(q.lanes))
+	for _, l := range q.lanes {
+		lanes = append(lanes, uint64(len(l.items)))
+	}
+	return lanes, q.rejected, q.dropped, q.abandoned
+}
+
+// add must be called with the lock held.
+func (q *queue) add(r *Request) {
+	l := q.lanes[0]
+	if len(q.lanes) > 1 {
+		idx := int(r.Event.Level)
+		if idx < 0 {
+			idx = 0
+		} else if idx >= len(q.lanes) {
+			idx = len(q.lanes) - 1
+		}
+		l = q.lanes[idx]
+	}
+	l.items = append(l.items, r)
+	q.count++
+	q.notEmpty.Signal()
+}
+
+// remove must be called with the lock held.
+func (q *queue) remove(l *lane, idx int) *Request {
+	q.count--
+	r := l.items[idx]
+	if idx == 0 {
+		l.items[0] = nil
+		l.items = l.items[1:]
+		return r
+	}
+	copy(l.items[idx:], l.items[idx+1:])
+	l.items[len(l.items)-1] = nil
+	l.items = l.items[:len(l.items)-1]
+	return r
+}
+
+// next returns the lane of the next request to dequeue, the queue can't be
+// empty and it must be called with the lock held.
+func (q *queue) next() *lane {
+	if len(q.lanes) == 1 {
+		return q.lanes[0]
+	}
+	// starvation protection
+	if q.maxWait > 0 {
+		limit := time.Now().Add(-q.maxWait)
+		var starved *lane
+		for _, l := range q.lanes {
+			if len(l.items) > 0 && l.items[0].Enqueued.Before(limit) &&
+				(starved == nil || l.items[0].Enqueued.Before(starved.items[0].Enqueued)) {
+				starved = l
+			}
+		}
+		if starved != nil {
+			return starved
+		}
+	}
+	// smooth weighted round robin, ties favour higher levels
+	var best *lane
+	total := 0
+	for i := len(q.lanes) - 1; i >= 0; i-- {
+		l := q.lanes[i]
+		if len(l.items) == 0 {
+			continue
+		}
+		l.current += l.weight
+		total += l.weight
+		if best == nil || l.current > best.current {
+			best = l
+		}
+	}
+	best.current -= total
+	return best
+}
+
+// oldest returns the lane with the oldest request, the queue can't be empty
+// and it must be called with the lock held.
+func (q *queue) oldest() *lane {
+	var oldest *lane
+	for _, l := range q.lanes {
+		if len(l.items) > 0 && (oldest == nil || l.items[0].Enqueued.Before(oldest.items[0].Enqueued)) {
+			oldest = l
+		}
+	}
+	return oldest
+}
+
+// lowest returns the position of the oldest request with the lowest level,
+// the queue can't be empty and it must be called with the lock held.
+func (q *queue) lowest() (*lane, int) {
+	if len(q.lanes) > 1 {
+		for _, l := range q.lanes {
+			if len(l.items) > 0 {
+				return l, 0
+			}
+		}
+	}
+	l, idx := q.lanes[0], 0
+	for i, r := range l.items {
+		if r.Event.Level < l.items[idx].Event.Level {
+			idx = i
+		}
+	}
+	return l, idx
+}
@@ -0,0 +1,222 @@
+// Copyright 2019 Luis Guillén Civera <luisguillenc@gmail.com>. See LICENSE.
+
+package eventproc_test
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/luids-io/api/event"
+	"github.com/luids-io/event/pkg/eventdb"
+	"github.com/luids-io/event/pkg/eventproc"
+)
+
+// queueProc returns a paused processor with one worker and a function that
+// resumes it and returns the codes of the events processed.
+func queueProc(opt ...eventproc.Option) (*eventproc.Processor, func() []event.Code) {
+	var mu sync.Mutex
+	var codes []event.Code
+	main := eventproc.NewStack("main")
+	main.Add(&eventproc.Module{
+		Name: "record",
+		Plugins: []eventproc.ModulePlugin{eventproc.PluginFunc(func(e *event.Event) error {
+			mu.Lock()
+			codes = append(codes, e.Code)
+			mu.Unlock()
+			return nil
+		})},
+	})
+	defs := make([]eventdb.EventDef, 0, 10)
+	for i := 1; i <= 10; i++ {
+		defs = append(defs, eventdb.EventDef{Code: event.Code(i), Type: event.Security})
+	}
+	opt = append([]eventproc.Option{eventproc.Workers(1)}, opt...)
+	p := eventproc.New(main, nil, eventdb.New(defs), opt...)
+	p.Pause()
+	return p, func() []event.Code {
+		p.Resume()
+		p.Shutdown(context.Background())
+		mu.Lock()
+		defer mu.Unlock()
+		return codes
+	}
+}
+
+type queued struct {
+	code  event.Code
+	level event.Level
+}
+
+func TestOverflowPolicy(t *testing.T) {
+	var tests = []struct {
+		policy   eventproc.OverflowPolicy
+		events   []queued
+		wantErr  []error
+		rejected uint64
+		dropped  uint64
+		want     []event.Code
+	}{
+		{eventproc.OverflowReject,
+			[]queued{{1, event.Low}, {2, event.Low}, {3, event.High}},
+			[]error{nil, nil, event.ErrUnavailable}, 1, 0, []event.Code{1, 2}},
+		{eventproc.OverflowDeadline,
+			[]queued{{1, event.Low}, {2, event.Low}, {3, event.High}},
+			[]error{nil, nil, event.ErrUnavailable}, 1, 0, []event.Code{1, 2}},
+		{eventproc.OverflowDropOldest,
+			[]queued{{1, event.High}, {2, event.Low}, {3, event.Low}},
+			[]error{nil, nil, nil}, 0, 1, []event.Code{2, 3}},
+		{eventproc.OverflowDropLowest,
+			[]queued{{1, event.Medium}, {2, event.Low}, {3, event.High}},
+			[]error{nil, nil, nil}, 0, 1, []event.Code{1, 3}},
+		// the new event has the lowest level
+		{eventproc.OverflowDropLowest,
+			[]queued{{1, event.Medium}, {2, event.Low}, {3, event.Low}},
+			[]error{nil, nil, event.ErrUnavailable}, 1, 0, []event.Code{1, 2}},
+	}
+	for idx, test := range tests {
+		p, processed := queueProc(eventproc.SetBufferSize(2),
+			eventproc.SetOverflowPolicy(test.policy),
+			eventproc.OverflowTimeout(20*time.Millisecond))
+		for i, q := range test.events {
+			_, err := p.NotifyEvent(context.Background(), event.New(q.code, q.level))
+			if err != test.wantErr[i] {
+				t.Errorf("idx[%v] %v event %v: got error %v; want %v", idx, test.policy, i, err, test.wantErr[i])
+			}
+		}
+		stats := p.Stats()
+		if stats.Rejected != test.rejected || stats.Dropped != test.dropped {
+			t.Errorf("idx[%v] %v: got rejected=%v dropped=%v; want rejected=%v dropped=%v",
+				idx, test.policy, stats.Rejected, stats.Dropped, test.rejected, test.dropped)
+		}
+		if got := processed(); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("idx[%v] %v: got %v; want %v", idx, test.policy, got, test.want)
+		}
+	}
+}
+
+func TestOverflowBlock(t *testing.T) {
+	p, processed := queueProc(eventproc.SetBufferSize(2),
+		eventproc.SetOverflowPolicy(eventproc.OverflowBlock))
+	for i := 1; i <= 2; i++ {
+		if _, err := p.NotifyEvent(context.Background(), event.New(event.Code(i), event.Low)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	done := make(chan error, 1)
+	go func() {
+		_, err := p.NotifyEvent(context.Background(), event.New(3, event.Low))
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		t.Fatalf("event not blocked: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	p.Resume()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("event still blocked")
+	}
+	stats := p.Stats()
+	if stats.Rejected != 0 || stats.Dropped != 0 {
+		t.Errorf("unexpected stats: rejected=%v dropped=%v", stats.Rejected, stats.Dropped)
+	}
+	if got := processed(); !reflect.DeepEqual(got, []event.Code{1, 2, 3}) {
+		t.Errorf("processed mismatch: %v", got)
+	}
+}
+
+func TestPriorityWeights(t *testing.T) {
+	// lanes of low and critical events with weights 1 and 3
+	p, processed := queueProc(eventproc.Priority([]int{1, 1, 1, 1, 3}))
+	for i := 0; i < 10; i++ {
+		p.NotifyEvent(context.Background(), event.New(1, event.Low))
+		p.NotifyEvent(context.Background(), event.New(2, event.Critical))
+	}
+	if lanes := p.Stats().Lanes; !reflect.DeepEqual(lanes, []uint64{0, 10, 0, 0, 10}) {
+		t.Errorf("lanes mismatch: %v", lanes)
+	}
+	got := processed()
+	if len(got) != 20 {
+		t.Fatalf("processed mismatch: %v", got)
+	}
+	// each round of 4 events dequeues 3 critical and 1 low
+	for round := 0; round < 3; round++ {
+		critical := 0
+		for _, code := range got[round*4 : round*4+4] {
+			if code == 2 {
+				critical++
+			}
+		}
+		if critical != 3 {
+			t.Errorf("round %v: ratio mismatch: %v", round, got)
+		}
+	}
+}
+
+func TestPriorityMaxWait(t *testing.T) {
+	var tests = []struct {
+		opts []eventproc.Option
+		want event.Code
+	}{
+		{[]eventproc.Option{eventproc.Priority(nil)}, 2},
+		// the info event is starved
+		{[]eventproc.Option{eventproc.Priority(nil), eventproc.MaxWait(30 * time.Millisecond)}, 1},
+	}
+	for idx, test := range tests {
+		p, processed := queueProc(test.opts...)
+		p.NotifyEvent(context.Background(), event.New(1, event.Info))
+		time.Sleep(50 * time.Millisecond)
+		for i := 0; i < 5; i++ {
+			p.NotifyEvent(context.Background(), event.New(2, event.Critical))
+		}
+		got := processed()
+		if len(got) != 6 || got[0] != test.want {
+			t.Errorf("idx[%v] processed mismatch: %v", idx, got)
+		}
+	}
+}
+
+func TestPriorityDropLowest(t *testing.T) {
+	p, processed := queueProc(eventproc.Priority(nil), eventproc.SetBufferSize(3),
+		eventproc.SetOverflowPolicy(eventproc.OverflowDropLowest))
+	var tests = []struct {
+		code  event.Code
+		level event.Level
+		want  error
+	}{
+		{1, event.Low, nil},
+		{2, event.Info, nil},
+		{3, event.High, nil},
+		// drops the info event
+		{4, event.Medium, nil},
+		// the lowest queued level is low
+		{5, event.Info, event.ErrUnavailable},
+		{6, event.Low, event.ErrUnavailable},
+		// drops the low event
+		{7, event.Critical, nil},
+	}
+	for idx, test := range tests {
+		if _, err := p.NotifyEvent(context.Background(), event.New(test.code, test.level)); err != test.want {
+			t.Errorf("idx[%v] got error %v; want %v", idx, err, test.want)
+		}
+	}
+	stats := p.Stats()
+	if stats.Dropped != 2 || stats.Rejected != 2 {
+		t.Errorf("stats mismatch: dropped=%v rejected=%v", stats.Dropped, stats.Rejected)
+	}
+	if !reflect.DeepEqual(stats.Lanes, []uint64{0, 0, 1, 1, 1}) {
+		t.Errorf("lanes mismatch: %v", stats.Lanes)
+	}
+	// dequeued by level
+	if got := processed(); !reflect.DeepEqual(got, []event.Code{7, 3, 4}) {
+		t.Errorf("processed mismatch: %v", got)
+	}
+}
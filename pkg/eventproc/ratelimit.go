@@ -0,0 +1,206 @@
+// Copyright 2019 Luis Guillén Civera <luisguillenc@gmail.com>. View LICENSE.
+
+package eventproc
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/luids-io/api/event"
+	"google.golang.org/grpc/peer"
+)
+
+// RateKey defines the key used to group events in rate limits.
+type RateKey uint8
+
+// Rate keys.
+const (
+	RateByPeer RateKey = iota
+	RateByHostname
+	RateByProgram
+	RateBySource
+	RateByCode
+)
+
+func (k RateKey) String() string {
+	switch k {
+	case RateByPeer:
+		return "peer"
+	case RateByHostname:
+		return "hostname"
+	case RateByProgram:
+		return "program"
+	case RateBySource:
+		return "source"
+	case RateByCode:
+		return "code"
+	}
+	return fmt.Sprintf("unknown(%d)", k)
+}
+
+// ToRateKey returns the rate key from a string.
+func ToRateKey(s string) (RateKey, error) {
+	switch s {
+	case "peer":
+		return RateByPeer, nil
+	case "hostname":
+		return RateByHostname, nil
+	case "program":
+		return RateByProgram, nil
+	case "source":
+		return RateBySource, nil
+	case "code":
+		return RateByCode, nil
+	}
+	return RateByPeer, fmt.Errorf("invalid rate key '%s'", s)
+}
+
+// RateLimit option limits the events accepted for each value of the key,
+// using a token bucket that is filled at rate (events per second) up to
+// burst. It can be used several times with different keys.
+func RateLimit(key RateKey, rate float64, burst int) Option {
+	return func(o *options) {
+		if rate > 0 {
+			if burst < 1 {
+				burst = 1
+			}
+			o.limits = append(o.limits, rateLimit{key: key, rate: rate, burst: burst})
+		}
+	}
+}
+
+type rateLimit struct {
+	key   RateKey
+	rate  float64
+	burst int
+}
+
+// rateLimiter implements a token bucket for each value of the key.
+type rateLimiter struct {
+	rateLimit
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	tokens    float64
+	last      time.Time
+	throttled bool
+}
+
+const sweepInterval = time.Minute
+
+func newRateLimiter(l rateLimit) *rateLimiter {
+	return &rateLimiter{
+		rateLimit: l,
+		buckets:   make(map[string]*bucket),
+		lastSweep: time.Now(),
+	}
+}
+
+// allow returns true if the value is allowed, changed is true if the value
+// changed to throttled.
+func (l *rateLimiter) allow(value string, now time.Time) (allowed bool, changed bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if now.Sub(l.lastSweep) > sweepInterval {
+		l.sweep(now)
+	}
+	b, ok := l.buckets[value]
+	if !ok {
+		b = &bucket{tokens: float64(l.burst), last: now}
+		l.buckets[value] = b
+	}
+	b.tokens += now.Sub(b.last).Seconds() * l.rate
+	if b.tokens > float64(l.burst) {
+		b.tokens = float64(l.burst)
+	}
+	b.last = now
+	if b.tokens < 1 {
+		changed = !b.throttled
+		b.throttled = true
+		return false, changed
+	}
+	b.tokens--
+	b.throttled = false
+	return true, false
+}
+
+// refund returns the token taken by allow for the value.
+func (l *rateLimiter) refund(value string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if b, ok := l.buckets[value]; ok {
+		b.tokens++
+		if b.tokens > float64(l.burst) {
+			b.tokens = float64(l.burst)
+		}
+	}
+}
+
+// sweep removes full buckets, it must be called with the lock held.
+func (l *rateLimiter) sweep(now time.Time) {
+	refill := time.Duration(float64(l.burst) / l.rate * float64(time.Second))
+	for value, b := range l.buckets {
+		if now.Sub(b.last) > refill {
+			delete(l.buckets, value)
+		}
+	}
+	l.lastSweep = now
+}
+
+func (l *rateLimiter) value(e event.Event, p *peer.Peer) string {
+	switch l.key {
+	case RateByPeer:
+		if p == nil || p.Addr == nil {
+			return ""
+		}
+		addr := p.Addr.String()
+		if host, _, err := net.SplitHostPort(addr); err == nil {
+			return host
+		}
+		return addr
+	case RateByHostname:
+		return e.Source.Hostname
+	case RateByProgram:
+		return e.Source.Program
+	case RateBySource:
+		return e.Source.Hostname + "." + e.Source.Program
+	case RateByCode:
+		return strconv.Itoa(int(e.Code))
+	}
+	return ""
+}
+
+// checkRate returns false if the event exceeds any of the rate limits. The
+// tokens are only consumed if the event is allowed by all the limits.
+func (p *Processor) checkRate(e event.Event, pinfo *peer.Peer, paddr string) bool {
+	if len(p.limiters) == 0 {
+		return true
+	}
+	now := time.Now()
+	values := make([]string, 0, len(p.limiters))
+	for _, l := range p.limiters {
+		value := l.value(e, pinfo)
+		allowed, changed := l.allow(value, now)
+		if !allowed {
+			// refunds the tokens taken by the previous limits
+			for i, taken := range values {
+				p.limiters[i].refund(taken)
+			}
+			p.mu.Lock()
+			p.throttled++
+			p.mu.Unlock()
+			if changed {
+				p.logger.Warnf("eventproc: [peer=%s] rate limit exceeded for %s '%s'", paddr, l.key, value)
+			}
+			return false
+		}
+		values = append(values, value)
+	}
+	return true
+}
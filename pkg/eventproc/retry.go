@@ -0,0 +1,174 @@
+// Copyright 2019 Luis Guillén Civera <luisguillenc@gmail.com>. View LICENSE.
+
+package eventproc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/luids-io/api/event"
+)
+
+// RetryPolicy defines how plugin executions are retried when they fail.
+// Retries are performed by the goroutine processing the event, so the worker
+// is blocked while it waits and can't process other events. The delay is
+// capped to MaxRetryBackoff.
+type RetryPolicy struct {
+	// Attempts is the max number of executions of a plugin, including the
+	// first one. Values lower than 2 disable retries.
+	Attempts int
+	// Backoff is the delay before the first retry, it's multiplied by
+	// Multiplier in each retry up to MaxBackoff.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	Multiplier float64
+	// Jitter is the fraction of the delay that is randomized, from 0 to 1.
+	Jitter float64
+	// Retryable returns true if the error can be retried. If nil, all errors
+	// are retried.
+	Retryable func(error) bool
+}
+
+// Default values used in retry definitions.
+const (
+	DefaultRetryBackoff    = 100 * time.Millisecond
+	DefaultRetryMaxBackoff = time.Second
+	DefaultRetryMultiplier = 2.0
+	DefaultRetryJitter     = 0.2
+)
+
+// MaxRetryBackoff is the max delay before a retry, it limits the time that a
+// worker is blocked waiting.
+const MaxRetryBackoff = 5 * time.Second
+
+// DefaultRetryOn are the error classes retried if none is defined.
+var DefaultRetryOn = []string{"unavailable", "timeout"}
+
+// retryClasses classifies the errors returned by plugins.
+var retryClasses = map[string]func(error) bool{
+	"any": func(err error) bool {
+		return true
+	},
+	"unavailable": func(err error) bool {
+		return errors.Is(err, event.ErrUnavailable)
+	},
+	"internal": func(err error) bool {
+		return errors.Is(err, event.ErrInternal)
+	},
+	"timeout": func(err error) bool {
+		if errors.Is(err, context.DeadlineExceeded) {
+			return true
+		}
+		var terr interface{ Timeout() bool }
+		return errors.As(err, &terr) && terr.Timeout()
+	},
+}
+
+// RetryPolicyFromDef returns the retry policy defined.
+func RetryPolicyFromDef(def RetryDef) (RetryPolicy, error) {
+	r := RetryPolicy{
+		Attempts:   def.Attempts,
+		Backoff:    time.Duration(def.Backoff),
+		MaxBackoff: time.Duration(def.MaxBackoff),
+		Multiplier: def.Multiplier,
+		Jitter:     def.Jitter,
+	}
+	if r.Attempts < 1 {
+		return r, errors.New("invalid retry attempts")
+	}
+	if r.Backoff < 0 || r.MaxBackoff < 0 {
+		return r, errors.New("invalid retry backoff")
+	}
+	if r.Backoff > MaxRetryBackoff || r.MaxBackoff > MaxRetryBackoff {
+		return r, fmt.Errorf("retry backoff exceeds %v", MaxRetryBackoff)
+	}
+	if r.Multiplier != 0 && r.Multiplier < 1 {
+		return r, errors.New("invalid retry multiplier")
+	}
+	if r.Jitter < 0 || r.Jitter > 1 {
+		return r, errors.New("invalid retry jitter")
+	}
+	if r.Backoff == 0 {
+		r.Backoff = DefaultRetryBackoff
+	}
+	if r.MaxBackoff == 0 {
+		r.MaxBackoff = DefaultRetryMaxBackoff
+	}
+	if r.Multiplier == 0 {
+		r.Multiplier = DefaultRetryMultiplier
+	}
+	if r.Jitter == 0 {
+		r.Jitter = DefaultRetryJitter
+	}
+	on := def.On
+	if len(on) == 0 {
+		on = DefaultRetryOn
+	}
+	classes := make([]func(error) bool, 0, len(on))
+	for _, name := range on {
+		fn, ok := retryClasses[name]
+		if !ok {
+			return r, fmt.Errorf("invalid retry error class '%s'", name)
+		}
+		classes = append(classes, fn)
+	}
+	r.Retryable = func(err error) bool {
+		for _, fn := range classes {
+			if fn(err) {
+				return true
+			}
+		}
+		return false
+	}
+	return r, nil
+}
+
+// retry returns true if the plugin execution that failed with err in the
+// attempt passed must be retried.
+func (r RetryPolicy) retry(attempt int, err error) bool {
+	if attempt >= r.Attempts {
+		return false
+	}
+	if _, ok := err.(*PanicError); ok {
+		return false
+	}
+	return r.Retryable == nil || r.Retryable(err)
+}
+
+// delay returns the time to wait before the retry of the attempt passed.
+func (r RetryPolicy) delay(attempt int) time.Duration {
+	max := r.MaxBackoff
+	if max <= 0 || max > MaxRetryBackoff {
+		max = MaxRetryBackoff
+	}
+	d := float64(r.Backoff)
+	for i := 1; i < attempt; i++ {
+		d = d * r.Multiplier
+		if d >= float64(max) {
+			break
+		}
+	}
+	if d > float64(max) {
+		d = float64(max)
+	}
+	if r.Jitter > 0 {
+		d = d - d*r.Jitter*rand.Float64()
+	}
+	return time.Duration(d)
+}
+
+// wait sleeps before the retry of the attempt passed blocking the caller, it
+// returns false if the context is done before.
+func (r RetryPolicy) wait(ctx context.Context, attempt int) bool {
+	t := time.NewTimer(r.delay(attempt))
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright 2019 Luis Guillén Civera <luisguillenc@gmail.com>. View LICENSE.
+
+package eventproc
+
+import "hash/fnv"
+
+// Shard option enables the sharded dispatch of events. Each worker will have
+// its own queue and events with the same values in the keys will be queued
+// to the same worker, so they will be processed in the order they were
+// received. Each queue has the buffer size configured, so the processor can
+// hold up to buffer size * workers events, splitting the buffer would fill
+// the queues of the busy keys too soon. If priority is enabled, the order is kept only between events of the same level. If no
+// keys are passed, source hostname and program will be used.
+func Shard(keys ...FieldGetter) Option {
+	return func(o *options) {
+		o.shard = true
+		o.shardKeys = keys
+	}
+}
+
+func defaultShardKeys() []FieldGetter {
+	keys := make([]FieldGetter, 0, 2)
+	for _, name := range []string{"source.hostname", "source.program"} {
+		key, _ := Field(name)
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// newQueues returns the queues used by the workers.
+func newQueues(opts options) []*queue {
+	if !opts.shard || opts.workers < 2 {
+		return []*queue{newQueue(opts)}
+	}
+	queues := make([]*queue, 0, opts.workers)
+	for i := 0; i < opts.workers; i++ {
+		queues = append(queues, newQueue(opts))
+	}
+	return queues
+}
+
+// queueFor returns the queue for the request.
+func (p *Processor) queueFor(r *Request) *queue {
+	if len(p.queues) == 1 {
+		return p.queues[0]
+	}
+	h := fnv.New32a()
+	h.Write([]byte(fingerprint(p.shardKeys, &r.Event)))
+	return p.queues[h.Sum32()%uint32(len(p.queues))]
+}
+
+// workerQueue returns the queue for the worker.
+func (p *Processor) workerQueue(workerid int) *queue {
+	return p.queues[workerid%len(p.queues)]
+}
+
+func (p *Processor) closeQueues() {
+	for _, q := range p.queues {
+		q.close()
+	}
+}
+
+func (p *Processor) discardQueues() int {
+	abandoned := 0
+	for _, q := range p.queues {
+		abandoned += q.discard()
+	}
+	return abandoned
+}
+
+// queueStats adds the statistics of the queues.
+func (p *Processor) queueStats(s *Stats) {
+	if len(p.queues) > 1 {
+		s.Shards = make([]uint64, 0, len(p.queues))
+	}
+	for _, q := range p.queues {
+		lanes, rejected, dropped, abandoned := q.stats()
+		if s.Lanes == nil {
+			s.Lanes = make([]uint64, len(lanes))
+		}
+		queued := uint64(0)
+		for idx, n := range lanes {
+			s.Lanes[idx] += n
+			queued += n
+		}
+		s.Queued += queued
+		s.Rejected += rejected
+		s.Dropped += dropped
+		s.Abandoned += abandoned
+		if s.Shards != nil {
+			s.Shards = append(s.Shards, queued)
+		}
+	}
+}
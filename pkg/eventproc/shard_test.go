@@ -0,0 +1,106 @@
+// Copyright 2019 Luis Guillén Civera <luisguillenc@gmail.com>. See LICENSE.
+
+package eventproc_test
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/luids-io/api/event"
+	"github.com/luids-io/event/pkg/eventdb"
+	"github.com/luids-io/event/pkg/eventproc"
+)
+
+func TestShard(t *testing.T) {
+	var mu sync.Mutex
+	seen := make(map[string][]int)
+	record := eventproc.PluginFunc(func(e *event.Event) error {
+		time.Sleep(time.Duration(rand.Intn(500)) * time.Microsecond)
+		mu.Lock()
+		defer mu.Unlock()
+		seen[e.Source.Hostname] = append(seen[e.Source.Hostname], e.Data["seq"].(int))
+		return nil
+	})
+	main := eventproc.NewStack("main")
+	main.Add(&eventproc.Module{Name: "record", Plugins: []eventproc.ModulePlugin{record}})
+	db := eventdb.New([]eventdb.EventDef{{
+		Code:   1,
+		Type:   event.Security,
+		Fields: []eventdb.FieldDef{{Name: "seq", Type: "int"}},
+	}})
+	host, _ := eventproc.Field("source.hostname")
+	p := eventproc.New(main, nil, db, eventproc.Workers(8), eventproc.Shard(host))
+
+	keys, count := 3, 50
+	for seq := 0; seq < count; seq++ {
+		for k := 0; k < keys; k++ {
+			e := event.New(1, event.Low)
+			e.Source.Hostname = fmt.Sprintf("host%v", k)
+			e.Data["seq"] = seq
+			if _, err := p.NotifyEvent(context.Background(), e); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if _, err := p.Shutdown(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(seen) != keys {
+		t.Fatalf("keys mismatch exp=%v got=%v", keys, len(seen))
+	}
+	for key, seqs := range seen {
+		if len(seqs) != count {
+			t.Errorf("key %s: events mismatch exp=%v got=%v", key, count, len(seqs))
+		}
+		for idx, seq := range seqs {
+			if seq != idx {
+				t.Errorf("key %s: out of order %v", key, seqs)
+				break
+			}
+		}
+	}
+}
+
+func TestShardCapacity(t *testing.T) {
+	main := eventproc.NewStack("main")
+	main.Add(&eventproc.Module{Name: "noop"})
+	db := eventdb.New([]eventdb.EventDef{{Code: 1, Type: event.Security}})
+	host, _ := eventproc.Field("source.hostname")
+	p := eventproc.New(main, nil, db, eventproc.Workers(4), eventproc.Shard(host),
+		eventproc.SetBufferSize(10), eventproc.SetOverflowPolicy(eventproc.OverflowReject))
+	defer p.Close()
+
+	p.Pause()
+	// events of the same key use the same queue, with the buffer size configured
+	for i := 0; i < 11; i++ {
+		e := event.New(1, event.Low)
+		e.Source.Hostname = "host1"
+		_, err := p.NotifyEvent(context.Background(), e)
+		if i < 10 && err != nil {
+			t.Fatalf("idx[%v] unexpected error: %v", i, err)
+		}
+		if i == 10 && err != event.ErrUnavailable {
+			t.Errorf("idx[%v] expected error, got %v", i, err)
+		}
+	}
+	stats := p.Stats()
+	if len(stats.Shards) != 4 {
+		t.Fatalf("shards mismatch: %v", stats.Shards)
+	}
+	var total uint64
+	for _, n := range stats.Shards {
+		if n != 0 && n != 10 {
+			t.Errorf("unexpected shard size: %v", stats.Shards)
+		}
+		total += n
+	}
+	if total != 10 || stats.Rejected != 1 {
+		t.Errorf("stats mismatch: %v %v", stats.Shards, stats.Rejected)
+	}
+}
@@ -3,9 +3,11 @@
 package eventproc
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/luids-io/api/event"
 )
@@ -32,61 +34,71 @@ func (s *Stack) Add(m *Module) {
 	s.modules = append(s.modules, m)
 }
 
-func (s *Stack) process(p *Processor, e *Request) (status StackAction, last int) {
+// Modules returns the modules of the stack.
+func (s *Stack) Modules() []*Module {
+	modules := make([]*Module, len(s.modules))
+	copy(modules, s.modules)
+	return modules
+}
+
+// Module returns the module with the name passed.
+func (s *Stack) Module(name string) (*Module, bool) {
+	for _, m := range s.modules {
+		if m.Name == name {
+			return m, true
+		}
+	}
+	return nil, false
+}
+
+func (s *Stack) process(ctx context.Context, p *Processor, pl *pipeline, e *Request) (status StackAction, last int) {
 	for idx, r := range s.modules {
+		// the processing is aborted if the context is canceled
+		if err := ctx.Err(); err != nil {
+			p.logger.Warnf("processing aborted trace %v: %v", e.StackTrace, err)
+			e.errs = append(e.errs, err)
+			return StackAction{Action: ActionStop}, last
+		}
 		e.StackTrace = append(e.StackTrace, fmt.Sprintf("%s.%s", s.name, r.Name))
-		p.hrunner.beforeModule(e)
+		e.Module = ModuleInfo{Stack: s.name, Index: idx, Module: r, Filter: -1, Plugin: -1}
+		verdict, errs := p.hrunner.beforeModule(e)
+		e.Module.Verdict = verdict
+		p.hookErrors(e, errs)
 
 		last = idx
-		status = StackAction{Action: ActionNext}
-		apply := true
-		//check filters
-		if len(r.Filters) > 0 {
-			for _, filter := range r.Filters {
-				apply = filter(e.Event)
-				if !apply {
-					break //stop filtering
-				}
-			}
+		e.Module.Started = time.Now()
+		switch verdict.Action {
+		case VerdictDrop:
+			status = StackAction{Action: ActionStop}
+		case VerdictSkip:
+			status = StackAction{Action: ActionNext}
+		case VerdictReroute:
+			status = StackAction{Action: ActionJump, Label: verdict.Stack}
+		default:
+			status = s.runModule(ctx, p, r, e)
 		}
-		if apply {
-			status = r.OnSuccess
-			//exec plugins
-			if len(r.Plugins) > 0 {
-				for idx, plugin := range r.Plugins {
-					err := plugin(&e.Event)
-					if err != nil {
-						p.logger.Warnf("plugin execution trace %v idx %v: %v", e.StackTrace, idx, err)
-						status = r.OnError
-						break //stop exec
-					}
-				}
-			}
+		e.Module.Finished = time.Now()
+		e.Module.Action = status
+		e.Trace = append(e.Trace, e.Module.trace())
+		if e.Module.Err != nil {
+			e.errs = append(e.errs, e.Module.Err)
 		}
 		p.hrunner.afterModule(e)
 
-	LOOPJUMP:
-		for status.Action == ActionJump {
-			if status.Label == s.name {
-				p.logger.Errorf("loop autoreference in stack '%s': trace %v", s.name, e.StackTrace)
-				status = StackAction{Action: ActionStop}
-				break LOOPJUMP
-			}
-			for _, prev := range e.jumps {
-				if status.Label == prev {
-					p.logger.Errorf("loop find in stack '%s': trace %v", s.name, e.StackTrace)
-					status = StackAction{Action: ActionStop}
-					break LOOPJUMP
-				}
+		if status.Action == ActionFork {
+			if forkstack, ok := s.target(p, pl, e, status.Label); ok {
+				p.fork(pl, forkstack, s.name, e)
 			}
-			jmpstack, ok := p.stacks[status.Label]
+			status = StackAction{Action: ActionNext}
+		}
+		for status.Action == ActionJump {
+			jmpstack, ok := s.target(p, pl, e, status.Label)
 			if !ok {
-				p.logger.Errorf("can't find stack '%s': trace %v", status.Label, e.StackTrace)
 				status = StackAction{Action: ActionStop}
-				break LOOPJUMP
+				break
 			}
 			e.jumps = append(e.jumps, s.name)
-			status, _ = jmpstack.process(p, e)
+			status, _ = jmpstack.process(ctx, p, pl, e)
 			e.jumps = e.jumps[:len(e.jumps)-1]
 		}
 
@@ -97,6 +109,79 @@ func (s *Stack) process(p *Processor, e *Request) (status StackAction, last int)
 	return
 }
 
+// target returns the stack referenced by a jump or fork action, it checks
+// that the stack exists and that there are no loops.
+func (s *Stack) target(p *Processor, pl *pipeline, e *Request, label string) (*Stack, bool) {
+	if label == s.name {
+		p.logger.Errorf("loop autoreference in stack '%s': trace %v", s.name, e.StackTrace)
+		return nil, false
+	}
+	for _, prev := range e.jumps {
+		if label == prev {
+			p.logger.Errorf("loop find in stack '%s': trace %v", s.name, e.StackTrace)
+			return nil, false
+		}
+	}
+	stack, ok := pl.stacks[label]
+	if !ok {
+		p.logger.Errorf("can't find stack '%s': trace %v", label, e.StackTrace)
+		return nil, false
+	}
+	return stack, true
+}
+
+// runModule applies filters and plugins of the module, it returns the action
+// resulting of the execution.
+func (s *Stack) runModule(ctx context.Context, p *Processor, r *Module, e *Request) StackAction {
+	if r.Disabled() {
+		e.Module.Disabled = true
+		return StackAction{Action: ActionNext}
+	}
+	ctx = context.WithValue(ctx, requestKey{}, e)
+	if r.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.Timeout)
+		defer cancel()
+	}
+	//check filters
+	for idx, filter := range r.Filters {
+		result, err := safeFilter(ctx, filter, e.Event)
+		if err != nil {
+			p.modulePanic(r, e, err.(*PanicError))
+			e.Module.Filter = idx
+			e.Module.Err = err
+			return r.OnError
+		}
+		if !result {
+			e.Module.Filter = idx
+			return StackAction{Action: ActionNext}
+		}
+	}
+	//exec plugins
+	for idx, plugin := range r.Plugins {
+		err := safePlugin(ctx, plugin, &e.Event)
+		for attempt := 1; err != nil && r.Retry.retry(attempt, err); attempt++ {
+			p.logger.Debugf("plugin execution trace %v idx %v attempt %v: %v", e.StackTrace, idx, attempt, err)
+			if !r.Retry.wait(ctx, attempt) {
+				break
+			}
+			e.Module.Retries++
+			err = safePlugin(ctx, plugin, &e.Event)
+		}
+		if err != nil {
+			if perr, ok := err.(*PanicError); ok {
+				p.modulePanic(r, e, perr)
+			} else {
+				p.logger.Warnf("plugin execution trace %v idx %v: %v", e.StackTrace, idx, err)
+			}
+			e.Module.Plugin = idx
+			e.Module.Err = err
+			return r.OnError
+		}
+	}
+	return r.OnSuccess
+}
+
 // Module defines the information that will be stacked for the processing.
 type Module struct {
 	// Name of the module, it must be unique in the stack
@@ -116,13 +201,159 @@ type Module struct {
 	// OnError will be returned to the processor if there is an error in
 	// plugin execution.
 	OnError StackAction
+	// Timeout limits the time that filters and plugins of the module can
+	// spend processing an event, including retries. If zero, there is no
+	// limit.
+	Timeout time.Duration
+	// Retry defines how plugin executions are retried if they fail. Only the
+	// plugin that failed is executed again. The worker is blocked while it
+	// waits for a retry, up to MaxRetryBackoff for each attempt.
+	Retry RetryPolicy
+	// MaxPanics disables the module when the number of panics recovered in
+	// its filters and plugins reaches the value. A disabled module is
+	// skipped. If zero, the module is never disabled.
+	MaxPanics int
+	// FilterClasses and PluginClasses store the classes of the filters and
+	// plugins, they are informative and can be empty.
+	FilterClasses []string
+	PluginClasses []string
+
+	panics   int32
+	disabled int32
+}
+
+// ModuleInfo stores information about the module in execution. It's set in
+// the request before the module hooks are called.
+type ModuleInfo struct {
+	Stack    string
+	Index    int
+	Module   *Module
+	Started  time.Time
+	Finished time.Time
+	// Filter is the index of the filter that rejected the event or panicked,
+	// -1 if none.
+	Filter int
+	// Plugin is the index of the plugin that failed, -1 if none.
+	Plugin int
+	// Err is the error returned by the plugin that failed or the panic
+	// recovered in a filter or a plugin.
+	Err error
+	// Panicked is true if a filter or a plugin panicked.
+	Panicked bool
+	// Disabled is true if the module was skipped because it's disabled.
+	Disabled bool
+	// Verdict returned by the policy hooks, if it's not continue the module
+	// was not executed.
+	Verdict Verdict
+	// Retries is the number of plugin executions retried.
+	Retries int
+	// Action returned by the module.
+	Action StackAction
 }
 
-// ModuleFilter is a signature for functions that filters events.
-type ModuleFilter func(e event.Event) (result bool)
+// FilterClass returns the class of the filter that rejected the event or
+// panicked.
+func (m ModuleInfo) FilterClass() string {
+	return class(m.Module.FilterClasses, m.Filter)
+}
 
-// ModulePlugin is a signature for functions that process events.
-type ModulePlugin func(e *event.Event) error
+// PluginClass returns the class of the plugin that failed.
+func (m ModuleInfo) PluginClass() string {
+	return class(m.Module.PluginClasses, m.Plugin)
+}
+
+func (m ModuleInfo) trace() TraceEntry {
+	t := TraceEntry{
+		Stack:    m.Stack,
+		Module:   m.Module.Name,
+		Matched:  m.Filter < 0 && !m.Disabled && m.Verdict.Action == VerdictContinue,
+		Disabled: m.Disabled,
+		Retries:  m.Retries,
+		Action:   m.Action,
+		Duration: Duration(m.Finished.Sub(m.Started)),
+	}
+	if m.Verdict.Action != VerdictContinue {
+		t.Verdict = m.Verdict.String()
+	}
+	if m.Filter >= 0 {
+		t.Filter = m.FilterClass()
+	}
+	if m.Plugin >= 0 {
+		t.Plugin = m.PluginClass()
+	}
+	if m.Err != nil {
+		t.Error = m.Err.Error()
+	}
+	return t
+}
+
+// TraceEntry stores the outcome of a module execution.
+type TraceEntry struct {
+	Stack  string `json:"stack"`
+	Module string `json:"module"`
+	// Matched is false if a filter rejected the event or panicked, or the
+	// module is disabled.
+	Matched  bool `json:"matched"`
+	Disabled bool `json:"disabled,omitempty"`
+	// Verdict is set if a policy hook changed the processing of the module.
+	Verdict string `json:"verdict,omitempty"`
+	// Filter is the class of the filter that rejected the event or panicked.
+	Filter string `json:"filter,omitempty"`
+	// Plugin is set if a plugin failed, Error is set if a plugin failed or
+	// a filter panicked.
+	Plugin string `json:"plugin,omitempty"`
+	Error  string `json:"error,omitempty"`
+	// Retries is the number of plugin executions retried.
+	Retries  int         `json:"retries,omitempty"`
+	Action   StackAction `json:"action"`
+	Duration Duration    `json:"duration"`
+}
+
+type requestKey struct{}
+
+// TraceFromContext returns a copy of the trace of the request in process,
+// with the modules executed before the current one. The context passed to
+// filters and plugins by the processor contains the request.
+func TraceFromContext(ctx context.Context) ([]TraceEntry, bool) {
+	r, ok := ctx.Value(requestKey{}).(*Request)
+	if !ok {
+		return nil, false
+	}
+	trace := make([]TraceEntry, len(r.Trace))
+	copy(trace, r.Trace)
+	return trace, true
+}
+
+func class(classes []string, idx int) string {
+	if idx < 0 || idx >= len(classes) {
+		return ""
+	}
+	return classes[idx]
+}
+
+// ModuleFilter is a signature for functions that filters events. The context
+// passed will be canceled when the module timeout expires or when the
+// processor is closed.
+type ModuleFilter func(ctx context.Context, e event.Event) (result bool)
+
+// ModulePlugin is a signature for functions that process events. The context
+// passed will be canceled when the module timeout expires or when the
+// processor is closed.
+type ModulePlugin func(ctx context.Context, e *event.Event) error
+
+// FilterFunc adapts a filter function that doesn't use context.
+func FilterFunc(fn func(e event.Event) bool) ModuleFilter {
+	return func(ctx context.Context, e event.Event) bool {
+		return fn(e)
+	}
+}
+
+// PluginFunc adapts a plugin function that doesn't use context.
+func PluginFunc(fn func(e *event.Event) error) ModulePlugin {
+	return func(ctx context.Context, e *event.Event) error {
+		return fn(e)
+	}
+}
 
 // StackAction defines the actions returned by the modules to define the
 // processing flow.
@@ -141,8 +372,27 @@ const (
 	ActionFinish
 	ActionJump
 	ActionReturn
+	ActionFork
 )
 
+func (a Action) String() string {
+	switch a {
+	case ActionNext:
+		return "next"
+	case ActionStop:
+		return "stop"
+	case ActionFinish:
+		return "finish"
+	case ActionJump:
+		return "jump"
+	case ActionReturn:
+		return "return"
+	case ActionFork:
+		return "fork"
+	}
+	return fmt.Sprintf("unknown(%d)", a)
+}
+
 func (a StackAction) String() string {
 	switch a.Action {
 	case ActionNext:
@@ -155,8 +405,10 @@ func (a StackAction) String() string {
 		return fmt.Sprintf("jump %s", a.Label)
 	case ActionReturn:
 		return "return"
+	case ActionFork:
+		return fmt.Sprintf("fork %s", a.Label)
 	}
-	return fmt.Sprintf("unkown(%d)", a.Action)
+	return fmt.Sprintf("unknown(%d)", a.Action)
 }
 
 // MarshalJSON implements interface.
@@ -173,6 +425,8 @@ func (a StackAction) MarshalJSON() ([]byte, error) {
 		s = fmt.Sprintf("jump %s", a.Label)
 	case ActionReturn:
 		s = "return"
+	case ActionFork:
+		s = fmt.Sprintf("fork %s", a.Label)
 	default:
 		return nil, fmt.Errorf("invalid value '%v' for action", s)
 	}
@@ -207,5 +461,13 @@ func (a *StackAction) UnmarshalJSON(data []byte) error {
 			return nil
 		}
 	}
+	if strings.HasPrefix(s, "fork ") {
+		st := strings.Split(s, " ")
+		if len(st) == 2 {
+			a.Action = ActionFork
+			a.Label = st[1]
+			return nil
+		}
+	}
 	return fmt.Errorf("cannot unmarshal action '%s'", s)
 }
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"os"
 	"path"
+	"time"
 
 	"github.com/luids-io/core/apiservice"
 	"github.com/luids-io/core/yalogi"
@@ -147,18 +148,30 @@ func (b *Builder) buildModule(def ModuleDef) (*Module, error) {
 		Name:      def.Name,
 		OnSuccess: def.OnSuccess,
 		OnError:   def.OnError,
+		Timeout:   time.Duration(def.Timeout),
+		MaxPanics: def.MaxPanics,
 	}
-	//build filters
-	for _, defFilter := range def.Filters {
-		filterb, ok := filterBuilders[defFilter.Class]
-		if !ok {
-			return nil, fmt.Errorf("filter builder for '%s' not found", defFilter.Class)
-		}
-		filter, err := filterb(b, defFilter)
+	if module.Timeout < 0 {
+		return nil, errors.New("invalid timeout")
+	}
+	if module.MaxPanics < 0 {
+		return nil, errors.New("invalid max panics")
+	}
+	if def.Retry != nil {
+		retry, err := RetryPolicyFromDef(*def.Retry)
 		if err != nil {
 			return nil, err
 		}
+		module.Retry = retry
+	}
+	//build filters
+	for idx, defFilter := range def.Filters {
+		filter, err := b.BuildFilter(defFilter)
+		if err != nil {
+			return nil, WrapItemError(fmt.Sprintf("filters[%d]", idx), err)
+		}
 		module.Filters = append(module.Filters, filter)
+		module.FilterClasses = append(module.FilterClasses, defFilter.Class)
 	}
 	//build plugins
 	for _, defPlugin := range def.Plugins {
@@ -171,11 +184,51 @@ func (b *Builder) buildModule(def ModuleDef) (*Module, error) {
 			return nil, err
 		}
 		module.Plugins = append(module.Plugins, plugin)
+		module.PluginClasses = append(module.PluginClasses, defPlugin.Class)
 	}
 
 	return module, nil
 }
 
+// BuildFilter returns the filter defined by the item, it can be used by
+// composite filters to build the nested items.
+func (b *Builder) BuildFilter(def *ItemDef) (ModuleFilter, error) {
+	if def == nil {
+		return nil, errors.New("filter definition is empty")
+	}
+	filterb, ok := filterBuilders[def.Class]
+	if !ok {
+		return nil, fmt.Errorf("filter builder for '%s' not found", def.Class)
+	}
+	return filterb(b, def)
+}
+
+// ItemError is returned when the definition of a nested item is not valid.
+// Path locates the item in the definition of the module, for example
+// "filters[0].items[1]".
+type ItemError struct {
+	Path string
+	Err  error
+}
+
+func (e *ItemError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Path, e.Err)
+}
+
+// Unwrap returns the error of the item.
+func (e *ItemError) Unwrap() error {
+	return e.Err
+}
+
+// WrapItemError returns an ItemError for the item in the path passed. If err
+// is an ItemError of a nested item, the path is prepended.
+func WrapItemError(path string, err error) error {
+	if ierr, ok := err.(*ItemError); ok {
+		return &ItemError{Path: path + "." + ierr.Path, Err: ierr.Err}
+	}
+	return &ItemError{Path: path, Err: err}
+}
+
 // Logger returns logger inside builder.
 func (b *Builder) Logger() yalogi.Logger {
 	return b.logger
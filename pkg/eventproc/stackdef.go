@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"time"
 )
 
 // StackDef defines stack configuration.
@@ -23,14 +24,59 @@ type ModuleDef struct {
 	Plugins   []*ItemDef  `json:"plugins,omitempty"`
 	OnSuccess StackAction `json:"onsuccess"`
 	OnError   StackAction `json:"onerror"`
+	Timeout   Duration    `json:"timeout,omitempty"`
+	Retry     *RetryDef   `json:"retry,omitempty"`
+	MaxPanics int         `json:"maxpanics,omitempty"`
 	Disabled  bool        `json:"disabled"`
 }
 
+// RetryDef defines the retry policy of the plugins of a module.
+type RetryDef struct {
+	// Attempts is the max number of executions of a plugin, including the
+	// first one.
+	Attempts int `json:"attempts"`
+	// Backoff is the delay before the first retry, it's multiplied by
+	// Multiplier in each retry up to MaxBackoff.
+	Backoff    Duration `json:"backoff,omitempty"`
+	MaxBackoff Duration `json:"maxbackoff,omitempty"`
+	Multiplier float64  `json:"multiplier,omitempty"`
+	// Jitter is the fraction of the delay that is randomized.
+	Jitter float64 `json:"jitter,omitempty"`
+	// On lists the classes of errors that will be retried.
+	On []string `json:"on,omitempty"`
+}
+
 // ItemDef defines a generic configuration item for filters and plugins.
+// Items is used by composite items, such as the filters that combine other
+// filters.
 type ItemDef struct {
 	Class string                 `json:"class"`
 	Args  []string               `json:"args,omitempty"`
 	Opts  map[string]interface{} `json:"opts,omitempty"`
+	Items []*ItemDef             `json:"items,omitempty"`
+}
+
+// Duration is used in definitions to set durations using strings in the
+// format of time.ParseDuration (e.g. "1s", "500ms").
+type Duration time.Duration
+
+// MarshalJSON implements interface.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// UnmarshalJSON implements interface.
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("cannot unmarshal duration '%s'", s)
+	}
+	*d = Duration(v)
+	return nil
 }
 
 // StackDefsFromFile returns all stack definitions in a file in json format.
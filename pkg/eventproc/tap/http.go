@@ -0,0 +1,147 @@
+// Copyright 2019 Luis Guillén Civera <luisguillenc@gmail.com>. View LICENSE.
+
+package tap
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/luids-io/event/pkg/eventproc"
+	"github.com/luids-io/event/pkg/eventproc/filters/basicexpr"
+)
+
+// ErrTooManySubscribers is returned when the max number of subscribers is
+// reached.
+var ErrTooManySubscribers = errors.New("tap: too many subscribers")
+
+// ErrClosed is returned when the tap is closed.
+var ErrClosed = errors.New("tap: closed")
+
+// ServeHTTP implements http.Handler. It streams the messages to the client
+// using Server-Sent Events. Query parameters: filter (can be repeated) with
+// basicexpr expressions in the format "field op value", trace (bool) and
+// buffer (size of the subscriber buffer).
+func (t *Tap) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	query := r.URL.Query()
+	filters := make([]eventproc.ModuleFilter, 0, len(query["filter"]))
+	for _, expr := range query["filter"] {
+		filter, err := basicexpr.Parse(expr)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("filter '%s': %v", expr, err), http.StatusBadRequest)
+			return
+		}
+		filters = append(filters, filter)
+	}
+	trace, _ := strconv.ParseBool(query.Get("trace"))
+	size, _ := strconv.Atoi(query.Get("buffer"))
+	sub, err := t.Subscribe(filters, trace, size)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	defer sub.Close()
+	t.logger.Infof("tap: subscriber %s connected", r.RemoteAddr)
+	defer t.logger.Infof("tap: subscriber %s disconnected", r.RemoteAddr)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case msg, ok := <-sub.C():
+			if !ok {
+				return
+			}
+			data, err := json.Marshal(msg)
+			if err != nil {
+				t.logger.Warnf("tap: marshalling event '%s': %v", msg.Event.ID, err)
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "data: %s\n\n", data); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// Client consumes the stream of a tap.
+type Client struct {
+	url string
+	hc  *http.Client
+}
+
+// NewClient returns a client for the tap in the url passed. If hc is nil,
+// http.DefaultClient will be used.
+func NewClient(url string, hc *http.Client) *Client {
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	return &Client{url: url, hc: hc}
+}
+
+// Stream calls fn for each message received until the context is canceled,
+// the connection is closed or fn returns an error.
+func (c *Client) Stream(ctx context.Context, filters []string, trace bool, size int, fn func(Message) error) error {
+	query := url.Values{}
+	for _, f := range filters {
+		query.Add("filter", f)
+	}
+	if trace {
+		query.Set("trace", "true")
+	}
+	if size > 0 {
+		query.Set("buffer", strconv.Itoa(size))
+	}
+	req, err := http.NewRequest("GET", c.url+"?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	resp, err := c.hc.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var buf bytes.Buffer
+		buf.ReadFrom(resp.Body)
+		return fmt.Errorf("tap: %s: %s", resp.Status, strings.TrimSpace(buf.String()))
+	}
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data: ") {
+			continue
+		}
+		var msg Message
+		if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &msg); err != nil {
+			return fmt.Errorf("tap: unmarshalling message: %v", err)
+		}
+		if err := fn(msg); err != nil {
+			return err
+		}
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return scanner.Err()
+}
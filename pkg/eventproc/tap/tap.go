@@ -0,0 +1,208 @@
+// Copyright 2019 Luis Guillén Civera <luisguillenc@gmail.com>. View LICENSE.
+
+// Package tap implements a live stream of the events processed by the event
+// processor. Events are sent to the subscribers using Server-Sent Events.
+//
+// This package is a work in progress and makes no API stability promises.
+package tap
+
+import (
+	"context"
+	"sync"
+
+	"github.com/luids-io/api/event"
+	"github.com/luids-io/core/yalogi"
+	"github.com/luids-io/event/pkg/eventproc"
+)
+
+// Message is sent to the subscribers for each event processed.
+type Message struct {
+	Event  event.Event            `json:"event"`
+	Result eventproc.StackAction  `json:"result"`
+	Trace  []eventproc.TraceEntry `json:"trace,omitempty"`
+	// Dropped is the number of messages dropped before this one because the
+	// subscriber buffer was full.
+	Dropped uint64 `json:"dropped,omitempty"`
+}
+
+// Tap sends the events processed to the subscribers.
+type Tap struct {
+	opts   options
+	logger yalogi.Logger
+
+	mu     sync.RWMutex
+	subs   map[*Subscription]bool
+	closed bool
+}
+
+// Option is used for tap configuration.
+type Option func(*options)
+
+type options struct {
+	logger     yalogi.Logger
+	bufferSize int
+	maxSubs    int
+}
+
+var defaultOptions = options{
+	logger:     yalogi.LogNull,
+	bufferSize: 100,
+	maxSubs:    10,
+}
+
+// SetLogger option sets a logger for the component.
+func SetLogger(l yalogi.Logger) Option {
+	return func(o *options) {
+		o.logger = l
+	}
+}
+
+// SetBufferSize option sets the default buffer size of the subscribers.
+func SetBufferSize(n int) Option {
+	return func(o *options) {
+		if n > 0 {
+			o.bufferSize = n
+		}
+	}
+}
+
+// MaxSubscribers option sets the max number of subscribers.
+func MaxSubscribers(n int) Option {
+	return func(o *options) {
+		if n > 0 {
+			o.maxSubs = n
+		}
+	}
+}
+
+// New creates a new tap.
+func New(opt ...Option) *Tap {
+	opts := defaultOptions
+	for _, o := range opt {
+		o(&opts)
+	}
+	return &Tap{
+		opts:   opts,
+		logger: opts.logger,
+		subs:   make(map[*Subscription]bool),
+	}
+}
+
+// Hooks registers the tap in the hooks of the processor.
+func (t *Tap) Hooks(h *eventproc.Hooks) {
+	h.AfterProc(t.publish)
+}
+
+// Subscription receives the messages of the events processed.
+type Subscription struct {
+	tap     *Tap
+	c       chan Message
+	filters []eventproc.ModuleFilter
+	trace   bool
+
+	mu sync.Mutex
+	// dropped is the total of messages dropped, pending the messages dropped
+	// since the last message sent
+	dropped uint64
+	pending uint64
+	closed  bool
+}
+
+// Subscribe returns a new subscription. Only the events that pass all the
+// filters will be sent. If trace is true, the trace of the request will be
+// included in the messages. If size is zero, the default buffer size will be
+// used. Messages are dropped if the buffer is full, so a slow subscriber
+// never slows down the processor.
+func (t *Tap) Subscribe(filters []eventproc.ModuleFilter, trace bool, size int) (*Subscription, error) {
+	if size <= 0 {
+		size = t.opts.bufferSize
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return nil, ErrClosed
+	}
+	if len(t.subs) >= t.opts.maxSubs {
+		return nil, ErrTooManySubscribers
+	}
+	s := &Subscription{
+		tap:     t,
+		c:       make(chan Message, size),
+		filters: filters,
+		trace:   trace,
+	}
+	t.subs[s] = true
+	return s, nil
+}
+
+// C returns the channel of the messages, it's closed when the subscription
+// is closed.
+func (s *Subscription) C() <-chan Message {
+	return s.c
+}
+
+// Dropped returns the total number of messages dropped.
+func (s *Subscription) Dropped() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.dropped
+}
+
+// Close the subscription.
+func (s *Subscription) Close() {
+	s.tap.mu.Lock()
+	delete(s.tap.subs, s)
+	s.tap.mu.Unlock()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.closed {
+		s.closed = true
+		close(s.c)
+	}
+}
+
+// Close closes all the subscriptions, new subscriptions will be refused.
+func (t *Tap) Close() {
+	t.mu.Lock()
+	t.closed = true
+	subs := make([]*Subscription, 0, len(t.subs))
+	for s := range t.subs {
+		subs = append(subs, s)
+	}
+	t.mu.Unlock()
+	for _, s := range subs {
+		s.Close()
+	}
+}
+
+func (t *Tap) publish(r *eventproc.Request) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	for s := range t.subs {
+		s.send(r)
+	}
+}
+
+func (s *Subscription) send(r *eventproc.Request) {
+	for _, filter := range s.filters {
+		if !filter(context.Background(), r.Event) {
+			return
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	msg := Message{Event: r.Event, Result: r.Result, Dropped: s.pending}
+	if s.trace {
+		msg.Trace = r.Trace
+	}
+	select {
+	case s.c <- msg:
+		s.pending = 0
+	default:
+		s.dropped++
+		s.pending++
+	}
+}
@@ -0,0 +1,131 @@
+// Copyright 2019 Luis Guillén Civera <luisguillenc@gmail.com>. See LICENSE.
+
+package tap_test
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/luids-io/api/event"
+	"github.com/luids-io/event/pkg/eventdb"
+	"github.com/luids-io/event/pkg/eventproc"
+	"github.com/luids-io/event/pkg/eventproc/filters/basicexpr"
+	"github.com/luids-io/event/pkg/eventproc/tap"
+)
+
+func newProcessor(t *tap.Tap) *eventproc.Processor {
+	main := eventproc.NewStack("main")
+	main.Add(&eventproc.Module{
+		Name:    "nop",
+		Plugins: []eventproc.ModulePlugin{eventproc.PluginFunc(func(e *event.Event) error { return nil })},
+	})
+	db := eventdb.New([]eventdb.EventDef{{Code: 1, Type: event.Security}, {Code: 2, Type: event.Security}})
+	hooks := eventproc.NewHooks()
+	t.Hooks(hooks)
+	return eventproc.New(main, nil, db, eventproc.Workers(1), eventproc.SetHooks(hooks))
+}
+
+func TestSubscribe(t *testing.T) {
+	etap := tap.New(tap.MaxSubscribers(1))
+	p := newProcessor(etap)
+	defer p.Close()
+
+	filter, err := basicexpr.Parse("code == 2")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	sub, err := etap.Subscribe([]eventproc.ModuleFilter{filter}, true, 1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := etap.Subscribe(nil, false, 0); err != tap.ErrTooManySubscribers {
+		t.Errorf("expected too many subscribers, got: %v", err)
+	}
+	ctx := context.Background()
+	p.Process(ctx, event.New(1, event.Low))
+	p.Process(ctx, event.New(2, event.Low))
+	p.Process(ctx, event.New(2, event.High))
+	// buffer is full, last event dropped
+	if sub.Dropped() != 1 {
+		t.Errorf("dropped mismatch: %v", sub.Dropped())
+	}
+	msg := <-sub.C()
+	if msg.Event.Code != 2 || msg.Event.Level != event.Low {
+		t.Errorf("event mismatch: %+v", msg.Event)
+	}
+	if len(msg.Trace) != 1 || msg.Result.Action != eventproc.ActionNext {
+		t.Errorf("result mismatch: %+v", msg)
+	}
+	p.Process(ctx, event.New(2, event.Medium))
+	msg = <-sub.C()
+	if msg.Dropped != 1 || msg.Event.Level != event.Medium {
+		t.Errorf("message mismatch: %+v", msg)
+	}
+	p.Process(ctx, event.New(2, event.Medium))
+	msg = <-sub.C()
+	if msg.Dropped != 0 || sub.Dropped() != 1 {
+		t.Errorf("dropped mismatch: %v %v", msg.Dropped, sub.Dropped())
+	}
+	sub.Close()
+	if _, ok := <-sub.C(); ok {
+		t.Error("channel not closed")
+	}
+	sub, err = etap.Subscribe(nil, false, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	etap.Close()
+	if _, ok := <-sub.C(); ok {
+		t.Error("channel not closed")
+	}
+	if _, err := etap.Subscribe(nil, false, 0); err != tap.ErrClosed {
+		t.Errorf("expected closed, got: %v", err)
+	}
+}
+
+func TestStream(t *testing.T) {
+	etap := tap.New()
+	p := newProcessor(etap)
+	defer p.Close()
+	ts := httptest.NewServer(etap)
+	defer ts.Close()
+	client := tap.NewClient(ts.URL, ts.Client())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.Stream(ctx, []string{"code =="}, false, 0, nil); err == nil {
+		t.Error("expected error")
+	}
+	done := errors.New("done")
+	errc := make(chan error, 1)
+	var got []tap.Message
+	go func() {
+		errc <- client.Stream(ctx, []string{"code == 2"}, false, 0, func(msg tap.Message) error {
+			got = append(got, msg)
+			if len(got) == 2 {
+				return done
+			}
+			return nil
+		})
+	}()
+	// events are sent until the subscriber is connected and gets them
+	for ctx.Err() == nil {
+		p.Process(ctx, event.New(1, event.Low))
+		p.Process(ctx, event.New(2, event.Info))
+		if len(errc) > 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := <-errc; err != done {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, msg := range got {
+		if msg.Event.Code != 2 || len(msg.Trace) > 0 {
+			t.Errorf("message mismatch: %+v", msg)
+		}
+	}
+}